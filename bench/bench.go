@@ -11,7 +11,9 @@ import (
 	"time"
 
 	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/history"
 	"github.com/uluyol/fabbench/internal/ranges"
+	"github.com/uluyol/fabbench/internal/splitmix"
 	"github.com/uluyol/fabbench/internal/syncrand"
 	"github.com/uluyol/fabbench/intgen"
 	"github.com/uluyol/fabbench/recorders"
@@ -19,9 +21,27 @@ import (
 
 type Config struct {
 	_           struct{}
-	RecordCount int64 `json:"recordCount"`
-	KeySize     int   `json:"keySize"`
-	ValSize     int   `json:"valSize"`
+	RecordCount int64  `json:"recordCount"`
+	KeySize     int    `json:"keySize"`
+	ValSize     int    `json:"valSize"`
+	ValSizeDist string `json:"valSizeDist,omitempty"`
+	ValContent  string `json:"valContent,omitempty"`
+}
+
+func (c *Config) newValueGen() (*valueGen, error) {
+	var sizes valSizeDist
+	if c.ValSizeDist != "" {
+		var err error
+		sizes, err = parseValSizeDist(c.ValSizeDist)
+		if err != nil {
+			return nil, fmt.Errorf("invalid valSizeDist: %v", err)
+		}
+	}
+	content, err := parseValContent(c.ValContent)
+	if err != nil {
+		return nil, fmt.Errorf("invalid valContent: %v", err)
+	}
+	return newValueGen(makeValSizeGen(sizes, c.ValSize), content), nil
 }
 
 type counter struct {
@@ -49,6 +69,12 @@ type Logger interface {
 	Printf(format string, v ...interface{})
 }
 
+// A StepBarrier coordinates when clients start each step.
+// WaitStep blocks until the step should start.
+type StepBarrier interface {
+	WaitStep(ctx context.Context, step int) error
+}
+
 type Loader struct {
 	_               struct{}
 	Log             Logger
@@ -58,6 +84,13 @@ type Loader struct {
 	NumWorkers      int
 	AllowedFailFrac float64
 
+	// Verify makes the loader write verifiable values
+	// so that they can be checked by a Runner with Verify set.
+	Verify bool
+
+	// Barrier, if set, is waited on (as step 0) before loading.
+	Barrier StepBarrier
+
 	LoadStart int64
 	LoadCount int64
 }
@@ -119,7 +152,10 @@ func (l *Loader) Run(ctx context.Context) error {
 		G:   &intgen.Counter{Count: l.LoadStart},
 		Len: l.Config.KeySize,
 	}
-	valGen := newValueGen(l.Config.ValSize)
+	valGen, err := l.Config.newValueGen()
+	if err != nil {
+		return err
+	}
 
 	newCtx, cancel := context.WithCancel(ctx)
 
@@ -132,6 +168,13 @@ func (l *Loader) Run(ctx context.Context) error {
 		loadCount = l.Config.RecordCount
 	}
 
+	if l.Barrier != nil {
+		if err := l.Barrier.WaitStep(ctx, 0); err != nil {
+			cancel()
+			return err
+		}
+	}
+
 	nops := new(counter)
 	nfail := new(counter)
 	errs := make(chan error)
@@ -152,7 +195,12 @@ func (l *Loader) Run(ctx context.Context) error {
 
 			for i := nops.getAndInc(); i < loadCount; i = nops.getAndInc() {
 				key := keyGen.Next(rng)
-				val := valGen.Next(rng)
+				var val string
+				if l.Verify {
+					val = valGen.NextVerifiable(rng, key, 0)
+				} else {
+					val = valGen.Next(rng)
+				}
 				if _, err := l.DB.Put(newCtx, key, val); err != nil {
 					curFail := nfail.getAndInc()
 					if float64(curFail)/float64(loadCount) > l.AllowedFailFrac {
@@ -195,23 +243,38 @@ var zfGenCache = struct {
 	items: make(map[zfArgs]intgen.Gen),
 }
 
+// cachedZipfian returns a zipfian generator over nitems items,
+// reusing one that was made earlier with the same arguments
+// since they are expensive to create.
+func cachedZipfian(nitems int64, theta float64) intgen.Gen {
+	zfGenCache.mu.Lock()
+	defer zfGenCache.mu.Unlock()
+	g := zfGenCache.items[zfArgs{nitems, theta}]
+	if g == nil {
+		g = intgen.NewZipfianN(nitems, theta)
+		zfGenCache.items[zfArgs{nitems, theta}] = g
+	}
+	return g
+}
+
 func makeReqGen(d keyDist, nitems int64) intgen.Gen {
 	var g intgen.Gen
 	switch d.Kind {
 	case kdUniform:
 		g = intgen.NewUniform(nitems)
 	case kdZipfian:
-		zfGenCache.mu.Lock()
-		defer zfGenCache.mu.Unlock()
-		g = zfGenCache.items[zfArgs{nitems, d.zfTheta()}]
-		if g == nil {
-			g = intgen.NewZipfianN(nitems, d.zfTheta())
-			zfGenCache.items[zfArgs{nitems, d.zfTheta()}] = g
-		}
+		g = cachedZipfian(nitems, d.zfTheta())
 	case kdLinear:
 		g = intgen.NewLinear(nitems)
 	case kdLinStep:
 		g = intgen.NewLinearStep(nitems, d.lsSteps())
+	case kdExponential:
+		g = intgen.NewExponential(nitems, d.expLambda())
+	case kdNormal:
+		mu, sigma := d.normParams()
+		g = intgen.NewNormal(nitems, mu, sigma)
+	case kdHist:
+		g = newHistGen(d.hist, d.histScale(nitems))
 	default:
 		panic(fmt.Errorf("invalid key dist %v", d))
 	}
@@ -241,10 +304,55 @@ type Runner struct {
 	Rand   *rand.Rand
 	Trace  []TraceStep
 
+	// Verify makes the runner write verifiable values and check
+	// the values returned by reads.
+	// The data must have been loaded by a Loader with Verify set.
+	Verify bool
+
+	// VerifyClient is the index of this client among clients running
+	// with Verify against the same data at the same time.
+	VerifyClient int
+
+	// History, if set, records every request for linearizability checking.
+	History *history.Writer
+
+	// Barrier, if set, is waited on before each step.
+	Barrier StepBarrier
+
 	ReadRecorder  *recorders.MultiLatency
 	ReadWriter    recorders.MultiLogWriter
 	WriteRecorder *recorders.MultiLatency
 	WriteWriter   recorders.MultiLogWriter
+
+	// StaleSampleFrac is the fraction of keys for which
+	// the staleness of reads is recorded to StaleRecorder.
+	// Fresh reads are recorded with a staleness of 0.
+	StaleSampleFrac float64
+	StaleRecorder   *recorders.MultiLatency
+	StaleWriter     recorders.MultiLogWriter
+
+	// IssueRecorder, if set, records the issue lag of open-loop requests,
+	// i.e. how long after their scheduled start they were sent, and
+	// counts the requests scheduled and issued in each step.
+	// Reads and writes are recorded under the names read and write.
+	IssueRecorder *recorders.MultiLatency
+	IssueWriter   recorders.MultiLogWriter
+
+	// QueueRecorder, if set, records how long requests in steps with
+	// maxinflight=queue-N wait for other requests to complete before
+	// being sent, under the names read and write.
+	QueueRecorder *recorders.MultiLatency
+	QueueWriter   recorders.MultiLogWriter
+
+	// Engine is how requests are issued.
+	// Requests sent by long-lived workers (closed-loop workers, pool workers,
+	// and maxinflight=queue-N workers) are recorded to per-worker shards
+	// of the recorders, which are merged every shardFlushInterval and when
+	// the worker exits, rather than sending each result to the recorders.
+	// PoolWorkers is the number of workers used by EnginePool
+	// (DefaultPoolWorkers if 0).
+	Engine      Engine
+	PoolWorkers int
 }
 
 type result struct {
@@ -257,16 +365,22 @@ type result struct {
 
 	name    string
 	latency time.Duration
+	nbytes  int64
 	err     error
+	counter string // optional, counter to increment
+	count   int64  // if set, add to counter and ignore latency, err
+
+	shard *recorders.Shard // if set, merge into the recorder
 
 	isDone bool
 }
 
-func resDoneReq(step int, name string, latency time.Duration, err error) result {
+func resDoneReq(step int, name string, latency time.Duration, nbytes int64, err error) result {
 	return result{
 		step:    step,
 		name:    name,
 		latency: latency,
+		nbytes:  nbytes,
 		err:     err,
 	}
 }
@@ -279,6 +393,20 @@ func resEnd(step int, t time.Time) result {
 	return result{step: step, timeEnd: &t}
 }
 
+func resCount(step int, name, counter string, n int64) result {
+	return result{step: step, name: name, counter: counter, count: n}
+}
+
+func resShard(s *recorders.Shard) result {
+	return result{step: -1, shard: s}
+}
+
+// isReq reports whether r is the result of a request
+// rather than a marker, counter, or shard.
+func (r *result) isReq() bool {
+	return !r.isDone && r.timeBeg == nil && r.timeEnd == nil && r.count == 0 && r.shard == nil
+}
+
 func resRunIsDone() result {
 	return result{step: -1, isDone: true}
 }
@@ -293,8 +421,18 @@ func recordAndWrite(c <-chan result, wg *sync.WaitGroup, rec *recorders.MultiLat
 			rec.SetStart(res.step, *res.timeBeg)
 		case res.timeEnd != nil:
 			rec.SetEnd(res.step, *res.timeEnd)
+		case res.count != 0:
+			rec.AddCount(res.name, res.step, res.counter, res.count)
+		case res.shard != nil:
+			rec.Merge(res.shard)
 		default:
 			rec.Record(res.name, res.step, res.latency, res.err)
+			if res.err == nil {
+				rec.AddBytes(res.name, res.step, res.nbytes)
+			}
+			if res.counter != "" {
+				rec.AddCount(res.name, res.step, res.counter, 1)
+			}
 		}
 		if exitLoop {
 			break
@@ -313,12 +451,22 @@ func (c *resultCounter) countAndFwdTo(fwdC chan<- result) chan<- result {
 	ch := make(chan result, cap(fwdC))
 	go func() {
 		for r := range ch {
-			if r.err != nil {
-				atomic.AddInt32(&c.fail, 1)
-			} else {
-				atomic.AddInt32(&c.succ, 1)
+			if r.isReq() {
+				if r.err != nil {
+					atomic.AddInt32(&c.fail, 1)
+				} else {
+					atomic.AddInt32(&c.succ, 1)
+				}
+			}
+			if r.shard != nil {
+				succ, fail := r.shard.Requests()
+				atomic.AddInt32(&c.succ, int32(succ))
+				atomic.AddInt32(&c.fail, int32(fail))
 			}
 			fwdC <- r
+			if r.isDone {
+				break
+			}
 		}
 		close(fwdC)
 	}()
@@ -331,8 +479,77 @@ func (c *resultCounter) getAndReset() (succ int32, fail int32) {
 	return succ, fail
 }
 
+// lateThreshold is how far behind schedule a request
+// must be issued to count as late.
+const lateThreshold = 10 * time.Millisecond
+
+// issueStats tracks whether open-loop requests are issued on schedule.
+type issueStats struct {
+	scheduled int64
+	issued    int64
+	late      int64
+	maxLag    int64
+	dropped   int64
+}
+
+func (s *issueStats) issue(lag time.Duration) {
+	atomic.AddInt64(&s.issued, 1)
+	if lag < lateThreshold {
+		return
+	}
+	atomic.AddInt64(&s.late, 1)
+	for {
+		max := atomic.LoadInt64(&s.maxLag)
+		if int64(lag) <= max || atomic.CompareAndSwapInt64(&s.maxLag, max, int64(lag)) {
+			return
+		}
+	}
+}
+
+func (s *issueStats) getAndReset() (scheduled, issued, dropped, late int64, maxLag time.Duration) {
+	scheduled = atomic.SwapInt64(&s.scheduled, 0)
+	issued = atomic.SwapInt64(&s.issued, 0)
+	dropped = atomic.SwapInt64(&s.dropped, 0)
+	late = atomic.SwapInt64(&s.late, 0)
+	maxLag = time.Duration(atomic.SwapInt64(&s.maxLag, 0))
+	return scheduled, issued, dropped, late, maxLag
+}
+
+// logAndReset logs dropped requests and warns if requests
+// were not issued on schedule since the last call.
+func (s *issueStats) logAndReset(l Logger) {
+	sched, issued, dropped, late, maxLag := s.getAndReset()
+	if dropped > 0 {
+		l.Printf("dropped %d requests over the in-flight limit", dropped)
+	}
+	// dropped requests were on time, but were never issued
+	if sched-issued-dropped > sched/100 || late > issued/100 {
+		l.Printf("warning: client is falling behind: issued %d of %d scheduled requests, %d over %v late (max %v); "+
+			"the client, not the db, may be the bottleneck", issued, sched, late, lateThreshold, maxLag)
+	}
+}
+
 func (r *Runner) Run(parentCtx context.Context) error {
-	valGen := newValueGen(r.Config.ValSize)
+	valGen, err := r.Config.newValueGen()
+	if err != nil {
+		return err
+	}
+	for i := range r.Trace {
+		for _, d := range []keyDist{r.Trace[i].ReadKeyDist, r.Trace[i].WriteKeyDist} {
+			if err := d.checkKeys(r.Config.RecordCount); err != nil {
+				return fmt.Errorf("trace step %d: %v", i, err)
+			}
+		}
+	}
+	for i := range r.Trace {
+		if ad := r.Trace[i].ArrivalDist; ad.Kind == adClosed || ad.Kind == adClosedTime {
+			continue
+		}
+		t := recorders.Target{QPS: float64(r.Trace[i].AvgQPS), ReadRatio: float64(r.Trace[i].RWRatio)}
+		for _, rec := range []*recorders.MultiLatency{r.ReadRecorder, r.WriteRecorder, r.StaleRecorder, r.IssueRecorder, r.QueueRecorder} {
+			rec.SetTarget(i, t)
+		}
+	}
 
 	var runWG sync.WaitGroup
 
@@ -344,61 +561,161 @@ func (r *Runner) Run(parentCtx context.Context) error {
 	runWG.Add(1)
 	go recordAndWrite(writeRecordC, &runWG, r.WriteRecorder, r.WriteWriter)
 
+	var verifier *verifier
+	if r.Verify {
+		verifier = newVerifier(r.VerifyClient)
+	}
+
 	var readCounter, writeCounter resultCounter
 
 	readC := readCounter.countAndFwdTo(readRecordC)
 	writeC := writeCounter.countAndFwdTo(writeRecordC)
 
+	var stale *staleTracker
+	var staleC chan result
+	if r.StaleSampleFrac > 0 {
+		stale = newStaleTracker(r.StaleSampleFrac)
+		staleC = make(chan result, 2*runtime.NumCPU())
+		runWG.Add(1)
+		go recordAndWrite(staleC, &runWG, r.StaleRecorder, r.StaleWriter)
+	}
+
+	var issueC chan result
+	if r.IssueRecorder != nil {
+		// one result per request is sent by the issuers themselves,
+		// so buffer generously to avoid delaying them
+		issueC = make(chan result, 1024)
+		runWG.Add(1)
+		go recordAndWrite(issueC, &runWG, r.IssueRecorder, r.IssueWriter)
+	}
+
+	var queueC chan result
+	if r.QueueRecorder != nil {
+		queueC = make(chan result, 2*runtime.NumCPU())
+		runWG.Add(1)
+		go recordAndWrite(queueC, &runWG, r.QueueRecorder, r.QueueWriter)
+	}
+
+	var issue issueStats
 	msgLogger := openPeriodicLogger(r.Log, 10*time.Second, func(l Logger) {
 		rs, rf := readCounter.getAndReset()
 		ws, wf := writeCounter.getAndReset()
 		l.Printf("since last mesg: %d good, %d errored reads; %d good, %d errored writes", rs, rf, ws, wf)
+		issue.logAndReset(l)
 	})
 
 	var reqWG sync.WaitGroup
+	var workerWG sync.WaitGroup // workers and requests may outlive their step
+
+	poolWorkers := r.PoolWorkers
+	if poolWorkers <= 0 {
+		poolWorkers = DefaultPoolWorkers
+	}
 
 	ctx, cancelCtx := context.WithCancel(parentCtx)
 
+	// on error, stop and still shut down and write logs for completed steps
+	var runErr error
+steps:
 	for tsIndex, ts := range r.Trace {
 		if r.Log != nil {
 			r.Log.Printf("starting trace step %d: %s", tsIndex, &ts)
 		}
 		select {
 		case <-ctx.Done():
-			cancelCtx()
-			return ctx.Err()
+			runErr = ctx.Err()
+			break steps
 		default: // don't wait
 		}
 		rig := makeReqGen(ts.ReadKeyDist, r.Config.RecordCount)
 		wig := makeReqGen(ts.WriteKeyDist, r.Config.RecordCount)
 		readKeyGen := stringGen{G: rig, Len: r.Config.KeySize}
 		writeKeyGen := stringGen{G: wig, Len: r.Config.KeySize}
+		stepValGen := valGen
+		if ts.ValSizeDist.Kind != 0 {
+			stepValGen = valGen.withSizes(makeValSizeGen(ts.ValSizeDist, r.Config.ValSize))
+		}
 
 		args := issueArgs{
 			db:          r.DB,
 			readKeyGen:  readKeyGen,
 			writeKeyGen: writeKeyGen,
-			valGen:      valGen,
+			valGen:      stepValGen,
+			verifier:    verifier,
+			history:     r.History,
 			rwRatio:     ts.RWRatio,
 			rand:        r.Rand,
 			readC:       readC,
 			writeC:      writeC,
+			stale:       stale,
+			staleC:      staleC,
+			issue:       &issue,
+			issueC:      issueC,
+			queueC:      queueC,
 			tsStep:      tsIndex,
 		}
+		step := tsIndex
+		args.newShards = func() *recShards { return r.newShards(step) }
+
+		if r.Barrier != nil {
+			if err := r.Barrier.WaitStep(ctx, tsIndex); err != nil {
+				runErr = err
+				break steps
+			}
+		}
 
 		start := time.Now()
 		readC <- resBegin(tsIndex, start)
 		writeC <- resBegin(tsIndex, start)
+		if staleC != nil {
+			staleC <- resBegin(tsIndex, start)
+		}
+		if issueC != nil {
+			issueC <- resBegin(tsIndex, start)
+		}
+		if queueC != nil {
+			queueC <- resBegin(tsIndex, start)
+		}
+		// let the db tell which step requests are in
+		stepCtx := db.ContextWithStep(ctx, tsIndex)
 		switch ts.ArrivalDist.Kind {
 		case adClosed:
 			nops := int64(ts.Duration.Seconds() * float64(ts.AvgQPS))
 			dur := time.Duration(math.MaxInt64)
-			issueClosed(ctx, args, &reqWG, ts.ArrivalDist.clWorkers(), nops, dur)
+			issueClosed(stepCtx, args, &reqWG, ts.ArrivalDist.clWorkers(), nops, dur)
 		case adClosedTime:
 			nops := int64(math.MaxInt64)
 			dur := ts.Duration
-			issueClosed(ctx, args, &reqWG, ts.ArrivalDist.clWorkers(), nops, dur)
+			issueClosed(stepCtx, args, &reqWG, ts.ArrivalDist.clWorkers(), nops, dur)
 		default:
+			if ts.AvgQPS == 0 {
+				select {
+				case <-time.After(ts.Duration):
+				case <-ctx.Done():
+				}
+				break
+			}
+			switch ts.MaxInFlight.Policy {
+			case ipDrop, ipBlock:
+				args.inflightPolicy = ts.MaxInFlight.Policy
+				args.inflight = make(chan struct{}, ts.MaxInFlight.Max)
+			case ipQueue:
+				args.queue = newReqQueue(ts.MaxInFlight.Max)
+				workerWG.Add(ts.MaxInFlight.Max)
+				for i := 0; i < ts.MaxInFlight.Max; i++ {
+					go args.queue.work(stepCtx, args, &workerWG)
+				}
+			}
+			var jobs chan poolJob
+			if r.Engine == EnginePool && args.queue == nil {
+				jobs = make(chan poolJob, poolWorkers)
+				workerWG.Add(poolWorkers)
+				for i := 0; i < poolWorkers; i++ {
+					rng := rand.New(splitmix.New(uint64(r.Rand.Int63())))
+					go poolWork(stepCtx, args, rng, jobs, &workerWG)
+				}
+				args.jobs = jobs
+			}
 			numShards := int64(runtime.NumCPU())
 			if ts.AvgQPS < 200 {
 				numShards = 1
@@ -414,26 +731,64 @@ func (r *Runner) Run(parentCtx context.Context) error {
 				arrivalGen := makeArrivalDist(ts.ArrivalDist, float64(meanPeriod))
 				args.rand = rand.New(rand.NewSource(r.Rand.Int63()))
 				go func(wargs issueArgs, wag intgen.Gen, dur time.Duration) {
-					issueOpen(ctx, wargs, &reqWG, wag, dur)
+					issueOpen(stepCtx, wargs, &workerWG, wag, dur)
 					wg.Done()
 				}(args, arrivalGen, ts.Duration)
 			}
 			wg.Wait()
+			if args.queue != nil {
+				// don't send queued requests after the step ends
+				reads, writes := args.queue.close()
+				if reads > 0 {
+					readC <- resCount(tsIndex, "", "dropped", reads)
+				}
+				if writes > 0 {
+					writeC <- resCount(tsIndex, "", "dropped", writes)
+				}
+			}
+			if jobs != nil {
+				close(jobs)
+			}
 		}
 		end := time.Now()
 		readC <- resEnd(tsIndex, end)
 		writeC <- resEnd(tsIndex, end)
+		if staleC != nil {
+			staleC <- resEnd(tsIndex, end)
+		}
+		if issueC != nil {
+			issueC <- resEnd(tsIndex, end)
+		}
+		if queueC != nil {
+			queueC <- resEnd(tsIndex, end)
+		}
 	}
 
+	if runErr == nil {
+		// let requests still in flight, and pool jobs not yet sent,
+		// finish rather than fail them by cancelling,
+		// so that the last step is recorded like the others
+		workerWG.Wait()
+	}
 	cancelCtx()
+	workerWG.Wait()
 
 	readC <- resRunIsDone()
 	writeC <- resRunIsDone()
+	if staleC != nil {
+		staleC <- resRunIsDone()
+	}
+	if issueC != nil {
+		issueC <- resRunIsDone()
+	}
+	if queueC != nil {
+		queueC <- resRunIsDone()
+	}
 
 	msgLogger.Close()
 	runWG.Wait()
 
-	return nil
+	return runErr
 }
 
 type issueArgs struct {
@@ -441,37 +796,151 @@ type issueArgs struct {
 	readKeyGen  stringGen
 	writeKeyGen stringGen
 	valGen      *valueGen
+	verifier    *verifier // nil unless verifying
+	history     *history.Writer
 	rwRatio     float32
 	rand        *rand.Rand
 	tsStep      int
 
 	readC, writeC chan<- result
+
+	stale  *staleTracker // nil unless measuring staleness
+	staleC chan<- result
+
+	issue  *issueStats
+	issueC chan<- result // nil unless recording issue lag
+
+	// at most one of inflight and queue is set
+	inflight       chan struct{} // semaphore of requests in flight
+	inflightPolicy inflightPolicy
+	queue          *reqQueue
+	queueC         chan<- result // nil unless recording queueing time
+
+	jobs chan<- poolJob // pool to send open-loop requests to, if any
+
+	// shards, if set, are the worker's own recorder shards.
+	// Long-lived workers get them from newShards.
+	shards    *recShards
+	newShards func() *recShards
+
+	open *openShards // shards of the open-loop issuer that started the request
 }
 
-func issueOpen(ctx context.Context, args issueArgs, reqWG *sync.WaitGroup, arrivalGen intgen.Gen, execDuration time.Duration) {
+func issueOpen(ctx context.Context, args issueArgs, workerWG *sync.WaitGroup, arrivalGen intgen.Gen, execDuration time.Duration) {
 	shardedRand := syncrand.NewSharded(args.rand)
+	// lags and counts are recorded to the issuer's own shards,
+	// which are merged when it exits, so that issuing does not wait
+	// for the recording goroutines
+	own := args.newShards()
+	var reqWG sync.WaitGroup // requests sent from their own goroutines
+	if args.jobs == nil && args.queue == nil {
+		args.open = newOpenShards(args.newShards)
+	}
+	var nreads, nwrites [3]int64 // scheduled, issued, dropped
 	reqi := 0
 	start := time.Now()
+	end := start.Add(execDuration)
 	plannedStart := start
-	for time.Since(start) < execDuration {
+loop:
+	for {
 		reqi++
-		if reqi%128 == 0 {
-			select {
-			case <-ctx.Done():
-				break
-			default: // don't wait
-			}
+		if reqi%128 == 0 && ctx.Err() != nil {
+			break
 		}
 		nextIsRead := args.rand.Float32() < args.rwRatio
 		sleepDur := time.Duration(arrivalGen.Next(args.rand)) * time.Microsecond
 		plannedStart = plannedStart.Add(sleepDur)
+		if !plannedStart.Before(end) {
+			break
+		}
+		counts := &nwrites
+		if nextIsRead {
+			counts = &nreads
+		}
+		counts[0]++
+		atomic.AddInt64(&args.issue.scheduled, 1)
+		if !time.Now().Before(end) {
+			// too far behind to issue, but count the rest of the schedule
+			continue
+		}
 		time.Sleep(plannedStart.Sub(time.Now()))
-		reqWG.Add(1)
+		if args.inflight != nil {
+			if args.inflightPolicy == ipDrop {
+				select {
+				case args.inflight <- struct{}{}:
+				default:
+					counts[2]++
+					atomic.AddInt64(&args.issue.dropped, 1)
+					continue
+				}
+			} else {
+				select {
+				case args.inflight <- struct{}{}:
+				case <-ctx.Done():
+					break loop
+				}
+			}
+		}
+		now := time.Now()
+		lag := now.Sub(plannedStart)
+		if lag < 0 {
+			lag = 0
+		}
+		rng := shardedRand.Get(reqi)
+		if args.queue != nil && !args.queue.push(queuedReq{isRead: nextIsRead, rng: rng, enqueued: now}) {
+			counts[2]++
+			atomic.AddInt64(&args.issue.dropped, 1)
+			continue
+		}
+		counts[1]++
+		args.issue.issue(lag)
+		if args.jobs != nil {
+			args.jobs <- poolJob{isRead: nextIsRead, start: now, lag: lag}
+			continue
+		}
+		name := "write"
 		if nextIsRead {
-			go ReadReq(ctx, &args, shardedRand.Get(reqi), reqWG, time.Now())
-		} else {
-			go WriteReq(ctx, &args, shardedRand.Get(reqi), reqWG, time.Now())
+			name = "read"
 		}
+		own.s[rkIssue].Record(name, lag, nil)
+		if args.queue != nil {
+			continue
+		}
+		reqWG.Add(1)
+		go func() {
+			if nextIsRead {
+				ReadReq(ctx, &args, rng, &reqWG, now)
+			} else {
+				WriteReq(ctx, &args, rng, &reqWG, now)
+			}
+			if args.inflight != nil {
+				<-args.inflight
+			}
+		}()
+	}
+	for i, counter := range []string{"scheduled", "issued"} {
+		if nreads[i] > 0 {
+			own.s[rkIssue].AddCount("read", counter, nreads[i])
+		}
+		if nwrites[i] > 0 {
+			own.s[rkIssue].AddCount("write", counter, nwrites[i])
+		}
+	}
+	if nreads[2] > 0 {
+		own.s[rkRead].AddCount("", "dropped", nreads[2])
+	}
+	if nwrites[2] > 0 {
+		own.s[rkWrite].AddCount("", "dropped", nwrites[2])
+	}
+	own.flush(&args, time.Now())
+	if args.open != nil {
+		// requests may outlive the step, so flush once they finish
+		workerWG.Add(1)
+		go func() {
+			reqWG.Wait()
+			args.open.flush(&args)
+			workerWG.Done()
+		}()
 	}
 }
 
@@ -481,8 +950,10 @@ func issueClosed(ctx context.Context, args issueArgs, _ *sync.WaitGroup, workers
 	start := time.Now()
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func(rng *rand.Rand) {
+		go func(args issueArgs, rng *rand.Rand) {
 			defer wg.Done()
+			args.shards = args.newShards()
+			defer func() { args.shards.flush(&args, time.Now()) }()
 
 			for {
 				i := nops.getAndInc()
@@ -500,8 +971,9 @@ func issueClosed(ctx context.Context, args issueArgs, _ *sync.WaitGroup, workers
 				} else {
 					WriteReq(ctx, &args, rng, nil, start)
 				}
+				args.shards.maybeFlush(&args, time.Now())
 			}
-		}(rand.New(rand.NewSource(args.rand.Int63())))
+		}(args, rand.New(rand.NewSource(args.rand.Int63())))
 	}
 	wg.Wait()
 }
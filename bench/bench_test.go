@@ -1,17 +1,21 @@
 package bench
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/uluyol/fabbench/db"
 	_ "github.com/uluyol/fabbench/db/dummy"
+	"github.com/uluyol/fabbench/history"
 	"github.com/uluyol/fabbench/readers"
 	"github.com/uluyol/fabbench/recorders"
 	"github.com/uluyol/hdrhist"
@@ -156,6 +160,564 @@ func TestRunClosedOps(t *testing.T) {
 	}
 }
 
+func TestRunRecordsBytes(t *testing.T) {
+	t.Parallel()
+	conn, err := db.Dial("dummy", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to setup: %v", err)
+	}
+	defer conn.Close()
+	cfg := Config{
+		RecordCount: 1e3,
+		KeySize:     1 << 6,
+		ValSize:     1 << 6,
+	}
+	hcfg := hdrhist.Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e6,
+		SigFigs:           3,
+		AutoResize:        true,
+	}
+	trace := mustMakeTrace([]string{
+		"rkd=uniform wkd=uniform rw=0.5 d=1s ad=closed-10 qps=2000",
+		"vsd=const-100",
+		"vsd=uniform-10-20",
+	})
+	descs := make([]string, len(trace))
+	for i := range trace {
+		descs[i] = trace[i].String()
+	}
+
+	start := time.Now()
+	rw := recorders.NewMemoryMultiLogWriter(start)
+	ww := recorders.NewMemoryMultiLogWriter(start)
+	r := Runner{
+		DB:     conn,
+		Config: cfg,
+		Rand:   rand.New(rand.NewSource(883)),
+		Trace:  trace,
+
+		ReadRecorder:  recorders.NewMultiLatency(hcfg, descs),
+		WriteRecorder: recorders.NewMultiLatency(hcfg, descs),
+		ReadWriter:    rw,
+		WriteWriter:   ww,
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("unable to run: %v", err)
+	}
+
+	rr, err := readers.ReadLatency(rw.AllReader())
+	if err != nil {
+		t.Fatalf("unable to read written read latencies: %v", err)
+	}
+	wr, err := readers.ReadLatency(ww.AllReader())
+	if err != nil {
+		t.Fatalf("unable to read written write latencies: %v", err)
+	}
+
+	for step := range trace {
+		// dummy returns key + "-value"
+		want := rr.Hists[step].TotalCount() * int64(cfg.KeySize+len("-value"))
+		if rr.Bytes[step] != want {
+			t.Errorf("step %d: have %d bytes read, want %d", step, rr.Bytes[step], want)
+		}
+	}
+
+	nwrites := []int64{wr.Hists[0].TotalCount(), wr.Hists[1].TotalCount(), wr.Hists[2].TotalCount()}
+	if want := nwrites[0] * int64(cfg.ValSize); wr.Bytes[0] != want {
+		t.Errorf("step 0: have %d bytes written, want %d", wr.Bytes[0], want)
+	}
+	if want := nwrites[1] * 100; wr.Bytes[1] != want {
+		t.Errorf("step 1: have %d bytes written, want %d", wr.Bytes[1], want)
+	}
+	if wr.Bytes[2] < nwrites[2]*10 || wr.Bytes[2] > nwrites[2]*20 {
+		t.Errorf("step 2: have %d bytes written, want in [%d, %d]", wr.Bytes[2], nwrites[2]*10, nwrites[2]*20)
+	}
+}
+
+func TestRunIssueLag(t *testing.T) {
+	t.Parallel()
+	conn, err := db.Dial("dummy", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to setup: %v", err)
+	}
+	defer conn.Close()
+	cfg := Config{
+		RecordCount: 1e3,
+		KeySize:     1 << 6,
+		ValSize:     1 << 6,
+	}
+	hcfg := hdrhist.Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e6,
+		SigFigs:           3,
+		AutoResize:        true,
+	}
+	trace := mustMakeTrace([]string{
+		"rkd=uniform wkd=uniform rw=0.5 d=1s ad=poisson qps=500",
+		"ad=closed-10",
+	})
+	descs := make([]string, len(trace))
+	for i := range trace {
+		descs[i] = trace[i].String()
+	}
+
+	for _, engine := range []Engine{EngineGoroutine, EnginePool} {
+		t.Run(engine.String(), func(t *testing.T) {
+			start := time.Now()
+			rw := recorders.NewMemoryMultiLogWriter(start)
+			iw := recorders.NewMemoryMultiLogWriter(start)
+			r := Runner{
+				DB:     conn,
+				Config: cfg,
+				Rand:   rand.New(rand.NewSource(883)),
+				Trace:  trace,
+				Engine: engine,
+
+				ReadRecorder:  recorders.NewMultiLatency(hcfg, descs),
+				WriteRecorder: recorders.NewMultiLatency(hcfg, descs),
+				ReadWriter:    rw,
+				WriteWriter:   recorders.NewMemoryMultiLogWriter(start),
+				IssueRecorder: recorders.NewMultiLatency(hcfg, descs),
+				IssueWriter:   iw,
+			}
+			if err := r.Run(context.Background()); err != nil {
+				t.Fatalf("unable to run: %v", err)
+			}
+
+			rr, err := readers.ReadLatency(rw.AllReader())
+			if err != nil {
+				t.Fatalf("unable to read written read latencies: %v", err)
+			}
+			il, err := readers.ReadLatency(iw.AllReader())
+			if err != nil {
+				t.Fatalf("unable to read written issue lags: %v", err)
+			}
+			reads, err := readers.ReadLatency(iw.Reader("read"))
+			if err != nil {
+				t.Fatalf("unable to read written read issue lags: %v", err)
+			}
+
+			sched, issued := il.Counts["scheduled"], il.Counts["issued"]
+			if len(sched) != len(trace) || len(issued) != len(trace) {
+				t.Fatalf("missing counts: %v", il.Counts)
+			}
+			if issued[0] != il.Hists[0].TotalCount() {
+				t.Errorf("step 0: issued %d requests but recorded %d lags", issued[0], il.Hists[0].TotalCount())
+			}
+			if issued[0] > sched[0] || sched[0] < 400 || sched[0] > 600 {
+				t.Errorf("step 0: issued %d of %d scheduled, want about 500", issued[0], sched[0])
+			}
+			if got := reads.Counts["issued"][0]; got != rr.Hists[0].TotalCount()+int64(rr.Errs[0]) {
+				t.Errorf("step 0: issued %d reads but got %d results", got, rr.Hists[0].TotalCount()+int64(rr.Errs[0]))
+			}
+			if sched[1] != 0 || issued[1] != 0 || il.Hists[1].TotalCount() != 0 {
+				t.Errorf("step 1: closed-loop step has issue counts %d, %d", sched[1], issued[1])
+			}
+			if tgt := rr.Targets[0]; tgt == nil || *tgt != (readers.Target{QPS: 500, ReadRatio: 0.5}) {
+				t.Errorf("step 0: want target {500 0.5}, got %+v", tgt)
+			}
+			if tgt := rr.Targets[1]; tgt != nil {
+				t.Errorf("step 1: want no target for closed-loop step, got %+v", tgt)
+			}
+		})
+	}
+}
+
+type bufLogger struct{ msgs []string }
+
+func (l *bufLogger) Print(args ...interface{}) { l.msgs = append(l.msgs, fmt.Sprint(args...)) }
+
+func (l *bufLogger) Printf(format string, args ...interface{}) {
+	l.msgs = append(l.msgs, fmt.Sprintf(format, args...))
+}
+
+func TestIssueStatsLog(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		stats issueStats
+		want  []string
+	}{
+		{issueStats{scheduled: 100, issued: 100}, nil},
+		{issueStats{scheduled: 100, issued: 50, dropped: 50}, []string{"dropped"}},
+		{issueStats{scheduled: 100, issued: 50}, []string{"falling behind"}},
+		{issueStats{scheduled: 100, issued: 50, dropped: 10}, []string{"dropped", "falling behind"}},
+		{issueStats{scheduled: 100, issued: 90, dropped: 10, late: 20}, []string{"dropped", "falling behind"}},
+	}
+	for i, test := range tests {
+		var l bufLogger
+		test.stats.logAndReset(&l)
+		if len(l.msgs) != len(test.want) {
+			t.Errorf("case %d: got %q, want messages with %q", i, l.msgs, test.want)
+			continue
+		}
+		for j, w := range test.want {
+			if !strings.Contains(l.msgs[j], w) {
+				t.Errorf("case %d: message %d is %q, want %q", i, j, l.msgs[j], w)
+			}
+		}
+	}
+}
+
+// failingBarrier fails to start step failAt.
+type failingBarrier struct{ failAt int }
+
+func (b failingBarrier) WaitStep(ctx context.Context, step int) error {
+	if step == b.failAt {
+		return fmt.Errorf("lost coordinator")
+	}
+	return nil
+}
+
+func TestRunBarrierError(t *testing.T) {
+	conn, err := db.Dial("dummy", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to setup: %v", err)
+	}
+	defer conn.Close()
+	cfg := Config{
+		RecordCount: 1e3,
+		KeySize:     1 << 6,
+		ValSize:     1 << 6,
+	}
+	hcfg := hdrhist.Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e6,
+		SigFigs:           3,
+		AutoResize:        true,
+	}
+	trace := mustMakeTrace([]string{
+		"rkd=uniform wkd=uniform rw=0.5 d=200ms ad=poisson qps=500 maxinflight=queue-4",
+		"maxinflight=none",
+		"ad=closed-4",
+	})
+	descs := make([]string, len(trace))
+	for i := range trace {
+		descs[i] = trace[i].String()
+	}
+
+	before := runtime.NumGoroutine()
+	start := time.Now()
+	rw := recorders.NewMemoryMultiLogWriter(start)
+	r := Runner{
+		DB:      conn,
+		Config:  cfg,
+		Rand:    rand.New(rand.NewSource(0)),
+		Trace:   trace,
+		Engine:  EnginePool,
+		Barrier: failingBarrier{failAt: 2},
+
+		ReadRecorder:  recorders.NewMultiLatency(hcfg, descs),
+		WriteRecorder: recorders.NewMultiLatency(hcfg, descs),
+		ReadWriter:    rw,
+		WriteWriter:   recorders.NewMemoryMultiLogWriter(start),
+		IssueRecorder: recorders.NewMultiLatency(hcfg, descs),
+		IssueWriter:   recorders.NewMemoryMultiLogWriter(start),
+		QueueRecorder: recorders.NewMultiLatency(hcfg, descs),
+		QueueWriter:   recorders.NewMemoryMultiLogWriter(start),
+	}
+	if err := r.Run(context.Background()); err == nil {
+		t.Fatal("run succeeded, want barrier error")
+	}
+
+	rr, err := readers.ReadLatency(rw.AllReader())
+	if err != nil {
+		t.Fatalf("unable to read written read latencies: %v", err)
+	}
+	if len(rr.Hists) != len(trace) {
+		t.Fatalf("got logs for %d steps, want %d", len(rr.Hists), len(trace))
+	}
+	for i, h := range rr.Hists {
+		if n := h.TotalCount(); (n > 0) != (i < 2) {
+			t.Errorf("step %d: got %d reads, want reads only in the 2 completed steps", i, n)
+		}
+	}
+
+	// requests still in flight may take a moment to finish
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatalf("leaked %d goroutines", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunNoErrorsAtEnd(t *testing.T) {
+	t.Parallel()
+	cfg := Config{
+		RecordCount: 1e3,
+		KeySize:     1 << 6,
+		ValSize:     1 << 6,
+	}
+	hcfg := hdrhist.Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e6,
+		SigFigs:           3,
+		AutoResize:        true,
+	}
+	tests := []struct {
+		name   string
+		engine Engine
+		trace  []string
+	}{
+		{"goroutine", EngineGoroutine, []string{"rkd=uniform wkd=uniform rw=0.5 d=500ms ad=poisson qps=500", "d=500ms"}},
+		{"pool", EnginePool, []string{"rkd=uniform wkd=uniform rw=0.5 d=500ms ad=poisson qps=500", "d=500ms"}},
+		{"queue", EngineGoroutine, []string{"rkd=uniform wkd=uniform rw=0.5 d=500ms ad=poisson qps=500 maxinflight=queue-100", "d=500ms"}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			// requests take long enough to be in flight when the run ends
+			conn, err := db.Dial("dummy", nil, []byte(`{"servers": 1000, "service": "const-100ms"}`))
+			if err != nil {
+				t.Fatalf("failed to setup: %v", err)
+			}
+			defer conn.Close()
+			trace := mustMakeTrace(test.trace)
+			descs := make([]string, len(trace))
+			for i := range trace {
+				descs[i] = trace[i].String()
+			}
+
+			start := time.Now()
+			rw := recorders.NewMemoryMultiLogWriter(start)
+			ww := recorders.NewMemoryMultiLogWriter(start)
+			r := Runner{
+				DB:     conn,
+				Config: cfg,
+				Rand:   rand.New(rand.NewSource(883)),
+				Trace:  trace,
+				Engine: test.engine,
+
+				ReadRecorder:  recorders.NewMultiLatency(hcfg, descs),
+				WriteRecorder: recorders.NewMultiLatency(hcfg, descs),
+				ReadWriter:    rw,
+				WriteWriter:   ww,
+			}
+			if err := r.Run(context.Background()); err != nil {
+				t.Fatalf("unable to run: %v", err)
+			}
+
+			for _, w := range []*recorders.MemoryMultiLogWriter{rw, ww} {
+				l, err := readers.ReadLatency(w.AllReader())
+				if err != nil {
+					t.Fatalf("unable to read written latencies: %v", err)
+				}
+				for step := range l.Errs {
+					if n := l.Hists[step].TotalCount(); n == 0 || l.Errs[step] != 0 {
+						t.Errorf("step %d: got %d errors in %d requests, want none", step, l.Errs[step], n)
+					}
+				}
+			}
+		})
+	}
+}
+
+// slowDB takes delay to serve each request
+// and tracks the most requests it had in flight.
+type slowDB struct {
+	delay    time.Duration
+	inflight int64
+	max      int64
+}
+
+func (d *slowDB) do(ctx context.Context) {
+	n := atomic.AddInt64(&d.inflight, 1)
+	for {
+		max := atomic.LoadInt64(&d.max)
+		if n <= max || atomic.CompareAndSwapInt64(&d.max, max, n) {
+			break
+		}
+	}
+	select {
+	case <-time.After(d.delay):
+	case <-ctx.Done():
+	}
+	atomic.AddInt64(&d.inflight, -1)
+}
+
+func (d *slowDB) Init(ctx context.Context) error { return nil }
+func (d *slowDB) Close() error                   { return nil }
+
+func (d *slowDB) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	d.do(ctx)
+	return key, db.EmptyMeta(), nil
+}
+
+func (d *slowDB) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	d.do(ctx)
+	return db.EmptyMeta(), nil
+}
+
+func TestRunMaxInFlight(t *testing.T) {
+	t.Parallel()
+	cfg := Config{
+		RecordCount: 1e3,
+		KeySize:     1 << 6,
+		ValSize:     1 << 6,
+	}
+	hcfg := hdrhist.Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e6,
+		SigFigs:           3,
+		AutoResize:        true,
+	}
+
+	// at 1000 qps, 50ms requests would have about 50 in flight
+	for _, policy := range []string{"drop", "block", "queue"} {
+		policy := policy
+		t.Run(policy, func(t *testing.T) {
+			t.Parallel()
+			trace := mustMakeTrace([]string{
+				"rkd=uniform wkd=uniform rw=0.5 d=1s ad=poisson qps=1000 maxinflight=" + policy + "-5",
+			})
+			descs := []string{trace[0].String()}
+
+			start := time.Now()
+			rw := recorders.NewMemoryMultiLogWriter(start)
+			ww := recorders.NewMemoryMultiLogWriter(start)
+			iw := recorders.NewMemoryMultiLogWriter(start)
+			qw := recorders.NewMemoryMultiLogWriter(start)
+			sdb := &slowDB{delay: 50 * time.Millisecond}
+			r := Runner{
+				DB:     sdb,
+				Config: cfg,
+				Rand:   rand.New(rand.NewSource(883)),
+				Trace:  trace,
+
+				ReadRecorder:  recorders.NewMultiLatency(hcfg, descs),
+				WriteRecorder: recorders.NewMultiLatency(hcfg, descs),
+				ReadWriter:    rw,
+				WriteWriter:   ww,
+				IssueRecorder: recorders.NewMultiLatency(hcfg, descs),
+				IssueWriter:   iw,
+				QueueRecorder: recorders.NewMultiLatency(hcfg, descs),
+				QueueWriter:   qw,
+			}
+			if err := r.Run(context.Background()); err != nil {
+				t.Fatalf("unable to run: %v", err)
+			}
+			if max := atomic.LoadInt64(&sdb.max); max > 5 {
+				t.Errorf("had %d requests in flight, want at most 5", max)
+			}
+
+			var dropped int64
+			for _, w := range []*recorders.MemoryMultiLogWriter{rw, ww} {
+				l, err := readers.ReadLatency(w.AllReader())
+				if err != nil {
+					t.Fatalf("unable to read written latencies: %v", err)
+				}
+				if c := l.Counts["dropped"]; c != nil {
+					dropped += c[0]
+				}
+			}
+			il, err := readers.ReadLatency(iw.AllReader())
+			if err != nil {
+				t.Fatalf("unable to read written issue lags: %v", err)
+			}
+			ql, err := readers.ReadLatency(qw.AllReader())
+			if err != nil {
+				t.Fatalf("unable to read written queueing times: %v", err)
+			}
+			sched, issued := il.Counts["scheduled"][0], il.Counts["issued"][0]
+			queued := ql.Hists[0].TotalCount()
+
+			switch policy {
+			case "drop":
+				if dropped == 0 || issued+dropped != sched {
+					t.Errorf("issued %d and dropped %d of %d scheduled", issued, dropped, sched)
+				}
+			case "block":
+				if dropped != 0 || issued > sched/2 {
+					t.Errorf("issued %d and dropped %d of %d scheduled, want few issued", issued, dropped, sched)
+				}
+			case "queue":
+				// requests still queued at the end are both issued and dropped
+				if dropped == 0 || issued+dropped < sched || issued+dropped > sched+5 {
+					t.Errorf("issued %d and dropped %d of %d scheduled", issued, dropped, sched)
+				}
+				if queued == 0 || ql.Hists[0].Max() < int64(50*time.Millisecond) {
+					t.Errorf("recorded %d queueing times up to %v, want long waits", queued, time.Duration(ql.Hists[0].Max()))
+				}
+			}
+			if policy != "queue" && queued != 0 {
+				t.Errorf("recorded %d queueing times without a queue", queued)
+			}
+		})
+	}
+}
+
+func TestReqQueueBounded(t *testing.T) {
+	t.Parallel()
+	q := newReqQueue(2)
+	for i, want := range []bool{true, true, false} {
+		if got := q.push(queuedReq{isRead: i == 0}); got != want {
+			t.Errorf("push %d: got %t, want %t", i, got, want)
+		}
+	}
+	if r, ok := q.pop(); !ok || !r.isRead {
+		t.Errorf("pop: got %+v, %t, want the first read", r, ok)
+	}
+	q.push(queuedReq{isRead: true})
+	if reads, writes := q.close(); reads != 1 || writes != 1 {
+		t.Errorf("close: discarded %d reads and %d writes, want 1 and 1", reads, writes)
+	}
+	if q.push(queuedReq{}) {
+		t.Error("push succeeded after close")
+	}
+	if r, ok := q.pop(); ok {
+		t.Errorf("pop after close: got %+v", r)
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	t.Parallel()
+	cfg := Config{
+		RecordCount: 20,
+		KeySize:     1 << 6,
+		ValSize:     1 << 6,
+	}
+	trace := mustMakeTrace([]string{"rkd=uniform wkd=uniform rw=0.5 d=1s ad=closed-8 qps=2000"})
+
+	var buf bytes.Buffer
+	hw := history.NewWriter(&buf, "test")
+	r := Runner{
+		DB:      new(mapDB),
+		Config:  cfg,
+		Rand:    rand.New(rand.NewSource(0)),
+		Trace:   trace,
+		History: hw,
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("unable to run: %v", err)
+	}
+	if err := hw.Flush(); err != nil {
+		t.Fatalf("unable to flush history: %v", err)
+	}
+
+	events, err := history.ReadEvents(&buf)
+	if err != nil {
+		t.Fatalf("unable to read history: %v", err)
+	}
+	if len(events) != 2*2000 {
+		t.Errorf("want %d events, got %d", 2*2000, len(events))
+	}
+	byKey, err := history.Pair(events)
+	if err != nil {
+		t.Fatalf("unable to pair history: %v", err)
+	}
+	for k, ops := range byKey {
+		v, err := history.CheckKey(ops, time.Time{})
+		if err != nil {
+			t.Fatalf("key %s: unable to check: %v", k, err)
+		}
+		if v != nil {
+			t.Errorf("key %s: got violation %+v", k, v)
+		}
+	}
+}
+
 type nopWriter struct{}
 
 func (w nopWriter) Write(b []byte) (int, error) {
@@ -254,6 +816,65 @@ func TestRunOpenQPSFlakey(t *testing.T) {
 	}
 }
 
+// BenchmarkRunEngine compares how many requests per second each engine
+// can issue against the dummy db when asked for far more than it can.
+func BenchmarkRunEngine(b *testing.B) {
+	conn, err := db.Dial("dummy", nil, nil)
+	if err != nil {
+		b.Fatalf("failed to setup: %v", err)
+	}
+	defer conn.Close()
+	cfg := Config{
+		RecordCount: 1e6,
+		KeySize:     1 << 6,
+		ValSize:     1 << 6,
+	}
+	hcfg := hdrhist.Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e6,
+		SigFigs:           3,
+		AutoResize:        true,
+	}
+	trace := mustMakeTrace([]string{"rkd=uniform wkd=uniform rw=0.5 d=1s ad=poisson qps=2000000"})
+	descs := []string{trace[0].String()}
+
+	for _, engine := range []Engine{EngineGoroutine, EnginePool} {
+		b.Run(engine.String(), func(b *testing.B) {
+			var reqs int64
+			var dur time.Duration
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				rw := recorders.NewMemoryMultiLogWriter(start)
+				ww := recorders.NewMemoryMultiLogWriter(start)
+				r := Runner{
+					DB:     conn,
+					Config: cfg,
+					Rand:   rand.New(rand.NewSource(883)),
+					Trace:  trace,
+					Engine: engine,
+
+					ReadRecorder:  recorders.NewMultiLatency(hcfg, descs),
+					WriteRecorder: recorders.NewMultiLatency(hcfg, descs),
+					ReadWriter:    rw,
+					WriteWriter:   ww,
+				}
+				if err := r.Run(context.Background()); err != nil {
+					b.Fatalf("unable to run: %v", err)
+				}
+				dur += time.Since(start)
+				for _, w := range []*recorders.MemoryMultiLogWriter{rw, ww} {
+					l, err := readers.ReadLatency(w.AllReader())
+					if err != nil {
+						b.Fatalf("unable to read written latencies: %v", err)
+					}
+					reqs += l.Hists[0].TotalCount()
+				}
+			}
+			b.ReportMetric(float64(reqs)/dur.Seconds(), "reqs/s")
+		})
+	}
+}
+
 type linesReader struct {
 	remaining []string
 	lf        bool
@@ -1,12 +1,18 @@
 package bench
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang/snappy"
 	"github.com/uluyol/fabbench/intgen"
 )
 
@@ -77,6 +83,264 @@ func TestUniformArrivalDist(t *testing.T) {
 	}
 }
 
+func TestKeyDistInRange(t *testing.T) {
+	t.Parallel()
+	dists := []string{"exponential-0.1", "exponential-5", "exponential-100", "normal-0.5-0.1", "normal-0-10", "normal-0.999-0"}
+	nitems := []int64{1, 7, 1000, 1 << 40}
+
+	for _, raw := range dists {
+		d, err := parseKeyDist(raw)
+		if err != nil {
+			t.Fatalf("%s: unable to parse: %v", raw, err)
+		}
+		for _, n := range nitems {
+			g := makeReqGen(d, n)
+			r := rand.New(rand.NewSource(0))
+			for i := 0; i < 10000; i++ {
+				if v := g.Next(r); v < 0 || v >= n {
+					t.Errorf("%s: n %d: got out of range %d", raw, n, v)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestKeyDistExtremeParams(t *testing.T) {
+	t.Parallel()
+	const n = 1000
+	tests := []struct {
+		dist    string
+		mean    float64
+		inSigma float64 // fraction of keys within one sigma of mu
+	}{
+		// nearly uniform
+		{dist: "exponential-1e-6", mean: n / 2},
+		{dist: "normal-0.5-1e12", mean: n / 2},
+		{dist: "normal-0-1e9", mean: n / 2},
+		// one sigma covers all of [0, 1)
+		{dist: "normal-0.999-10", mean: n / 2},
+		{dist: "exponential-5", mean: n * (1/5.0 - math.Exp(-5)/(1-math.Exp(-5)))},
+		{dist: "normal-0.5-0.1", mean: n / 2, inSigma: 0.6827},
+	}
+	for _, test := range tests {
+		d, err := parseKeyDist(test.dist)
+		if err != nil {
+			t.Fatalf("%s: unable to parse: %v", test.dist, err)
+		}
+		g := makeReqGen(d, n)
+		r := rand.New(rand.NewSource(0))
+		const samples = 100000
+		var sum float64
+		var inSigma int
+		start := time.Now()
+		for i := 0; i < samples; i++ {
+			v := g.Next(r)
+			sum += float64(v)
+			if v >= 400 && v < 600 {
+				inSigma++
+			}
+		}
+		if took := time.Since(start); took > time.Second {
+			t.Errorf("%s: took %v to draw %d keys", test.dist, took, samples)
+		}
+		if mean := sum / samples; math.Abs(mean-test.mean) > n/100 {
+			t.Errorf("%s: got mean %f, want %f", test.dist, mean, test.mean)
+		}
+		if frac := float64(inSigma) / samples; test.inSigma > 0 && math.Abs(frac-test.inSigma) > 0.01 {
+			t.Errorf("%s: got %f of keys within one sigma, want %f", test.dist, frac, test.inSigma)
+		}
+	}
+}
+
+func TestHistKeyDist(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "fabbench-hist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "keys.hist")
+	const data = `# lo hi weight
+0 0.1 6
+
+0.1,0.5,1
+0.5 1 3
+0.9 1 0
+`
+	if err := ioutil.WriteFile(p, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := parseKeyDist("hist=" + p)
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+	if d.String() != "hist="+p {
+		t.Errorf("bad String(): %s", d)
+	}
+
+	const nitems = 1000
+	const nsamples = 100000
+	g := makeReqGen(d, nitems)
+	r := rand.New(rand.NewSource(0))
+	var counts [3]int
+	for i := 0; i < nsamples; i++ {
+		v := g.Next(r)
+		switch {
+		case v < 0 || v >= nitems:
+			t.Fatalf("got out of range %d", v)
+		case v < 100:
+			counts[0]++
+		case v < 500:
+			counts[1]++
+		default:
+			counts[2]++
+		}
+	}
+
+	want := []float64{0.6, 0.1, 0.3}
+	for i := range want {
+		have := float64(counts[i]) / nsamples
+		if math.Abs(have-want[i]) > 0.01 {
+			t.Errorf("bucket %d: have frac %f, want %f", i, have, want[i])
+		}
+	}
+}
+
+func TestHistKeyDistAbsolute(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "fabbench-hist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "keys.hist")
+	const data = `0 10 1
+90 100 1
+`
+	if err := ioutil.WriteFile(p, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := parseKeyDist("hist=" + p)
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+	if err := d.checkKeys(99); err == nil {
+		t.Errorf("want error for bounds past 99 records")
+	}
+	if err := d.checkKeys(1000); err != nil {
+		t.Fatalf("unexpected error for 1000 records: %v", err)
+	}
+
+	g := makeReqGen(d, 1000)
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < 10000; i++ {
+		if v := g.Next(r); !(0 <= v && v < 10) && !(90 <= v && v < 100) {
+			t.Fatalf("got key %d outside of buckets", v)
+		}
+	}
+}
+
+func TestValueGenSizes(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		dist     string
+		min, max int
+	}{
+		{"const-0", 0, 0},
+		{"const-1024", 1024, 1024},
+		{"uniform-100-4000", 100, 4000},
+		{"uniform-7-7", 7, 7},
+		{"zipfian-1-100", 1, 100},
+		{"zipfian", 1, 8},
+	}
+
+	base := newValueGen(constGen(8), valContent{})
+	for _, test := range tests {
+		d, err := parseValSizeDist(test.dist)
+		if err != nil {
+			t.Fatalf("%s: unable to parse: %v", test.dist, err)
+		}
+		g := base.withSizes(makeValSizeGen(d, 8))
+		r := rand.New(rand.NewSource(0))
+		seenMin, seenMax := math.MaxInt32, -1
+		for i := 0; i < 10000; i++ {
+			n := len(g.Next(r))
+			if n < seenMin {
+				seenMin = n
+			}
+			if n > seenMax {
+				seenMax = n
+			}
+		}
+		if seenMin < test.min || seenMax > test.max {
+			t.Errorf("%s: got sizes in [%d, %d], want [%d, %d]", test.dist, seenMin, seenMax, test.min, test.max)
+		}
+		if test.max-test.min > 10 && seenMax-seenMin < (test.max-test.min)/2 {
+			t.Errorf("%s: sizes are not spread out: got [%d, %d]", test.dist, seenMin, seenMax)
+		}
+	}
+}
+
+func TestValueGenCompressionRatio(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		content  string
+		min, max float64
+	}{
+		{"random", 0.95, 1.05},
+		{"compressible-1", 0.95, 1.05},
+		// snappy has some per-copy overhead and skips bytes
+		// when searching for matches, so ratios are approximate
+		{"compressible-2", 1.5, 2.1},
+		{"compressible-4.5", 3.4, 4.7},
+	}
+
+	for _, test := range tests {
+		c, err := parseValContent(test.content)
+		if err != nil {
+			t.Fatalf("%s: unable to parse: %v", test.content, err)
+		}
+		g := newValueGen(constGen(4096), c)
+		r := rand.New(rand.NewSource(0))
+		var raw, compressed int
+		for i := 0; i < 100; i++ {
+			v := g.Next(r)
+			raw += len(v)
+			compressed += len(snappy.Encode(nil, []byte(v)))
+		}
+		ratio := float64(raw) / float64(compressed)
+		if ratio < test.min || test.max < ratio {
+			t.Errorf("%s: got ratio %f, want in [%f, %f]", test.content, ratio, test.min, test.max)
+		}
+	}
+}
+
+func TestValueGenJSON(t *testing.T) {
+	t.Parallel()
+	g := newValueGen(constGen(10000), valContent{Kind: vcJSON})
+	r := rand.New(rand.NewSource(0))
+	v := g.Next(r)
+	if len(v) != 10000 {
+		t.Fatalf("got len %d, want 10000", len(v))
+	}
+	lines := strings.Split(v, "\n")
+	// last line is truncated
+	for i, l := range lines[:len(lines)-1] {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(l), &rec); err != nil {
+			t.Errorf("line %d: invalid json: %v: %s", i, err, l)
+		}
+	}
+	if len(lines) < 10 {
+		t.Errorf("got too few records: %d", len(lines))
+	}
+}
+
 var sink int64
 
 func BenchmarkPoisson(b *testing.B) {
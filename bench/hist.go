@@ -0,0 +1,123 @@
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/uluyol/fabbench/intgen"
+)
+
+// histBucket is a range [lo, hi) in an empirical distribution
+// that is drawn from with probability proportional to weight.
+type histBucket struct {
+	lo, hi float64
+	weight float64
+}
+
+// empiricalDist is a distribution loaded from a histogram file.
+type empiricalDist struct {
+	path    string
+	buckets []histBucket
+}
+
+func isHistSep(c rune) bool { return c == ',' || unicode.IsSpace(c) }
+
+// loadHist reads a histogram file.
+//
+// Each non-empty line that does not start with # holds a bucket
+// as LO HI WEIGHT, separated by whitespace or commas.
+func loadHist(path string) (*empiricalDist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := &empiricalDist{path: path}
+	s := bufio.NewScanner(f)
+	lineno := 0
+	var sum float64
+	for s.Scan() {
+		lineno++
+		t := strings.TrimSpace(s.Text())
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(t, isHistSep)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: want 3 fields, have %d", path, lineno, len(fields))
+		}
+		var vals [3]float64
+		for i, f := range fields {
+			vals[i], err = strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineno, err)
+			}
+		}
+		b := histBucket{lo: vals[0], hi: vals[1], weight: vals[2]}
+		if b.lo < 0 || b.hi <= b.lo {
+			return nil, fmt.Errorf("%s:%d: need 0 <= lo < hi", path, lineno)
+		}
+		if b.weight < 0 {
+			return nil, fmt.Errorf("%s:%d: weight must be non-negative", path, lineno)
+		}
+		sum += b.weight
+		d.buckets = append(d.buckets, b)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if sum <= 0 {
+		return nil, fmt.Errorf("%s: no buckets with positive weight", path)
+	}
+	return d, nil
+}
+
+func (d *empiricalDist) maxHi() float64 {
+	var m float64
+	for _, b := range d.buckets {
+		if b.hi > m {
+			m = b.hi
+		}
+	}
+	return m
+}
+
+// histGen draws a bucket using an alias table
+// and then a uniform value within that bucket.
+// It is safe for concurrent use.
+type histGen struct {
+	buckets *intgen.Alias
+	lo      []int64
+	siz     []int64
+}
+
+// newHistGen creates a generator for d
+// after multiplying all bucket bounds by scale.
+func newHistGen(d *empiricalDist, scale float64) histGen {
+	weights := make([]float64, len(d.buckets))
+	g := histGen{
+		lo:  make([]int64, len(d.buckets)),
+		siz: make([]int64, len(d.buckets)),
+	}
+	for i, b := range d.buckets {
+		weights[i] = b.weight
+		g.lo[i] = int64(b.lo * scale)
+		g.siz[i] = int64(b.hi*scale) - g.lo[i]
+		if g.siz[i] < 1 {
+			g.siz[i] = 1
+		}
+	}
+	g.buckets = intgen.NewAlias(weights)
+	return g
+}
+
+func (g histGen) Next(rng *rand.Rand) int64 {
+	i := g.buckets.Next(rng)
+	return g.lo[i] + rng.Int63n(g.siz[i])
+}
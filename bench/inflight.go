@@ -0,0 +1,158 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type inflightPolicy uint8
+
+const (
+	ipDrop inflightPolicy = iota + 1
+	ipBlock
+	ipQueue
+)
+
+var inflightPolicyNames = map[inflightPolicy]string{
+	ipDrop:  "drop",
+	ipBlock: "block",
+	ipQueue: "queue",
+}
+
+// inflightLimit caps the number of outstanding requests in an open-loop step.
+// The zero value means no limit.
+type inflightLimit struct {
+	Policy inflightPolicy
+	Max    int
+}
+
+func (l inflightLimit) String() string {
+	if l.Policy == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%s-%d", inflightPolicyNames[l.Policy], l.Max)
+}
+
+func parseInflightLimit(raw string) (inflightLimit, error) {
+	lower := strings.ToLower(raw)
+	if lower == "none" {
+		return inflightLimit{}, nil
+	}
+	for p, name := range inflightPolicyNames {
+		if !strings.HasPrefix(lower, name+"-") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(lower, name+"-"))
+		if err != nil || n < 1 {
+			return inflightLimit{}, fmt.Errorf("bad limit for %s: must be a positive integer", name)
+		}
+		return inflightLimit{Policy: p, Max: n}, nil
+	}
+	return inflightLimit{}, fmt.Errorf("unknown in-flight policy: %s", raw)
+}
+
+// QueuesRequests reports whether requests in the step may wait in a queue
+// for other requests to complete before being sent.
+func (t *TraceStep) QueuesRequests() bool {
+	return t.MaxInFlight.Policy == ipQueue
+}
+
+type queuedReq struct {
+	isRead   bool
+	rng      *rand.Rand
+	enqueued time.Time
+}
+
+// reqQueue is a bounded FIFO of requests waiting to be sent
+// by a fixed number of workers.
+type reqQueue struct {
+	mu     sync.Mutex
+	cond   sync.Cond
+	reqs   []queuedReq
+	max    int
+	closed bool
+}
+
+func newReqQueue(max int) *reqQueue {
+	q := &reqQueue{max: max}
+	q.cond.L = &q.mu
+	return q
+}
+
+// push adds r to the queue.
+// It returns false if the queue is full or closed.
+func (q *reqQueue) push(r queuedReq) bool {
+	q.mu.Lock()
+	if q.closed || len(q.reqs) >= q.max {
+		q.mu.Unlock()
+		return false
+	}
+	q.reqs = append(q.reqs, r)
+	q.mu.Unlock()
+	q.cond.Signal()
+	return true
+}
+
+// pop returns the next request, blocking until there is one.
+// ok is false once the queue is closed.
+func (q *reqQueue) pop() (r queuedReq, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.reqs) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.reqs) == 0 {
+		return r, false
+	}
+	r = q.reqs[0]
+	q.reqs[0] = queuedReq{}
+	q.reqs = q.reqs[1:]
+	return r, true
+}
+
+// close stops workers once they finish their current requests
+// and returns how many reads and writes were left unsent in the queue.
+func (q *reqQueue) close() (reads, writes int64) {
+	q.mu.Lock()
+	q.closed = true
+	for _, r := range q.reqs {
+		if r.isRead {
+			reads++
+		} else {
+			writes++
+		}
+	}
+	q.reqs = nil
+	q.mu.Unlock()
+	q.cond.Broadcast()
+	return reads, writes
+}
+
+// work sends queued requests until the queue is closed,
+// recording how long each waited.
+func (q *reqQueue) work(ctx context.Context, args issueArgs, wg *sync.WaitGroup) {
+	defer wg.Done()
+	args.shards = args.newShards()
+	for {
+		r, ok := q.pop()
+		if !ok || ctx.Err() != nil {
+			break
+		}
+		now := time.Now()
+		name := "write"
+		if r.isRead {
+			name = "read"
+			ReadReq(ctx, &args, r.rng, nil, now)
+		} else {
+			WriteReq(ctx, &args, r.rng, nil, now)
+		}
+		args.report(rkQueue, resDoneReq(args.tsStep, name, now.Sub(r.enqueued), 0, nil))
+		args.shards.maybeFlush(&args, time.Now())
+	}
+	args.shards.flush(&args, time.Now())
+}
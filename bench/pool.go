@@ -0,0 +1,72 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An Engine determines how a Runner issues requests.
+type Engine int
+
+const (
+	// EngineGoroutine starts a goroutine for every open-loop request
+	// and sends each result to the recorders individually.
+	EngineGoroutine Engine = iota
+
+	// EnginePool sends open-loop requests from a fixed pool of workers,
+	// each with its own unlocked random source and recorder shards.
+	EnginePool
+)
+
+var engineNames = map[Engine]string{
+	EngineGoroutine: "goroutine",
+	EnginePool:      "pool",
+}
+
+func (e Engine) String() string { return engineNames[e] }
+
+func ParseEngine(s string) (Engine, error) {
+	for e, name := range engineNames {
+		if strings.ToLower(s) == name {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown engine: %s", s)
+}
+
+// DefaultPoolWorkers is the number of workers used by EnginePool
+// if Runner.PoolWorkers is not set.
+const DefaultPoolWorkers = 1024
+
+type poolJob struct {
+	isRead bool
+	start  time.Time
+	lag    time.Duration
+}
+
+// poolWork sends the requests in jobs until it is closed.
+func poolWork(ctx context.Context, args issueArgs, rng *rand.Rand, jobs <-chan poolJob, wg *sync.WaitGroup) {
+	defer wg.Done()
+	args.shards = args.newShards()
+	for job := range jobs {
+		name := "write"
+		if job.isRead {
+			name = "read"
+		}
+		args.report(rkIssue, resDoneReq(args.tsStep, name, job.lag, 0, nil))
+		if job.isRead {
+			ReadReq(ctx, &args, rng, nil, job.start)
+		} else {
+			WriteReq(ctx, &args, rng, nil, job.start)
+		}
+		if args.inflight != nil {
+			<-args.inflight
+		}
+		args.shards.maybeFlush(&args, time.Now())
+	}
+	args.shards.flush(&args, time.Now())
+}
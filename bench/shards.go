@@ -0,0 +1,148 @@
+package bench
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/uluyol/fabbench/recorders"
+)
+
+// shardFlushInterval is how often workers merge their shards
+// into the recorders.
+const shardFlushInterval = time.Second
+
+type resKind int
+
+const (
+	rkRead resKind = iota
+	rkWrite
+	rkStale
+	rkIssue
+	rkQueue
+	numResKinds
+)
+
+// recShards are the recorder shards of one worker.
+// Long-lived workers record to their own shards instead of sending
+// every result to the recording goroutines, and periodically send
+// the shards to be merged.
+type recShards struct {
+	s         [numResKinds]*recorders.Shard
+	lastFlush time.Time
+}
+
+func (r *Runner) newShards(step int) *recShards {
+	return &recShards{
+		s: [numResKinds]*recorders.Shard{
+			rkRead:  r.ReadRecorder.Shard(step),
+			rkWrite: r.WriteRecorder.Shard(step),
+			rkStale: r.StaleRecorder.Shard(step),
+			rkIssue: r.IssueRecorder.Shard(step),
+			rkQueue: r.QueueRecorder.Shard(step),
+		},
+		lastFlush: time.Now(),
+	}
+}
+
+func (s *recShards) record(k resKind, res *result) {
+	sh := s.s[k]
+	sh.Record(res.name, res.latency, res.err)
+	if res.err == nil {
+		sh.AddBytes(res.name, res.nbytes)
+	}
+	if res.counter != "" {
+		sh.AddCount(res.name, res.counter, 1)
+	}
+}
+
+// maybeFlush flushes s if it has not been flushed for shardFlushInterval.
+func (s *recShards) maybeFlush(args *issueArgs, now time.Time) {
+	if now.Sub(s.lastFlush) >= shardFlushInterval {
+		s.flush(args, now)
+	}
+}
+
+// flush sends everything recorded so far to be merged into the recorders.
+func (s *recShards) flush(args *issueArgs, now time.Time) {
+	for k, sh := range s.s {
+		if sh != nil {
+			args.chanFor(resKind(k)) <- resShard(sh.Take())
+		}
+	}
+	s.lastFlush = now
+}
+
+// openShardSlots is the number of shards an open-loop issuer's
+// requests record to.
+const openShardSlots = 4
+
+// openShards are the recorder shards of an open-loop issuer, shared by
+// the goroutines it starts for requests. Each goroutine records to the
+// first shard it can claim without waiting, and only sends its result
+// to the recording goroutine if all are busy.
+type openShards struct {
+	next  uint32
+	slots [openShardSlots]struct {
+		busy int32
+		s    *recShards
+	}
+}
+
+func newOpenShards(newShards func() *recShards) *openShards {
+	o := new(openShards)
+	for i := range o.slots {
+		o.slots[i].s = newShards()
+	}
+	return o
+}
+
+func (o *openShards) report(args *issueArgs, k resKind, res *result) {
+	first := atomic.AddUint32(&o.next, 1)
+	for i := uint32(0); i < openShardSlots; i++ {
+		sl := &o.slots[(first+i)%openShardSlots]
+		if atomic.CompareAndSwapInt32(&sl.busy, 0, 1) {
+			sl.s.record(k, res)
+			sl.s.maybeFlush(args, time.Now())
+			atomic.StoreInt32(&sl.busy, 0)
+			return
+		}
+	}
+	args.chanFor(k) <- *res
+}
+
+// flush flushes all shards. No requests may be recording.
+func (o *openShards) flush(args *issueArgs) {
+	now := time.Now()
+	for i := range o.slots {
+		o.slots[i].s.flush(args, now)
+	}
+}
+
+func (a *issueArgs) chanFor(k resKind) chan<- result {
+	switch k {
+	case rkRead:
+		return a.readC
+	case rkWrite:
+		return a.writeC
+	case rkStale:
+		return a.staleC
+	case rkIssue:
+		return a.issueC
+	case rkQueue:
+		return a.queueC
+	}
+	panic("invalid result kind")
+}
+
+// report records r to the worker's or issuer's shards if it has them,
+// and otherwise sends it to the recording goroutine.
+func (a *issueArgs) report(k resKind, r result) {
+	switch {
+	case a.shards != nil:
+		a.shards.record(k, &r)
+	case a.open != nil:
+		a.open.report(a, k, &r)
+	default:
+		a.chanFor(k) <- r
+	}
+}
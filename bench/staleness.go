@@ -0,0 +1,157 @@
+package bench
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/uluyol/fabbench/internal/fnv"
+)
+
+/*
+
+staleTracker measures how stale reads are for a sampled subset of keys.
+
+For each sampled key, we remember the most recent writes along with
+when they were issued and acknowledged. When a read of a sampled key
+returns, we look for the write that produced the value:
+
+- If it is the latest write acknowledged before the read started,
+  or a write that was not yet acknowledged when the read started,
+  the read is fresh.
+- Otherwise, the value had been overwritten. The read is stale by the time
+  between the earliest acknowledgement of an overwriting write
+  and the start of the read.
+
+Values that are not found are assumed to predate the oldest tracked write.
+
+*/
+
+const (
+	numStaleShards    = 64
+	staleWritesPerKey = 32
+)
+
+type trackedWrite struct {
+	val   uint64
+	acked time.Time // zero if not acknowledged
+}
+
+type keyWrites struct {
+	writes [staleWritesPerKey]trackedWrite
+	next   int // index of the next write
+	n      int // number of writes, at most staleWritesPerKey
+}
+
+// at returns the i-th oldest tracked write.
+func (k *keyWrites) at(i int) *trackedWrite {
+	start := k.next - k.n
+	if start < 0 {
+		start += staleWritesPerKey
+	}
+	return &k.writes[(start+i)%staleWritesPerKey]
+}
+
+// A staleTracker is safe for concurrent use.
+type staleTracker struct {
+	sampleMod uint64
+	shards    [numStaleShards]struct {
+		mu   sync.Mutex
+		keys map[string]*keyWrites
+	}
+}
+
+// newStaleTracker creates a tracker that samples
+// about sampleFrac of all keys.
+func newStaleTracker(sampleFrac float64) *staleTracker {
+	mod := uint64(math.Floor(1/sampleFrac + 0.5))
+	if mod < 1 {
+		mod = 1
+	}
+	t := &staleTracker{sampleMod: mod}
+	for i := range t.shards {
+		t.shards[i].keys = make(map[string]*keyWrites)
+	}
+	return t
+}
+
+func (t *staleTracker) sampled(key string) bool {
+	// use different bits than the shard
+	return (fnv.HashString(key)/numStaleShards)%t.sampleMod == 0
+}
+
+// A staleWrite identifies a tracked write so that it can be acknowledged.
+type staleWrite struct {
+	kw  *keyWrites
+	idx int
+	val uint64
+}
+
+// write records that val is about to be written to key.
+func (t *staleTracker) write(key, val string) staleWrite {
+	sh := &t.shards[fnv.HashString(key)%numStaleShards]
+	h := fnv.HashString(val)
+	sh.mu.Lock()
+	kw := sh.keys[key]
+	if kw == nil {
+		kw = new(keyWrites)
+		sh.keys[key] = kw
+	}
+	idx := kw.next
+	kw.writes[idx] = trackedWrite{val: h}
+	kw.next = (kw.next + 1) % staleWritesPerKey
+	if kw.n < staleWritesPerKey {
+		kw.n++
+	}
+	sh.mu.Unlock()
+	return staleWrite{kw: kw, idx: idx, val: h}
+}
+
+// ack records that the write w to key was acknowledged at time at.
+func (t *staleTracker) ack(key string, w staleWrite, at time.Time) {
+	sh := &t.shards[fnv.HashString(key)%numStaleShards]
+	sh.mu.Lock()
+	// the slot may have been reused by a later write
+	if tw := &w.kw.writes[w.idx]; tw.val == w.val && tw.acked.IsZero() {
+		tw.acked = at
+	}
+	sh.mu.Unlock()
+}
+
+// staleness returns how stale val is for a read of key that started at start.
+// Fresh reads have a staleness of 0.
+func (t *staleTracker) staleness(key, val string, start time.Time) time.Duration {
+	sh := &t.shards[fnv.HashString(key)%numStaleShards]
+	h := fnv.HashString(val)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	kw := sh.keys[key]
+	if kw == nil {
+		return 0
+	}
+
+	// find the newest matching write
+	found := -1
+	for i := kw.n - 1; i >= 0; i-- {
+		if kw.at(i).val == h {
+			found = i
+			break
+		}
+	}
+
+	// find the earliest ack of a later write before the read started
+	var first time.Time
+	for i := found + 1; i < kw.n; i++ {
+		acked := kw.at(i).acked
+		if acked.IsZero() || !acked.Before(start) {
+			continue
+		}
+		if first.IsZero() || acked.Before(first) {
+			first = acked
+		}
+	}
+	if first.IsZero() {
+		return 0
+	}
+	return start.Sub(first)
+}
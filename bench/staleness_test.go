@@ -0,0 +1,129 @@
+package bench
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/readers"
+	"github.com/uluyol/fabbench/recorders"
+	"github.com/uluyol/hdrhist"
+)
+
+func TestStaleTracker(t *testing.T) {
+	t.Parallel()
+	st := newStaleTracker(1)
+	base := time.Unix(1000, 0)
+	at := func(sec int) time.Time { return base.Add(time.Duration(sec) * time.Second) }
+
+	const key = "k"
+	if d := st.staleness(key, "v0", at(0)); d != 0 {
+		t.Errorf("untracked key: got staleness %v", d)
+	}
+
+	w1 := st.write(key, "v1")
+	st.ack(key, w1, at(10))
+	w2 := st.write(key, "v2")
+	st.ack(key, w2, at(20))
+	st.write(key, "v3") // never acked
+
+	tests := []struct {
+		val   string
+		start int
+		want  time.Duration
+	}{
+		{"v2", 30, 0},
+		{"v3", 30, 0},
+		{"v1", 15, 0},
+		{"v1", 30, 10 * time.Second},
+		{"v0", 5, 0},
+		{"v0", 15, 5 * time.Second},
+		{"v0", 30, 20 * time.Second},
+	}
+
+	for _, test := range tests {
+		if d := st.staleness(key, test.val, at(test.start)); d != test.want {
+			t.Errorf("read %s at %d: got staleness %v, want %v", test.val, test.start, d, test.want)
+		}
+	}
+}
+
+// laggyDB only makes every other write to a key visible.
+type laggyDB struct {
+	mu sync.Mutex
+	m  map[string]string
+	n  map[string]int
+}
+
+func (d *laggyDB) Init(ctx context.Context) error { return nil }
+
+func (d *laggyDB) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.m[key], db.EmptyMeta(), nil
+}
+
+func (d *laggyDB) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n[key]++
+	if d.n[key]%2 == 1 {
+		d.m[key] = val
+	}
+	return db.EmptyMeta(), nil
+}
+
+func (d *laggyDB) Close() error { return nil }
+
+func runStale(t *testing.T, conn db.DB) *readers.Latency {
+	cfg := Config{
+		RecordCount: 10,
+		KeySize:     1 << 6,
+		ValSize:     1 << 6,
+	}
+	trace := mustMakeTrace([]string{"rkd=uniform wkd=uniform rw=0.5 d=1s ad=closed-1 qps=1000"})
+	descs := []string{trace[0].String()}
+	hcfg := hdrhist.Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e6,
+		SigFigs:           3,
+		AutoResize:        true,
+	}
+	sw := recorders.NewMemoryMultiLogWriter(time.Now())
+	r := Runner{
+		DB:              conn,
+		Config:          cfg,
+		Rand:            rand.New(rand.NewSource(0)),
+		Trace:           trace,
+		StaleSampleFrac: 1,
+		StaleRecorder:   recorders.NewMultiLatency(hcfg, descs),
+		StaleWriter:     sw,
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("unable to run: %v", err)
+	}
+	sr, err := readers.ReadLatency(sw.AllReader())
+	if err != nil {
+		t.Fatalf("unable to read staleness logs: %v", err)
+	}
+	return sr
+}
+
+func TestRunStaleness(t *testing.T) {
+	t.Parallel()
+	sr := runStale(t, new(mapDB))
+	if n := sr.Hists[0].TotalCount(); n < 400 || n > 600 {
+		t.Errorf("consistent db: got %d sampled reads, want about 500", n)
+	}
+	if c := sr.Counts["stale"]; len(c) != 0 {
+		t.Errorf("consistent db: got stale reads: %v", c)
+	}
+
+	sr = runStale(t, &laggyDB{m: make(map[string]string), n: make(map[string]int)})
+	if c := sr.Counts["stale"]; len(c) != 1 || c[0] == 0 {
+		t.Errorf("laggy db: want stale reads, got %v", c)
+	}
+}
@@ -1,8 +1,11 @@
 package bench
 
 import (
+	"errors"
+	"fmt"
 	"math/rand"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/uluyol/fabbench/internal/fnv"
@@ -55,30 +58,175 @@ func formatKeyName(v int64, keySize int) string {
 	return ret
 }
 
+type valContentKind uint8
+
+const (
+	vcRandom valContentKind = iota
+	vcCompressible
+	vcJSON
+)
+
+// valContent describes what values contain.
+// The zero value generates incompressible random values.
+type valContent struct {
+	Kind  valContentKind
+	Ratio float64 // only for vcCompressible
+}
+
+func (c valContent) String() string {
+	switch c.Kind {
+	case vcRandom:
+		return "random"
+	case vcCompressible:
+		return fmt.Sprintf("compressible-%f", c.Ratio)
+	case vcJSON:
+		return "json"
+	}
+	return fmt.Sprintf("unknown(%d)", c.Kind)
+}
+
+func parseValContent(raw string) (valContent, error) {
+	lower := strings.ToLower(raw)
+	switch {
+	case lower == "" || lower == "random":
+		return valContent{Kind: vcRandom}, nil
+	case lower == "json":
+		return valContent{Kind: vcJSON}, nil
+	case strings.HasPrefix(lower, "compressible"):
+		t := strings.TrimPrefix(lower, "compressible-")
+		r, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return valContent{}, fmt.Errorf("bad ratio for compressible: %v", err)
+		}
+		if r < 1 {
+			return valContent{}, errors.New("compressible ratio must be >= 1")
+		}
+		return valContent{Kind: vcCompressible, Ratio: r}, nil
+	}
+	return valContent{}, fmt.Errorf("unknown value content: %s", raw)
+}
+
 // valueGen generates values and is safe for concurrent use
+// so long as sizes is also safe for concurrent use
 type valueGen struct {
-	bufPool sync.Pool
+	bufPool *sync.Pool
+	sizes   intgen.Gen
+	content valContent
 }
 
-func newValueGen(size int) *valueGen {
+func newValueGen(sizes intgen.Gen, content valContent) *valueGen {
 	return &valueGen{
-		bufPool: sync.Pool{
-			New: func() interface{} { return make([]byte, size) },
+		bufPool: &sync.Pool{
+			New: func() interface{} { return []byte(nil) },
 		},
+		sizes:   sizes,
+		content: content,
 	}
 }
 
+// withSizes returns a valueGen that shares g's buffers
+// but generates values with lengths drawn from sizes.
+func (g *valueGen) withSizes(sizes intgen.Gen) *valueGen {
+	return &valueGen{bufPool: g.bufPool, sizes: sizes, content: g.content}
+}
+
 func (g *valueGen) Next(rng *rand.Rand) string {
+	size := int(g.sizes.Next(rng))
 	buf := g.bufPool.Get().([]byte)
-	sr := smallRand{}
-	for i := range buf {
-		buf[i] = randStringVals[sr.get(rng)]
+	if cap(buf) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	switch g.content.Kind {
+	case vcCompressible:
+		fillCompressible(buf, rng, g.content.Ratio)
+	case vcJSON:
+		buf = fillJSON(buf, rng)
+	default:
+		fillRandom(buf, rng)
 	}
 	s := string(buf)
 	g.bufPool.Put(buf)
 	return s
 }
 
+func fillRandom(buf []byte, rng *rand.Rand) {
+	sr := smallRand{}
+	for i := range buf {
+		buf[i] = randStringVals[sr.get(rng)]
+	}
+}
+
+// fillCompressible fills buf by repeating a random chunk
+// that is 1/ratio the size of buf.
+//
+// This is the same approach as LevelDB's db_bench and
+// is accurate for LZ-family compressors like Snappy and LZ4.
+func fillCompressible(buf []byte, rng *rand.Rand, ratio float64) {
+	chunk := int(float64(len(buf)) / ratio)
+	if chunk < 1 {
+		chunk = 1
+	}
+	if chunk > len(buf) {
+		chunk = len(buf)
+	}
+	fillRandom(buf[:chunk], rng)
+	for i := chunk; i < len(buf); i += chunk {
+		copy(buf[i:], buf[:chunk])
+	}
+}
+
+var jsonWords = []string{
+	"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel",
+	"india", "juliet", "kilo", "lima", "mike", "november", "oscar", "papa",
+	"quebec", "romeo", "sierra", "tango", "uniform", "victor", "whiskey", "xray",
+	"yankee", "zulu",
+}
+
+var (
+	jsonStatuses = []string{"active", "pending", "deleted"}
+	jsonRoles    = []string{"admin", "user", "guest"}
+)
+
+// fillJSON fills buf with a sequence of JSON records
+// that are truncated to fit in buf.
+// The returned slice shares buf's backing array.
+func fillJSON(buf []byte, rng *rand.Rand) []byte {
+	size := len(buf)
+	buf = buf[:0]
+	for len(buf) < size {
+		buf = append(buf, `{"id":`...)
+		buf = strconv.AppendInt(buf, rng.Int63n(1e9), 10)
+		buf = append(buf, `,"name":"`...)
+		buf = append(buf, jsonWords[rng.Intn(len(jsonWords))]...)
+		buf = append(buf, '_')
+		start := len(buf)
+		buf = append(buf, "00000000"...)
+		fillRandom(buf[start:], rng)
+		buf = append(buf, `","status":"`...)
+		buf = append(buf, jsonStatuses[rng.Intn(len(jsonStatuses))]...)
+		buf = append(buf, `","role":"`...)
+		buf = append(buf, jsonRoles[rng.Intn(len(jsonRoles))]...)
+		buf = append(buf, `","score":`...)
+		buf = strconv.AppendFloat(buf, float64(rng.Intn(10000))/100, 'f', 2, 64)
+		buf = append(buf, `,"verified":`...)
+		buf = strconv.AppendBool(buf, rng.Intn(2) == 0)
+		buf = append(buf, `,"tags":[`...)
+		for i, n := 0, 1+rng.Intn(4); i < n; i++ {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, '"')
+			buf = append(buf, jsonWords[rng.Intn(len(jsonWords))]...)
+			buf = append(buf, '"')
+		}
+		buf = append(buf, `],"created":`...)
+		buf = strconv.AppendInt(buf, 1500000000+rng.Int63n(1e8), 10)
+		buf = append(buf, "}\n"...)
+	}
+	return buf[:size]
+}
+
 type smallRand struct {
 	cur  int64
 	left int
@@ -9,6 +9,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/uluyol/fabbench/internal/ranges"
 )
 
 type arrivalDistKind uint8
@@ -93,6 +95,9 @@ const (
 	kdZipfian
 	kdLinear
 	kdLinStep
+	kdExponential
+	kdNormal
+	kdHist
 )
 
 func (d keyDist) String() string {
@@ -105,14 +110,23 @@ func (d keyDist) String() string {
 		return "linear"
 	case kdLinStep:
 		return fmt.Sprintf("linstep-%d", d.lsSteps())
+	case kdExponential:
+		return "exponential-" + formatFloat(d.expLambda())
+	case kdNormal:
+		mu, sigma := d.normParams()
+		return "normal-" + formatFloat(mu) + "-" + formatFloat(sigma)
+	case kdHist:
+		return "hist=" + d.hist.path
 	}
-	return fmt.Sprintf("unknown(%d)", d)
+	return fmt.Sprintf("unknown(%d)", d.Kind)
 }
 
 type keyDist struct {
 	Param1 uint64
+	Param2 uint64
 	Kind   keyDistKind
-	// have 7 more bytes for params before growing more
+
+	hist *empiricalDist // only for kdHist
 }
 
 func (d keyDist) zfTheta() float64 {
@@ -129,6 +143,47 @@ func (d keyDist) lsSteps() int64 {
 	return int64(d.Param1)
 }
 
+func (d keyDist) expLambda() float64 {
+	if d.Kind != kdExponential {
+		panic("check key dist kind: not exponential")
+	}
+	return math.Float64frombits(d.Param1)
+}
+
+func (d keyDist) normParams() (mu, sigma float64) {
+	if d.Kind != kdNormal {
+		panic("check key dist kind: not normal")
+	}
+	return math.Float64frombits(d.Param1), math.Float64frombits(d.Param2)
+}
+
+// histScale returns the factor that hist bucket bounds are multiplied by
+// to get key indices. If no bound is over 1, bounds are fractions of the
+// key space. Otherwise, they are key indices.
+func (d keyDist) histScale(nitems int64) float64 {
+	if d.Kind != kdHist {
+		panic("check key dist kind: not hist")
+	}
+	if d.hist.maxHi() <= 1 {
+		return float64(nitems)
+	}
+	return 1
+}
+
+// checkKeys returns an error if d can draw keys outside of [0, nitems).
+func (d keyDist) checkKeys(nitems int64) error {
+	if d.Kind == kdHist && d.hist.maxHi()*d.histScale(nitems) > float64(nitems) {
+		return fmt.Errorf("%s: bucket bounds go past the record count %d", d, nitems)
+	}
+	return nil
+}
+
+// formatFloat formats v so that parsing it gives back v.
+// It never uses an exponent, whose sign would clash with the - separator.
+func formatFloat(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+const histDistPrefix = "hist="
+
 func parseKeyDist(raw string) (keyDist, error) {
 	lower := strings.ToLower(raw)
 	switch {
@@ -153,6 +208,43 @@ func parseKeyDist(raw string) (keyDist, error) {
 			return keyDist{}, fmt.Errorf("bad step count for linstep: %v", err)
 		}
 		return keyDist{Kind: kdLinStep, Param1: steps}, nil
+	case strings.HasPrefix(lower, "exponential"):
+		t := strings.TrimPrefix(lower, "exponential-")
+		lambda, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return keyDist{}, fmt.Errorf("bad λ for exponential: %v", err)
+		}
+		if lambda <= 0 {
+			return keyDist{}, errors.New("exponential λ must be positive")
+		}
+		return keyDist{Kind: kdExponential, Param1: math.Float64bits(lambda)}, nil
+	case strings.HasPrefix(lower, "normal"):
+		t := strings.Split(strings.TrimPrefix(lower, "normal-"), "-")
+		if len(t) != 2 {
+			return keyDist{}, errors.New("normal needs μ and σ")
+		}
+		mu, err := strconv.ParseFloat(t[0], 64)
+		if err != nil {
+			return keyDist{}, fmt.Errorf("bad μ for normal: %v", err)
+		}
+		sigma, err := strconv.ParseFloat(t[1], 64)
+		if err != nil {
+			return keyDist{}, fmt.Errorf("bad σ for normal: %v", err)
+		}
+		if mu < 0 || mu >= 1 {
+			return keyDist{}, errors.New("normal μ must be in [0, 1)")
+		}
+		if sigma < 0 {
+			return keyDist{}, errors.New("normal σ must be non-negative")
+		}
+		return keyDist{Kind: kdNormal, Param1: math.Float64bits(mu), Param2: math.Float64bits(sigma)}, nil
+	case strings.HasPrefix(lower, histDistPrefix):
+		// don't lowercase the path
+		h, err := loadHist(raw[len(histDistPrefix):])
+		if err != nil {
+			return keyDist{}, fmt.Errorf("bad hist: %v", err)
+		}
+		return keyDist{Kind: kdHist, hist: h}, nil
 	}
 	return keyDist{}, fmt.Errorf("unknown key distribution: %s", raw)
 }
@@ -162,6 +254,8 @@ type TraceStep struct {
 	ReadKeyDist  keyDist
 	WriteKeyDist keyDist
 	ArrivalDist  arrivalDist
+	ValSizeDist  valSizeDist
+	MaxInFlight  inflightLimit
 	RWRatio      float32
 	AvgQPS       uint32
 }
@@ -173,11 +267,20 @@ const (
 	distKey      = "ad="
 	readDistKey  = "rkd="
 	writeDistKey = "wkd="
+	valSizeKey   = "vsd="
+	inflightKey  = "maxinflight="
 )
 
 func (t *TraceStep) String() string {
-	return fmt.Sprintf("d=%s rw=%f qps=%d ad=%s rkd=%s wkd=%s",
+	s := fmt.Sprintf("d=%s rw=%f qps=%d ad=%s rkd=%s wkd=%s",
 		t.Duration, t.RWRatio, t.AvgQPS, t.ArrivalDist, t.ReadKeyDist, t.WriteKeyDist)
+	if t.ValSizeDist.Kind != 0 {
+		s += " " + valSizeKey + t.ValSizeDist.String()
+	}
+	if t.MaxInFlight.Policy != 0 {
+		s += " " + inflightKey + t.MaxInFlight.String()
+	}
+	return s
 }
 
 func parseTraceStep(data string, step *TraceStep) error {
@@ -223,6 +326,18 @@ func parseTraceStep(data string, step *TraceStep) error {
 			if err != nil {
 				return fmt.Errorf("invalid write key distribution: %v", err)
 			}
+		case strings.HasPrefix(f, valSizeKey):
+			t := strings.TrimPrefix(f, valSizeKey)
+			step.ValSizeDist, err = parseValSizeDist(t)
+			if err != nil {
+				return fmt.Errorf("invalid value size distribution: %v", err)
+			}
+		case strings.HasPrefix(f, inflightKey):
+			t := strings.TrimPrefix(f, inflightKey)
+			step.MaxInFlight, err = parseInflightLimit(t)
+			if err != nil {
+				return fmt.Errorf("invalid max in-flight: %v", err)
+			}
 		default:
 			return fmt.Errorf("unknown key-value: %s", f)
 		}
@@ -263,3 +378,40 @@ func PrintTrace(w io.Writer, trace []TraceStep) (n int, err error) {
 	}
 	return n, nil
 }
+
+// ShardTrace returns the part of trace to be run by client clienti
+// of nclients clients running it together.
+// The QPS, closed-loop workers and in-flight limits of each step
+// are split among the clients so that their totals match the original trace,
+// except that every client may have at least one request in flight.
+func ShardTrace(trace []TraceStep, nclients, clienti int) []TraceStep {
+	if nclients < 1 || clienti < 0 || clienti >= nclients {
+		panic(fmt.Errorf("invalid client %d of %d", clienti, nclients))
+	}
+	shard := make([]TraceStep, len(trace))
+	for i, ts := range trace {
+		n := int64(nclients)
+		if ts.ArrivalDist.Kind == adClosed || ts.ArrivalDist.Kind == adClosedTime {
+			workers := int64(ts.ArrivalDist.clWorkers())
+			ts.ArrivalDist.Param1 = uint64(ranges.SplitRecords(workers, n)[clienti].Count)
+			// clients without workers issue no requests
+			if workers < n {
+				n = workers
+			}
+		}
+		if int64(clienti) < n {
+			ts.AvgQPS = uint32(ranges.SplitRecords(int64(ts.AvgQPS), n)[clienti].Count)
+		} else {
+			ts.AvgQPS = 0
+		}
+		if ts.MaxInFlight.Policy != 0 {
+			max := ranges.SplitRecords(int64(ts.MaxInFlight.Max), int64(nclients))[clienti].Count
+			if max < 1 {
+				max = 1
+			}
+			ts.MaxInFlight.Max = int(max)
+		}
+		shard[i] = ts
+	}
+	return shard
+}
@@ -35,6 +35,45 @@ d=10m0s rw=0.200000 qps=500 ad=closed-50 rkd=zipfian-0.999900 wkd=linear
 d=10m0s rw=0.200000 qps=500 ad=uniform-0.200000 rkd=zipfian-0.999900 wkd=zipfian-0.900000
 d=10m0s rw=0.200000 qps=500 ad=closedtime-10 rkd=zipfian-0.999900 wkd=zipfian-0.900000
 d=10m0s rw=0.200000 qps=200 ad=closedtime-10 rkd=linstep-5 wkd=zipfian-0.900000
+`,
+		}, {
+			in: `
+d=1m rw=0.9 qps=100 ad=poisson rkd=exponential-10 wkd=normal-0.5-0.1
+rkd=normal-0.25-0 wkd=exponential-0.5
+rkd=normal-0.123456789-0.00001 wkd=exponential-1e-7
+`,
+			out: `
+d=1m0s rw=0.900000 qps=100 ad=poisson rkd=exponential-10 wkd=normal-0.5-0.1
+d=1m0s rw=0.900000 qps=100 ad=poisson rkd=normal-0.25-0 wkd=exponential-0.5
+d=1m0s rw=0.900000 qps=100 ad=poisson rkd=normal-0.123456789-0.00001 wkd=exponential-0.0000001
+`,
+		}, {
+			in: `
+d=1m rw=0.9 qps=100 ad=poisson rkd=uniform wkd=uniform
+vsd=const-1024
+vsd=uniform-100-4000 qps=5
+vsd=Zipfian-1-10
+vsd=zipfian
+`,
+			out: `
+d=1m0s rw=0.900000 qps=100 ad=poisson rkd=uniform wkd=uniform
+d=1m0s rw=0.900000 qps=100 ad=poisson rkd=uniform wkd=uniform vsd=const-1024
+d=1m0s rw=0.900000 qps=5 ad=poisson rkd=uniform wkd=uniform vsd=uniform-100-4000
+d=1m0s rw=0.900000 qps=5 ad=poisson rkd=uniform wkd=uniform vsd=zipfian-1-10
+d=1m0s rw=0.900000 qps=5 ad=poisson rkd=uniform wkd=uniform vsd=zipfian
+`,
+		}, {
+			in: `
+d=1m rw=0.9 qps=100 ad=poisson rkd=uniform wkd=uniform maxinflight=drop-10
+maxinflight=Block-200
+maxinflight=queue-3
+maxinflight=none
+`,
+			out: `
+d=1m0s rw=0.900000 qps=100 ad=poisson rkd=uniform wkd=uniform maxinflight=drop-10
+d=1m0s rw=0.900000 qps=100 ad=poisson rkd=uniform wkd=uniform maxinflight=block-200
+d=1m0s rw=0.900000 qps=100 ad=poisson rkd=uniform wkd=uniform maxinflight=queue-3
+d=1m0s rw=0.900000 qps=100 ad=poisson rkd=uniform wkd=uniform
 `,
 		},
 	}
@@ -54,4 +93,86 @@ d=10m0s rw=0.200000 qps=200 ad=closedtime-10 rkd=linstep-5 wkd=zipfian-0.900000
 			t.Errorf("case %d:\nwant:\n%s\ngot:\n%s\n", i, strings.TrimPrefix(test.out, "\n"), buf.String())
 		}
 	}
-}
\ No newline at end of file
+}
+func TestParseValSizeDistErrors(t *testing.T) {
+	tests := []string{
+		"const",
+		"const--1",
+		"uniform-5",
+		"uniform-10-5",
+		"zipfian-a-10",
+		"zipfian-0-0",
+		"hist=/does/not/exist",
+		"normal-0.5-0.1",
+	}
+
+	for _, test := range tests {
+		if d, err := parseValSizeDist(test); err == nil {
+			t.Errorf("%s: want error, got %v", test, d)
+		}
+	}
+}
+
+func TestParseKeyDistErrors(t *testing.T) {
+	tests := []string{
+		"exponential",
+		"exponential-0",
+		"exponential--1",
+		"normal-0.5",
+		"normal-1-0.1",
+		"normal-0.5-x",
+		"hist=/does/not/exist",
+	}
+
+	for _, test := range tests {
+		if d, err := parseKeyDist(test); err == nil {
+			t.Errorf("%s: want error, got %v", test, d)
+		}
+	}
+}
+
+func TestShardTrace(t *testing.T) {
+	t.Parallel()
+	trace, err := ParseTrace(strings.NewReader(`
+d=1s rw=0.5 qps=1001 ad=poisson rkd=uniform wkd=uniform
+qps=10 ad=closed-3
+ad=closedtime-7
+qps=0 ad=poisson maxinflight=queue-9
+`))
+	if err != nil {
+		t.Fatalf("unable to parse trace: %v", err)
+	}
+
+	for _, nclients := range []int{1, 2, 4, 5} {
+		var qps [4]int64
+		var workers [4]int
+		inflight := 0
+		for i := 0; i < nclients; i++ {
+			shard := ShardTrace(trace, nclients, i)
+			inflight += shard[3].MaxInFlight.Max
+			for s := range shard {
+				qps[s] += int64(shard[s].AvgQPS)
+				ad := shard[s].ArrivalDist
+				if ad.Kind == adClosed || ad.Kind == adClosedTime {
+					workers[s] += ad.clWorkers()
+					if ad.clWorkers() == 0 && shard[s].AvgQPS != 0 {
+						t.Errorf("%d clients: client %d step %d: has qps but no workers", nclients, i, s)
+					}
+				}
+			}
+		}
+		if inflight != 9 {
+			t.Errorf("%d clients: want total max in-flight 9, got %d", nclients, inflight)
+		}
+		for s := range trace {
+			if qps[s] != int64(trace[s].AvgQPS) {
+				t.Errorf("%d clients: step %d: want total qps %d, got %d", nclients, s, trace[s].AvgQPS, qps[s])
+			}
+			if ad := trace[s].ArrivalDist; ad.Kind == adClosed || ad.Kind == adClosedTime {
+				if workers[s] != ad.clWorkers() {
+					t.Errorf("%d clients: step %d: want %d workers, got %d", nclients, s, ad.clWorkers(), workers[s])
+				}
+			}
+		}
+	}
+}
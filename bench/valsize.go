@@ -0,0 +1,148 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/uluyol/fabbench/intgen"
+)
+
+type valSizeDistKind uint8
+
+const (
+	vsConst valSizeDistKind = iota + 1
+	vsUniform
+	vsZipfian
+	vsHist
+)
+
+// valSizeDist describes the distribution of value sizes.
+// The zero value means that Config.ValSize should be used.
+type valSizeDist struct {
+	Param1 uint64
+	Param2 uint64
+	Kind   valSizeDistKind
+
+	hist *empiricalDist // only for vsHist
+}
+
+func (d valSizeDist) String() string {
+	switch d.Kind {
+	case vsConst:
+		return fmt.Sprintf("const-%d", d.Param1)
+	case vsUniform:
+		return fmt.Sprintf("uniform-%d-%d", d.Param1, d.Param2)
+	case vsZipfian:
+		if d.Param2 == 0 {
+			return "zipfian"
+		}
+		return fmt.Sprintf("zipfian-%d-%d", d.Param1, d.Param2)
+	case vsHist:
+		return histDistPrefix + d.hist.path
+	}
+	return fmt.Sprintf("unknown(%d)", d.Kind)
+}
+
+// zfValSizeTheta matches the default used by YCSB for field lengths.
+const zfValSizeTheta = 0.99
+
+func parseSizeRange(name, t string) (lo, hi uint64, err error) {
+	fields := strings.Split(t, "-")
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("%s needs min and max", name)
+	}
+	lo, err = strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad min for %s: %v", name, err)
+	}
+	hi, err = strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad max for %s: %v", name, err)
+	}
+	if hi < lo {
+		return 0, 0, fmt.Errorf("%s max must be >= min", name)
+	}
+	return lo, hi, nil
+}
+
+func parseValSizeDist(raw string) (valSizeDist, error) {
+	lower := strings.ToLower(raw)
+	switch {
+	case strings.HasPrefix(lower, "const"):
+		t := strings.TrimPrefix(lower, "const-")
+		n, err := strconv.ParseUint(t, 10, 32)
+		if err != nil {
+			return valSizeDist{}, fmt.Errorf("bad size for const: %v", err)
+		}
+		return valSizeDist{Kind: vsConst, Param1: n}, nil
+	case strings.HasPrefix(lower, "uniform"):
+		lo, hi, err := parseSizeRange("uniform", strings.TrimPrefix(lower, "uniform-"))
+		if err != nil {
+			return valSizeDist{}, err
+		}
+		return valSizeDist{Kind: vsUniform, Param1: lo, Param2: hi}, nil
+	case lower == "zipfian":
+		// sizes in [1, Config.ValSize] like YCSB
+		return valSizeDist{Kind: vsZipfian}, nil
+	case strings.HasPrefix(lower, "zipfian"):
+		lo, hi, err := parseSizeRange("zipfian", strings.TrimPrefix(lower, "zipfian-"))
+		if err != nil {
+			return valSizeDist{}, err
+		}
+		if hi == 0 {
+			// a max of 0 means the default range
+			return valSizeDist{}, errors.New("zipfian max must be positive")
+		}
+		return valSizeDist{Kind: vsZipfian, Param1: lo, Param2: hi}, nil
+	case strings.HasPrefix(lower, histDistPrefix):
+		// don't lowercase the path
+		h, err := loadHist(raw[len(histDistPrefix):])
+		if err != nil {
+			return valSizeDist{}, fmt.Errorf("bad hist: %v", err)
+		}
+		if h.maxHi() > 1<<32 {
+			return valSizeDist{}, errors.New("hist bucket bounds are too large")
+		}
+		return valSizeDist{Kind: vsHist, hist: h}, nil
+	}
+	return valSizeDist{}, fmt.Errorf("unknown value size distribution: %s", raw)
+}
+
+type constGen int64
+
+func (g constGen) Next(_ *rand.Rand) int64 { return int64(g) }
+
+type offsetGen struct {
+	g   intgen.Gen
+	off int64
+}
+
+func (g offsetGen) Next(rng *rand.Rand) int64 { return g.off + g.g.Next(rng) }
+
+// makeValSizeGen creates a generator of value sizes.
+// If d is the zero value, all values will be defSize bytes.
+func makeValSizeGen(d valSizeDist, defSize int) intgen.Gen {
+	switch d.Kind {
+	case 0:
+		return constGen(defSize)
+	case vsConst:
+		return constGen(d.Param1)
+	case vsUniform:
+		return offsetGen{g: intgen.NewUniform(int64(d.Param2-d.Param1) + 1), off: int64(d.Param1)}
+	case vsZipfian:
+		lo, hi := int64(d.Param1), int64(d.Param2)
+		if hi == 0 {
+			if defSize < 1 {
+				return constGen(defSize)
+			}
+			lo, hi = 1, int64(defSize)
+		}
+		return offsetGen{g: cachedZipfian(hi-lo+1, zfValSizeTheta), off: lo}
+	case vsHist:
+		return newHistGen(d.hist, 1)
+	}
+	panic(fmt.Errorf("invalid value size dist %v", d))
+}
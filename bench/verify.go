@@ -0,0 +1,287 @@
+package bench
+
+import (
+	"hash/crc32"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uluyol/fabbench/internal/fnv"
+	"github.com/uluyol/fabbench/internal/splitmix"
+)
+
+/*
+
+Verifiable values have the layout
+
+	MAGIC SEQ CRC BODY
+
+where MAGIC is verifyMagic, SEQ is the write sequence number as 16 hex digits,
+and CRC is the CRC-32C of key+SEQ+BODY as 8 hex digits.
+BODY is derived deterministically from (key, SEQ) using the configured value content.
+
+Including the key in the checksum means that values returned for the wrong key
+are detected as corrupt.
+
+*/
+
+const (
+	verifyMagic     = "fbv1"
+	verifySeqLen    = 16
+	verifyCRCLen    = 8
+	verifyHeaderLen = len(verifyMagic) + verifySeqLen + verifyCRCLen
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+const hexDigits = "0123456789abcdef"
+
+// appendHex appends the low width hex digits of v to buf.
+func appendHex(buf []byte, v uint64, width int) []byte {
+	for i := width - 1; i >= 0; i-- {
+		buf = append(buf, hexDigits[(v>>uint(4*i))&0xf])
+	}
+	return buf
+}
+
+func verifyCRC(key string, seq, body []byte) uint32 {
+	c := crc32.Update(0, crcTable, []byte(key))
+	c = crc32.Update(c, crcTable, seq)
+	return crc32.Update(c, crcTable, body)
+}
+
+// NextVerifiable generates a value for key at write sequence seq.
+// The size of the value is drawn from rng, but the contents are determined
+// by key and seq alone.
+// Values are never smaller than verifyHeaderLen.
+func (g *valueGen) NextVerifiable(rng *rand.Rand, key string, seq uint64) string {
+	size := int(g.sizes.Next(rng))
+	if size < verifyHeaderLen {
+		size = verifyHeaderLen
+	}
+	buf := g.bufPool.Get().([]byte)
+	if cap(buf) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+
+	body := buf[verifyHeaderLen:]
+	src := splitmix.New(fnv.HashString(key) ^ seq)
+	brng := rand.New(src)
+	switch g.content.Kind {
+	case vcCompressible:
+		fillCompressible(body, brng, g.content.Ratio)
+	case vcJSON:
+		// fillJSON may reallocate if it overshoots
+		copy(body, fillJSON(body, brng))
+	default:
+		fillRandom(body, brng)
+	}
+
+	hdr := append(buf[:0], verifyMagic...)
+	hdr = appendHex(hdr, seq, verifySeqLen)
+	crc := verifyCRC(key, hdr[len(verifyMagic):], body)
+	appendHex(hdr, uint64(crc), verifyCRCLen)
+
+	s := string(buf)
+	g.bufPool.Put(buf)
+	return s
+}
+
+type verifyResult uint8
+
+const (
+	vrOK verifyResult = iota + 1
+	vrCorrupt
+	vrStale
+	vrMissing
+)
+
+// String returns the name used for the counter in the recorders.
+func (r verifyResult) String() string {
+	switch r {
+	case vrOK:
+		return "verified"
+	case vrCorrupt:
+		return "corrupt"
+	case vrStale:
+		return "stale"
+	case vrMissing:
+		return "missing"
+	}
+	return "unknown"
+}
+
+// checkValue checks that val is a valid value for key
+// and returns the sequence number of the write that produced it.
+func checkValue(key, val string) (uint64, verifyResult) {
+	if len(val) == 0 {
+		return 0, vrMissing
+	}
+	if len(val) < verifyHeaderLen || val[:len(verifyMagic)] != verifyMagic {
+		return 0, vrCorrupt
+	}
+	seqHex := val[len(verifyMagic) : len(verifyMagic)+verifySeqLen]
+	crcHex := val[len(verifyMagic)+verifySeqLen : verifyHeaderLen]
+	seq, err := strconv.ParseUint(seqHex, 16, 64)
+	if err != nil {
+		return 0, vrCorrupt
+	}
+	crc, err := strconv.ParseUint(crcHex, 16, 32)
+	if err != nil {
+		return 0, vrCorrupt
+	}
+	if verifyCRC(key, []byte(seqHex), []byte(val[verifyHeaderLen:])) != uint32(crc) {
+		return 0, vrCorrupt
+	}
+	return seq, vrOK
+}
+
+/*
+
+A verifier judges a read as stale only if the value it returned had
+certainly been overwritten before the read started: some write W was
+issued after the write of the value was acknowledged, and W itself was
+acknowledged before the read started. Reads that could have been ordered
+after a concurrent write are never stale.
+
+For each key, we keep the writes that have not been overwritten in this
+sense yet (in flight or concurrent with the latest acknowledged writes).
+Once a write is overwritten, it is dropped and the time is remembered so
+that reads that started later can be judged. Failed writes may or may not
+have been applied, so they are treated as if they were acknowledged when
+they failed. This keeps the state for each key from growing with every
+failure.
+
+Sequence numbers have the client index in the top bits so that clients
+writing concurrently do not reuse them. Only values written by this
+client, or loaded with sequence number 0, are checked for staleness.
+
+*/
+
+const (
+	numVerifyShards = 64
+	verifyClientBit = 48
+)
+
+type verifyWrite struct {
+	seq     uint64
+	invoked time.Time
+	acked   time.Time // zero if in flight or failed
+	failed  bool
+}
+
+type verifyKey struct {
+	writes    []verifyWrite // in seq order
+	firstAck  time.Time     // when the loaded value was overwritten
+	lastPrune time.Time     // when writes were last dropped
+}
+
+// A verifier assigns write sequence numbers
+// and tracks which writes to each key have been overwritten.
+// It is safe for concurrent use.
+type verifier struct {
+	seq    uint64
+	client uint64
+	shards [numVerifyShards]struct {
+		mu   sync.Mutex
+		keys map[string]*verifyKey
+	}
+}
+
+// newVerifier creates a verifier for writes made by the client-th client.
+func newVerifier(client int) *verifier {
+	v := &verifier{client: uint64(client+1) << verifyClientBit}
+	for i := range v.shards {
+		v.shards[i].keys = make(map[string]*verifyKey)
+	}
+	return v
+}
+
+// write assigns a sequence number for a write to key that is about to be
+// sent at time at. Sequence numbers are never 0 so that loaded values
+// are older than any write made in a run.
+func (v *verifier) write(key string, at time.Time) uint64 {
+	sh := &v.shards[fnv.HashString(key)%numVerifyShards]
+	sh.mu.Lock()
+	k := sh.keys[key]
+	if k == nil {
+		k = new(verifyKey)
+		sh.keys[key] = k
+	}
+	seq := v.client | atomic.AddUint64(&v.seq, 1)
+	k.writes = append(k.writes, verifyWrite{seq: seq, invoked: at})
+	sh.mu.Unlock()
+	return seq
+}
+
+// ack records that the write seq to key completed at time at.
+// Failed writes can be overwritten, but do not overwrite others.
+func (v *verifier) ack(key string, seq uint64, at time.Time, failed bool) {
+	sh := &v.shards[fnv.HashString(key)%numVerifyShards]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	k := sh.keys[key]
+	var invoked time.Time
+	for i := range k.writes {
+		if w := &k.writes[i]; w.seq == seq {
+			w.acked, w.failed = at, failed
+			invoked = w.invoked
+			break
+		}
+	}
+	if failed {
+		return
+	}
+	if k.firstAck.IsZero() {
+		k.firstAck = at
+	}
+	// drop the writes that this one overwrote
+	kept := k.writes[:0]
+	for _, w := range k.writes {
+		if !w.acked.IsZero() && w.acked.Before(invoked) {
+			k.lastPrune = at
+			continue
+		}
+		kept = append(kept, w)
+	}
+	k.writes = kept
+}
+
+// check checks val, read from key by a read that started at start.
+func (v *verifier) check(key, val string, start time.Time) verifyResult {
+	seq, res := checkValue(key, val)
+	if res != vrOK {
+		return res
+	}
+	sh := &v.shards[fnv.HashString(key)%numVerifyShards]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	k := sh.keys[key]
+	if k == nil {
+		return vrOK
+	}
+	switch {
+	case seq == 0:
+		if !k.firstAck.IsZero() && k.firstAck.Before(start) {
+			return vrStale
+		}
+		return vrOK
+	case seq&^(1<<verifyClientBit-1) != v.client:
+		// written by another client
+		return vrOK
+	}
+	for _, w := range k.writes {
+		if w.seq == seq {
+			// writes are dropped as soon as they are overwritten
+			return vrOK
+		}
+	}
+	// dropped, but we only know when if nothing was dropped since
+	if !k.lastPrune.IsZero() && k.lastPrune.Before(start) {
+		return vrStale
+	}
+	return vrOK
+}
@@ -0,0 +1,248 @@
+package bench
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/internal/fnv"
+	"github.com/uluyol/fabbench/readers"
+	"github.com/uluyol/fabbench/recorders"
+	"github.com/uluyol/hdrhist"
+)
+
+func TestCheckValue(t *testing.T) {
+	t.Parallel()
+	contents := []valContent{{Kind: vcRandom}, {Kind: vcCompressible, Ratio: 3}, {Kind: vcJSON}}
+	sizes := []int64{0, 10, int64(verifyHeaderLen), 100, 4096}
+
+	for _, c := range contents {
+		for _, size := range sizes {
+			g := newValueGen(constGen(size), c)
+			r := rand.New(rand.NewSource(0))
+			const key = "some-key"
+			v := g.NextVerifiable(r, key, 5)
+
+			if v2 := g.NextVerifiable(r, key, 5); v2 != v {
+				t.Errorf("%v/%d: values are not deterministic", c, size)
+			}
+			if seq, res := checkValue(key, v); res != vrOK || seq != 5 {
+				t.Errorf("%v/%d: valid value: got %v, seq %d", c, size, res, seq)
+			}
+			if _, res := checkValue("other-key", v); res != vrCorrupt {
+				t.Errorf("%v/%d: value for wrong key: got %v", c, size, res)
+			}
+			if _, res := checkValue(key, v[:len(v)-1]); res != vrCorrupt {
+				t.Errorf("%v/%d: truncated value: got %v", c, size, res)
+			}
+			if len(v) > verifyHeaderLen {
+				b := []byte(v)
+				b[len(b)-1]++
+				if _, res := checkValue(key, string(b)); res != vrCorrupt {
+					t.Errorf("%v/%d: modified value: got %v", c, size, res)
+				}
+			}
+			if _, res := checkValue(key, ""); res != vrMissing {
+				t.Errorf("%v/%d: missing value: got %v", c, size, res)
+			}
+		}
+	}
+}
+
+func TestVerifierStale(t *testing.T) {
+	t.Parallel()
+	base := time.Now()
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+	g := newValueGen(constGen(64), valContent{Kind: vcRandom})
+	rng := rand.New(rand.NewSource(0))
+	const key = "k"
+
+	type op struct {
+		write           int // index of the write, -1 for a read
+		invoke, ack     int
+		failed          bool
+		read            int // index of the write read, -1 for the loaded value
+		want            verifyResult
+		otherClientRead bool
+	}
+	w := func(i, invoke, ack int) op { return op{write: i, invoke: invoke, ack: ack} }
+	r := func(i, start int, want verifyResult) op { return op{write: -1, read: i, invoke: start, want: want} }
+
+	tests := []struct {
+		name string
+		ops  []op
+	}{
+		{"loaded before writes", []op{r(-1, 0, vrOK), w(0, 1, 2), r(-1, 1, vrOK), r(-1, 3, vrStale)}},
+		{"sequential", []op{w(0, 0, 1), w(1, 2, 3), r(0, 2, vrOK), r(0, 4, vrStale), r(1, 4, vrOK)}},
+		// 1 is applied before 0, both are acknowledged
+		{"overlapping", []op{w(0, 0, 10), w(1, 1, 5), r(0, 20, vrOK), r(1, 20, vrOK)}},
+		{"overlapping then later", []op{w(0, 0, 10), w(1, 1, 5), w(2, 11, 12), r(0, 20, vrStale), r(1, 20, vrStale), r(2, 20, vrOK)}},
+		{"concurrent with read", []op{w(0, 0, 1), w(1, 2, 30), r(0, 20, vrOK), r(1, 20, vrOK)}},
+		{"failed", []op{{write: 0, invoke: 0, ack: 1, failed: true}, w(1, 2, 3), r(0, 4, vrStale), r(-1, 4, vrStale)}},
+		{"failed concurrent", []op{{write: 0, invoke: 0, ack: 5, failed: true}, w(1, 2, 3), r(0, 6, vrOK), r(1, 6, vrOK)}},
+		{"failed only", []op{{write: 0, invoke: 0, ack: 1, failed: true}, r(0, 2, vrOK), r(-1, 2, vrOK)}},
+		{"other client", []op{w(0, 0, 1), w(1, 2, 3), {write: -1, read: 0, invoke: 4, want: vrOK, otherClientRead: true}}},
+	}
+	for _, test := range tests {
+		v := newVerifier(0)
+		other := newVerifier(1)
+		seqs := make(map[int]uint64)
+		otherSeqs := make(map[int]uint64)
+		// apply ops in time order of invocation, acks before later invocations
+		type event struct {
+			t   int
+			ack bool
+			op  op
+		}
+		var events []event
+		for _, o := range test.ops {
+			events = append(events, event{t: o.invoke, op: o})
+			if o.write >= 0 {
+				events = append(events, event{t: o.ack, ack: true, op: o})
+			}
+		}
+		sort.SliceStable(events, func(i, j int) bool { return events[i].t < events[j].t })
+		for _, e := range events {
+			o := e.op
+			switch {
+			case o.write >= 0 && !e.ack:
+				seqs[o.write] = v.write(key, at(o.invoke))
+				otherSeqs[o.write] = other.write(key, at(o.invoke))
+			case o.write >= 0:
+				v.ack(key, seqs[o.write], at(o.ack), o.failed)
+			default:
+				var seq uint64
+				if o.read >= 0 {
+					seq = seqs[o.read]
+					if o.otherClientRead {
+						seq = otherSeqs[o.read]
+					}
+				}
+				val := g.NextVerifiable(rng, key, seq)
+				if got := v.check(key, val, at(o.invoke)); got != o.want {
+					t.Errorf("%s: read of write %d at %d: got %v, want %v", test.name, o.read, o.invoke, got, o.want)
+				}
+			}
+		}
+	}
+}
+
+func TestVerifierPrunes(t *testing.T) {
+	t.Parallel()
+	const key = "k"
+	base := time.Unix(0, 0)
+	v := newVerifier(0)
+	for i := 0; i < 1000; i++ {
+		seq := v.write(key, base.Add(time.Duration(2*i)))
+		v.ack(key, seq, base.Add(time.Duration(2*i+1)), i%2 == 0)
+	}
+	k := v.shards[fnv.HashString(key)%numVerifyShards].keys[key]
+	if len(k.writes) > 2 {
+		t.Errorf("kept %d writes, want at most 2", len(k.writes))
+	}
+}
+
+type mapDB struct {
+	m sync.Map
+}
+
+func (d *mapDB) Init(ctx context.Context) error { return nil }
+
+func (d *mapDB) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	v, _ := d.m.Load(key)
+	s, _ := v.(string)
+	return s, db.EmptyMeta(), nil
+}
+
+func (d *mapDB) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	d.m.Store(key, val)
+	return db.EmptyMeta(), nil
+}
+
+func (d *mapDB) Close() error { return nil }
+
+func runVerify(t *testing.T, conn db.DB, cfg Config, trace []TraceStep) *readers.Latency {
+	descs := make([]string, len(trace))
+	for i := range trace {
+		descs[i] = trace[i].String()
+	}
+	hcfg := hdrhist.Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e6,
+		SigFigs:           3,
+		AutoResize:        true,
+	}
+
+	rw := recorders.NewMemoryMultiLogWriter(time.Now())
+	r := Runner{
+		DB:            conn,
+		Config:        cfg,
+		Rand:          rand.New(rand.NewSource(0)),
+		Trace:         trace,
+		Verify:        true,
+		ReadRecorder:  recorders.NewMultiLatency(hcfg, descs),
+		ReadWriter:    rw,
+		WriteRecorder: recorders.NewMultiLatency(hcfg, descs),
+		WriteWriter:   recorders.NewMemoryMultiLogWriter(time.Now()),
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("unable to run: %v", err)
+	}
+	rr, err := readers.ReadLatency(rw.AllReader())
+	if err != nil {
+		t.Fatalf("unable to read written read latencies: %v", err)
+	}
+	return rr
+}
+
+func TestRunVerify(t *testing.T) {
+	t.Parallel()
+	cfg := Config{
+		RecordCount: 100,
+		KeySize:     1 << 6,
+		ValSize:     1 << 7,
+	}
+	trace := mustMakeTrace([]string{"rkd=uniform wkd=uniform rw=0.5 d=1s ad=closed-8 qps=2000"})
+
+	var good mapDB
+	l := Loader{
+		DB:         &good,
+		Config:     cfg,
+		Rand:       rand.New(rand.NewSource(0)),
+		NumWorkers: 4,
+		LoadCount:  -1,
+		Verify:     true,
+	}
+	if err := l.Run(context.Background()); err != nil {
+		t.Fatalf("unable to load: %v", err)
+	}
+	rr := runVerify(t, &good, cfg, trace)
+	for _, name := range []string{"corrupt", "stale", "missing"} {
+		if c, ok := rr.Counts[name]; ok && c[0] != 0 {
+			t.Errorf("good db: got %d %s reads", c[0], name)
+		}
+	}
+	if c := rr.Counts["verified"]; len(c) != 1 || c[0] != rr.Hists[0].TotalCount() {
+		t.Errorf("good db: want all %d reads verified, got %v", rr.Hists[0].TotalCount(), c)
+	}
+
+	conn, err := db.Dial("dummy", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to setup: %v", err)
+	}
+	defer conn.Close()
+	rr = runVerify(t, conn, cfg, trace)
+	if c := rr.Counts["corrupt"]; len(c) != 1 || c[0] != rr.Hists[0].TotalCount() {
+		t.Errorf("dummy db: want all %d reads corrupt, got %v", rr.Hists[0].TotalCount(), c)
+	}
+
+	var empty mapDB
+	rr = runVerify(t, &empty, cfg, mustMakeTrace([]string{"rkd=uniform wkd=uniform rw=1 d=1s ad=closed-8 qps=500"}))
+	if c := rr.Counts["missing"]; len(c) != 1 || c[0] != 500 {
+		t.Errorf("empty db: want 500 missing reads, got %v", c)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/history"
 )
 
 // A WorkloadReqFunc executes one request in a workload.
@@ -19,9 +20,28 @@ func ReadReq(ctx context.Context, args *issueArgs, rng *rand.Rand, wg *sync.Wait
 		defer wg.Done()
 	}
 	key := args.readKeyGen.Next(rng)
-	_, meta, err := args.db.Get(ctx, key)
+	hid := args.history.Invoke(history.Get, key, "")
+	trackStale := args.stale != nil && args.stale.sampled(key)
+	var getStart time.Time
+	if trackStale || args.verifier != nil {
+		getStart = time.Now()
+	}
+	val, meta, err := args.db.Get(ctx, key)
 	latency := time.Since(start)
-	args.readC <- resDoneReq(args.tsStep, getHost(meta), latency, err)
+	args.history.Complete(hid, history.Get, key, val, err)
+	res := resDoneReq(args.tsStep, getHost(meta), latency, int64(len(val)), err)
+	if trackStale && err == nil {
+		st := args.stale.staleness(key, val, getStart)
+		sres := resDoneReq(args.tsStep, res.name, st, 0, nil)
+		if st > 0 {
+			sres.counter = "stale"
+		}
+		args.report(rkStale, sres)
+	}
+	if args.verifier != nil && err == nil {
+		res.counter = args.verifier.check(key, val, getStart).String()
+	}
+	args.report(rkRead, res)
 }
 
 func WriteReq(ctx context.Context, args *issueArgs, rng *rand.Rand, wg *sync.WaitGroup, start time.Time) {
@@ -29,10 +49,30 @@ func WriteReq(ctx context.Context, args *issueArgs, rng *rand.Rand, wg *sync.Wai
 		defer wg.Done()
 	}
 	key := args.writeKeyGen.Next(rng)
-	val := args.valGen.Next(rng)
+	var val string
+	var seq uint64
+	if args.verifier != nil {
+		seq = args.verifier.write(key, time.Now())
+		val = args.valGen.NextVerifiable(rng, key, seq)
+	} else {
+		val = args.valGen.Next(rng)
+	}
+	hid := args.history.Invoke(history.Put, key, val)
+	trackStale := args.stale != nil && args.stale.sampled(key)
+	var sw staleWrite
+	if trackStale {
+		sw = args.stale.write(key, val)
+	}
 	meta, err := args.db.Put(ctx, key, val)
 	latency := time.Since(start)
-	args.writeC <- resDoneReq(args.tsStep, getHost(meta), latency, err)
+	args.history.Complete(hid, history.Put, key, val, err)
+	if trackStale && err == nil {
+		args.stale.ack(key, sw, time.Now())
+	}
+	if args.verifier != nil {
+		args.verifier.ack(key, seq, time.Now(), err != nil)
+	}
+	args.report(rkWrite, resDoneReq(args.tsStep, getHost(meta), latency, int64(len(val)), err))
 }
 
 func getHost(m db.Meta) string {
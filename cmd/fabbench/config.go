@@ -1,16 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io/ioutil"
+	"log"
 
 	"github.com/uluyol/fabbench/bench"
 	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/db/middleware"
+	"github.com/uluyol/fabbench/readers"
+	"github.com/uluyol/fabbench/slo"
 
 	_ "github.com/uluyol/fabbench/db/cassandra"
 	_ "github.com/uluyol/fabbench/db/dummy"
 	_ "github.com/uluyol/fabbench/db/eckv"
+	_ "github.com/uluyol/fabbench/db/faulty"
+	_ "github.com/uluyol/fabbench/db/filekv"
+	_ "github.com/uluyol/fabbench/db/httpkv"
+	_ "github.com/uluyol/fabbench/db/memkv"
+	_ "github.com/uluyol/fabbench/db/redis"
 )
 
 type cmdConfig struct {
@@ -18,25 +28,46 @@ type cmdConfig struct {
 		Name    string          `json:"name"`
 		Options json.RawMessage `json:"options"`
 	} `json:"db"`
-	Workload bench.Config `json:"workload"`
+	Middleware []middleware.Config `json:"middleware"`
+	Workload   bench.Config        `json:"workload"`
+	SLO        []string            `json:"slo"`
 }
 
 func loadConfig(hosts []string, path string) (db.DB, *bench.Config, error) {
-	f, err := os.Open(path)
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to open config: %v", err)
 	}
-	defer f.Close()
+	return dialConfig(hosts, data)
+}
 
-	dec := json.NewDecoder(f)
+func dialConfig(hosts []string, data []byte) (db.DB, *bench.Config, error) {
 	var allCfg cmdConfig
-	if err := dec.Decode(&allCfg); err != nil {
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&allCfg); err != nil {
 		return nil, nil, fmt.Errorf("unable to decode config: %v", err)
 	}
 
-	db, err := db.Dial(allCfg.DB.Name, hosts, []byte(allCfg.DB.Options))
+	d, err := db.Dial(allCfg.DB.Name, hosts, []byte(allCfg.DB.Options))
 	if err != nil {
 		return nil, &allCfg.Workload, fmt.Errorf("error connecting to db: %v", err)
 	}
-	return db, &allCfg.Workload, nil
+	wrapped, err := middleware.Chain(d, allCfg.Middleware)
+	if err != nil {
+		d.Close()
+		return nil, &allCfg.Workload, err
+	}
+	return wrapped, &allCfg.Workload, nil
+}
+
+// checkSLO logs the violations of rules and reports whether there were none.
+func checkSLO(rules []*slo.Rule, read, write *readers.Latency) bool {
+	vs, err := slo.Check(rules, read, write)
+	if err != nil {
+		log.Printf("unable to check slo: %v", err)
+		return false
+	}
+	for _, v := range vs {
+		log.Printf("slo violated: %v", v)
+	}
+	return len(vs) == 0
 }
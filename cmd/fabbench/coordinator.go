@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/uluyol/fabbench/coord"
+	"github.com/uluyol/fabbench/readers"
+	"github.com/uluyol/fabbench/recorders"
+	"github.com/uluyol/fabbench/slo"
+)
+
+type coordinatorCmd struct {
+	addr          string
+	mode          string
+	nclients      int
+	configPath    string
+	tracePath     string
+	outPre        string
+	randSeedIndex int64
+	startDelay    time.Duration
+	sloPath       string
+}
+
+func (*coordinatorCmd) Name() string     { return "coordinator" }
+func (*coordinatorCmd) Synopsis() string { return "coordinate load or run across multiple clients" }
+func (*coordinatorCmd) Usage() string {
+	return `fabbench coordinator -mode MODE -nclients N -config PATH [-trace PATH] [-out PREFIX]
+
+The coordinator waits for N clients started with load -coordinator or
+run -coordinator, and sends them the config, trace, random seed and
+shard of the work to do.
+
+For load, the records are split among the clients.
+For run, the QPS and closed-loop workers of each step are split among them.
+Each step starts at the same wall-clock time on all clients, so their clocks
+must be synchronized. Once done, clients upload their logs, which are merged
+and written to PREFIX-ro.gz, PREFIX-wo.gz, etc.
+
+Files referred to by the trace (e.g. hist=PATH) must exist on every client.
+
+The merged results are checked against the rules in the slo section of the
+config and in the -slo file, and the coordinator exits with a non-zero status
+if any are violated.
+
+`
+}
+
+func (c *coordinatorCmd) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.addr, "addr", ":7070", "address to listen on")
+	fs.StringVar(&c.mode, "mode", coord.ModeRun, "what clients should do (load or run)")
+	fs.IntVar(&c.nclients, "nclients", 1, "number of clients to wait for")
+	fs.StringVar(&c.configPath, "config", "", "config file path")
+	fs.StringVar(&c.tracePath, "trace", "", "trace file path (for run)")
+	fs.StringVar(&c.outPre, "out", "", "output path prefix for merged logs (for run)")
+	fs.Int64Var(&c.randSeedIndex, "rand-seed-index", 0, "partial see to initialize rng (deterministic if 0)")
+	fs.DurationVar(&c.startDelay, "start-delay", time.Second, "time between all clients being ready and a step starting")
+	fs.StringVar(&c.sloPath, "slo", "", "file with slo rules to check (for run)")
+}
+
+func (c *coordinatorCmd) Execute(ctx context.Context, fs *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if c.mode != coord.ModeLoad && c.mode != coord.ModeRun {
+		log.Fatalf("invalid mode %q", c.mode)
+	}
+	if c.nclients < 1 {
+		log.Fatal("need at least one client")
+	}
+
+	cfgData, err := ioutil.ReadFile(c.configPath)
+	if err != nil {
+		log.Fatalf("unable to open config: %v", err)
+	}
+	var cfg cmdConfig
+	if err := json.Unmarshal(cfgData, &cfg); err != nil {
+		log.Fatalf("unable to decode config: %v", err)
+	}
+
+	var traceData []byte
+	var traceDescs []string
+	var rules []*slo.Rule
+	if c.mode == coord.ModeRun {
+		rules, err = slo.Load(cfgData, c.sloPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trace, err := loadTrace(c.tracePath)
+		if err != nil {
+			log.Fatalf("unable to load trace: %v", err)
+		}
+		traceData, err = ioutil.ReadFile(c.tracePath)
+		if err != nil {
+			log.Fatalf("unable to load trace: %v", err)
+		}
+		for i := range trace {
+			traceDescs = append(traceDescs, trace[i].String())
+		}
+	}
+
+	var seed int64
+	if c.randSeedIndex > 0 {
+		seed = time.Now().UnixNano() ^ c.randSeedIndex
+	}
+
+	ln, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger := log.New(os.Stderr, "fabbench: coordinator: ", log.LstdFlags)
+	co := coord.Coordinator{
+		Log:         logger,
+		Listener:    ln,
+		Mode:        c.mode,
+		NumClients:  c.nclients,
+		Config:      cfgData,
+		Trace:       string(traceData),
+		Seed:        seed,
+		RecordCount: cfg.Workload.RecordCount,
+		StartDelay:  c.startDelay,
+	}
+	logger.Printf("waiting for %d clients on %s", c.nclients, ln.Addr())
+	results, err := co.Run(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	status := subcommands.ExitSuccess
+	for _, res := range results {
+		if res.Err != "" {
+			status = subcommands.ExitFailure
+		}
+	}
+	if c.mode == coord.ModeRun {
+		merged, err := writeMergedLogs(c.outPre, results, traceDescs)
+		if err != nil {
+			log.Fatalf("unable to write merged logs: %v", err)
+		}
+		if len(rules) > 0 && !checkSLO(rules, merged["ro"], merged["wo"]) {
+			status = subcommands.ExitFailure
+		}
+	}
+	return status
+}
+
+// writeMergedLogs merges the logs uploaded by clients.
+// Log names are KIND for aggregate logs and KIND/NAME for specific ones,
+// and are written to outPre-KIND.gz and outPre-KIND-sub/NAME.gz.
+// It returns the merged logs by name.
+func writeMergedLogs(outPre string, results []coord.Result, descs []string) (map[string]*readers.Latency, error) {
+	merged := make(map[string]*readers.Latency)
+	var start time.Time
+	for _, res := range results {
+		if res.Err != "" {
+			continue
+		}
+		for name, data := range res.Logs {
+			if len(data) == 0 {
+				continue
+			}
+			l, err := readers.ReadLatency(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("client %d (%s): %s: %v", res.Client, res.Name, name, err)
+			}
+			if len(l.Hists) > 0 {
+				if t, ok := l.Hists[0].StartTime(); ok && (start.IsZero() || t.Before(start)) {
+					start = t
+				}
+			}
+			if m := merged[name]; m != nil {
+				if err := m.Add(l); err != nil {
+					return nil, fmt.Errorf("client %d (%s): %s: %v", res.Client, res.Name, name, err)
+				}
+			} else {
+				merged[name] = l
+			}
+		}
+	}
+
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writers := make(map[string]recorders.MultiLogWriter)
+	for _, name := range names {
+		l := merged[name]
+		// clients describe their shard of each step
+		if len(l.Descs) == len(descs) {
+			copy(l.Descs, descs)
+		}
+		kind, sub := name, ""
+		if i := strings.Index(name, "/"); i >= 0 {
+			kind, sub = name[:i], name[i+1:]
+		}
+		w := writers[kind]
+		if w == nil {
+			w = recorders.NewMultiLogWriter(outPre+"-"+kind, start, gzip.BestSpeed)
+			writers[kind] = w
+		}
+		var err error
+		if sub == "" {
+			err = w.WriteAll(l.WriteTo)
+		} else {
+			err = w.Write(sub, l.WriteTo)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// memLogs collects logs written to in-memory writers
+// for upload to the coordinator.
+func memLogs(ws map[string]*recorders.MemoryMultiLogWriter) map[string][]byte {
+	logs := make(map[string][]byte)
+	for kind, w := range ws {
+		logs[kind], _ = ioutil.ReadAll(w.AllReader())
+		for _, name := range w.Names() {
+			logs[kind+"/"+name], _ = ioutil.ReadAll(w.Reader(name))
+		}
+	}
+	return logs
+}
+
+func dialCoordinator(ctx context.Context, addr, mode string) *coord.Client {
+	cl, err := coord.Dial(ctx, addr, mode, clientName())
+	if err != nil {
+		log.Fatalf("unable to register with coordinator: %v", err)
+	}
+	a := cl.Assignment()
+	log.Printf("registered with coordinator as client %d of %d", a.Client, a.NumClients)
+	return cl
+}
+
+func clientName() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
@@ -14,8 +15,13 @@ import (
 	"github.com/google/subcommands"
 	"github.com/pkg/profile"
 	"github.com/uluyol/fabbench/bench"
+	"github.com/uluyol/fabbench/coord"
+	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/history"
 	"github.com/uluyol/fabbench/internal/ranges"
+	"github.com/uluyol/fabbench/readers"
 	"github.com/uluyol/fabbench/recorders"
+	"github.com/uluyol/fabbench/slo"
 	"github.com/uluyol/hdrhist"
 )
 
@@ -27,13 +33,32 @@ CONFIG FORMAT
 				"name": NAME_STR,
 				"options": DB_SPECIFIC_OPTIONS
 			},
+			"middleware": [ // optional
+				{
+					"name": MIDDLEWARE_NAME_STR,
+					"options": MIDDLEWARE_SPECIFIC_OPTIONS
+				},
+				...
+			],
 			"workload": {
 				"recordCount": RECORDS_INT,
 				"keySize": KEY_BYTES_INT,
 				"valSize": VAL_BYTES_INT,
-			}
+				"valSizeDist": VAL_SIZE_DIST_STR, // optional
+				"valContent": VAL_CONTENT_STR,    // default: random
+			},
+			"slo": [RULE_STR, ...] // optional
 		}
 
+	If set, workload.valSizeDist overrides valSize and takes the same
+	values as the vsd trace property.
+
+	workload.valContent selects what values contain:
+		random:          incompressible random characters
+		compressible-R:  compresses by a factor of about R (>= 1)
+		                 with LZ-family compressors like LZ4 and Snappy
+		json:            newline-separated JSON records, truncated to size
+
 	Because fabbench is meant to handle multiple databases, db.options is
 	db-specific.
 
@@ -41,14 +66,61 @@ CONFIG FORMAT
 		eckv:      ECKV
 		dummy:     A dummy database useful for testing
 		cassandra: Apache Cassandra via gocql
+		faulty:    Wraps another database and injects faults
+		memkv:     An in-process, in-memory key-value store
+		filekv:    An embedded key-value store in local files
+		redis:     Redis, standalone or Redis Cluster
+		httpkv:    Any key-value service with an HTTP API
 
-	For eckv, there is no schema for db.options. Use {}
+	For eckv, the schema for db.options is
+		{
+			"balance":  STRING, // default: "round-robin"
+			"tls":      TLS,    // optional, default: no TLS
+			"username": STRING, // optional, requires tls
+			"password": STRING  // optional, requires tls
+		}
+	Requests are spread over all hosts. balance is one of "round-robin",
+	"random" or "least-outstanding" (the host with the fewest requests in
+	flight). If username or password are set, they are sent with each
+	request as HTTP basic auth in the authorization metadata, so tls is
+	required to keep them from being sent in cleartext.
+
+	TLS, for eckv and cassandra, is
+		{
+			"ca":                 STRING, // optional, default: system CAs
+			"cert":               STRING, // optional, client certificate
+			"key":                STRING, // required with cert
+			"serverName":         STRING, // optional, default: the host name
+			"insecureSkipVerify": BOOL    // optional, default: false
+		}
+	where ca, cert and key are paths to PEM files.
 
 	For dummy, the schema for db.options is
 		{
-			"maxQPS": INT // optional
+			"maxQPS":        INT,                // optional
+			"servers":       INT,                // optional, default 1
+			"service":       DIST,               // optional
+			"hostVariation": FLOAT,              // optional
+			"hostFactors":   {HOST: FLOAT, ...}, // optional
+			"stallEvery":    DURATION,           // optional
+			"stallDuration": DURATION,           // optional
+			"seed":          INT                 // optional
 		}
 
+	Without service or maxQPS, requests complete immediately.
+	Otherwise, each host is simulated as a FCFS queue served by
+	servers servers whose service times are drawn from DIST:
+		const-D:            always D
+		exp-MEAN:           exponential with mean MEAN
+		lognormal-MEDIAN-S: lognormal with median MEDIAN and sigma S
+		bimodal-A-B-P:      B with probability P, A otherwise
+	maxQPS is shorthand for one server with service const-(1s/maxQPS).
+	Service times on each host are scaled by a factor that is taken
+	from hostFactors or drawn from [1-hostVariation, 1+hostVariation].
+	If stallEvery is set, each host stalls for stallDuration once every
+	stallEvery, like a GC pause. The options other than maxQPS and service
+	are only valid with one of them, and servers only with service.
+
 	For cassandra, the schema for db.options is
 		{
 			"clientRetries":        INT,    // optional
@@ -65,9 +137,150 @@ CONFIG FORMAT
 			"connectTimeout":       STRING, // default: 5s, time.Duration
 			"timeout":              STRING, // default: 600ms, time.Duration
 
+			"tls":      TLS,    // optional, see eckv, default: no TLS
+			"username": STRING, // optional, requires tls
+			"password": STRING, // optional, requires tls
+
 			"traceData": STRING, // path to store traces
 			"traceRate": INT     // freq for tracing i.e. every N requests
 		}
+	If username or password are set, they are sent to each host with
+	PasswordAuthenticator, so tls is required to keep them from being sent
+	in cleartext.
+
+	For faulty, the schema for db.options is
+		{
+			"db": {                    // the database to wrap
+				"name": NAME_STR,
+				"options": DB_SPECIFIC_OPTIONS
+			},
+			"seed":         INT,      // default: 0
+			"errorRate":    FLOAT,    // fraction of requests that fail
+			"spikeRate":    FLOAT,    // fraction of requests that are delayed
+			"spikeLatency": STRING,   // time.Duration, delay of spikes
+			"downHosts":    [STRING], // requests to these hosts fail
+			"windows": [              // optional, more faults at times
+				{
+					"steps": [INT],   // trace steps the window covers
+					"start": STRING,  // or the time.Duration after the first
+					"end":   STRING,  // request the window starts and ends
+					"errorRate": ..., // and the faults above
+				},
+				...
+			]
+		}
+	Faults in windows are injected in addition to those outside.
+	Requests that fail with errorRate or go to a down host are not sent to
+	the wrapped database. downHosts needs hosts and a database that picks
+	the host of a request before sending it: dummy, eckv, redis or httpkv.
+	For redis clusters, this is the node a request is first sent to, and
+	for httpkv, the host in the get url. cassandra chooses hosts inside
+	its driver, and memkv and filekv have none, so they do not support
+	downHosts.
+	Faults are chosen from the seed and the number of earlier requests, so
+	runs with the same seed inject the same sequence of faults.
+
+	For memkv, the schema for db.options is
+		{
+			"shards":        INT,    // default: 64
+			"snapshot":      STRING, // optional, path of snapshot file
+			"snapshotEvery": STRING  // optional, time.Duration
+		}
+	Data only lives as long as the process unless snapshot is set.
+	If it is, memkv starts with the data in the snapshot, if it exists,
+	and writes a new snapshot on exit and every snapshotEvery, so that
+	data loaded by fabbench load can be used by fabbench run.
+
+	For filekv, the schema for db.options is
+		{
+			"path":      STRING, // directory of the store
+			"sync":      STRING, // default: "none"
+			"cacheSize": INT     // default: 0, bytes of values to cache
+		}
+	The store is an append-only log with an in-memory index of keys, and
+	fabbench mktable creates it. All keys must fit in memory. Once the log
+	is at least 64 MiB and over half of it holds overwritten values, it is
+	compacted in the background by copying the latest values to a new log,
+	which needs free disk space for a copy of them. Writes wait for the
+	compaction to finish, so it shows up as a latency spike. sync is one
+	of "none" (leave flushing to the OS), "always" (fsync every write) or
+	a time.Duration to fsync periodically.
+
+	For redis, the schema for db.options is
+		{
+			"cluster":        BOOL,  // default: false
+			"connsPerHost":   INT,   // default: 1
+			"pipeline":       INT,   // default: 1, max commands in flight per conn
+			"maxRedirects":   INT,   // default: 5
+			"connectTimeout": STRING // default: "5s", time.Duration
+		}
+	Hosts default to port 6379. Without cluster, keys are sharded over the
+	hosts by their cluster slot. With cluster, the hosts are only used to
+	discover the cluster, and requests follow MOVED and ASK redirections.
+	Reads and writes use GET and SET.
+
+	For httpkv, the schema for db.options is
+		{
+			"get":          REQUEST, // how to read a key
+			"put":          REQUEST, // how to write a key
+			"timeout":      STRING,  // default: "5s", time.Duration
+			"connsPerHost": INT      // default: 100, idle conns to keep
+		}
+	where REQUEST is
+		{
+			"method":  STRING,           // default: GET for get, PUT for put
+			"url":     TEMPLATE,
+			"body":    TEMPLATE,         // optional
+			"headers": {STRING: STRING}, // optional
+			"ok":      [INT],            // success statuses, default: 200
+			                             // for get, 200, 201 and 204 for put
+			"missing": [INT],            // get only, default: 404
+			"value":   STRING            // get only, "body" (default) or
+			                             // "json:PATH" like json:data.items.0
+		}
+	TEMPLATEs are text with the placeholders {host}, {key}, {value},
+	{keyJSON} and {valueJSON}. {host} takes each host in turn. {key} and
+	{value} are escaped in urls, and {keyJSON} and {valueJSON} are quoted
+	JSON strings. Reads with a missing status or a null value return no
+	value. For example, a service that stores values at /kv/KEY is
+		{
+			"get": {"url": "http://{host}/kv/{key}"},
+			"put": {"url": "http://{host}/kv/{key}", "body": "{value}"}
+		}
+
+	Requests to any db can be passed through a chain of middleware,
+	the first of which sees requests first. The supported middleware
+	and the schemas for their options are below.
+
+	retry: retries failed requests with exponential backoff
+		{
+			"maxRetries": INT,    // default: 3
+			"backoff":    STRING, // default: 5ms, time.Duration before first retry
+			"maxBackoff": STRING, // default: 1s, time.Duration
+			"multiplier": FLOAT   // default: 5, backoff growth per retry
+		}
+
+	hedge: sends another copy of requests that are slower than a
+	percentile of recent latencies and uses the first response
+		{
+			"percentile": FLOAT,  // default: 95
+			"window":     INT,    // default: 1000, requests to compute it over
+			"minDelay":   STRING, // default: 0s, time.Duration
+			"maxDelay":   STRING, // default: 1s, time.Duration
+			"maxHedges":  INT,    // default: 1, extra copies per request
+			"writes":     BOOL    // default: false, hedge writes as well
+		}
+
+	ratelimit: limits requests with a token bucket
+		{
+			"qps":   FLOAT, // tokens added per second
+			"burst": INT    // default: 1, bucket size
+		}
+
+	concurrency: limits the number of outstanding requests
+		{
+			"max": INT
+		}
 
 TRACE FORMAT
 	The trace consists of a series of lines with property values set.
@@ -81,6 +294,8 @@ TRACE FORMAT
 		ad		request interarrival distribution
 		rkd		key distribution for reads
 		wkd		key distribution for writes
+		vsd		value size distribution (optional, default: workload config)
+		maxinflight	cap on outstanding requests (optional, default: none)
 
 	Valid values for these properties are below
 		d		any valid time.Duration in Go
@@ -89,14 +304,66 @@ TRACE FORMAT
 		ad		poisson:    poisson dist with avg qps
 				closed-N:   closed-loop workload of qps*d ops with N workers
 				uniform-W:  uniform dist with vals in [avg-avg*W, avg+avg*W]
-		rkd		zipfian-θ:  zipfian with param of θ in (0, 1)
-				linstep-K:  PDF linearly dec in K steps
-				linear:     linearly dec PDF
-				uniform:    uniform
+		rkd		zipfian-θ:    zipfian with param of θ in (0, 1)
+				linstep-K:    PDF linearly dec in K steps
+				linear:       linearly dec PDF
+				uniform:      uniform
+				exponential-λ:
+				              exponential with rate λ over keys scaled to [0, 1)
+				normal-μ-σ:   normal with mean μ in [0, 1) and stdev σ
+				              over keys scaled to [0, 1)
+				hist=PATH:    empirical dist loaded from the file at PATH
 		wkd		same options as rkd
+		vsd		const-N:      all values are N bytes
+				uniform-A-B:  uniform in [A, B] bytes
+				zipfian-A-B:  zipfian in [A, B] bytes, smaller is more popular
+				zipfian:      zipfian in [1, valSize] bytes
+				hist=PATH:    empirical dist loaded from the file at PATH
+		maxinflight	none:         no cap
+				drop-N:       requests issued while N are outstanding
+				              are dropped and counted in the logs
+				block-N:      issuing waits until fewer than N are outstanding
+				queue-N:      requests wait in a queue of up to N for one of
+				              N workers, and their time in the queue is
+				              recorded; requests that do not fit, or are
+				              still queued when the step ends, are dropped
+				maxinflight only applies to open-loop steps.
+
+	A histogram file (used by hist=PATH) has one bucket per line as
+		LO HI WEIGHT
+	where fields are separated by whitespace or commas.
+	Values are drawn uniformly from [LO, HI) in a bucket,
+	and buckets are chosen with probability proportional to WEIGHT.
+	For key distributions, LO and HI are fractions of the key space if no HI
+	is over 1. Otherwise, they are key indices in [0, recordCount].
+	For value size distributions, LO and HI are in bytes.
+	Empty lines and lines starting with # are ignored.
 
 	For example, a valid trace line might be
 		d=10m rw=0.5 qps=500 ad=poisson rkd=zipfian-0.99999 wkd=uniform
+
+SLO FORMAT
+	Service-level objectives are rules checked against each step of a run.
+	They are listed in the slo section of the config or in a file passed to
+	run -slo with one rule per line (empty lines and lines starting with #
+	are ignored). Each rule has the form
+		[read|write] METRIC OP VALUE [at step [OP] N]
+
+	METRIC is one of
+		pN              latency percentile, VALUE is a time.Duration
+		error rate      VALUE is a fraction or percentage (e.g. 0.1%)
+		achieved qps    successful requests per second, VALUE is in qps
+		                or relative to the step's qps (e.g. 95% target)
+	and OP is one of <, <=, > and >=.
+
+	Rules without read or write apply to all requests.
+	Rules without a step apply to all steps.
+	Rules relative to the target qps ignore closed-loop steps.
+
+	For example,
+		read p99 < 5ms at step >= 2
+		error rate < 0.1%
+		achieved qps >= 95% target
 `
 
 type nopStop struct{}
@@ -141,7 +408,7 @@ func (formatsCmd) Usage() string          { return "" }
 func (formatsCmd) SetFlags(*flag.FlagSet) {}
 
 func (formatsCmd) Execute(_ context.Context, _ *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
-	fmt.Fprintln(os.Stderr, formatsDoc)
+	fmt.Fprint(os.Stderr, formatsDoc)
 	return subcommands.ExitSuccess
 }
 
@@ -189,6 +456,10 @@ type loadCmd struct {
 	nshard int64
 	shardi int64
 
+	verify bool
+
+	coordAddr string
+
 	baseFlags
 }
 
@@ -201,6 +472,9 @@ For loading from multiple processes in parallel (potentially across machines),
 use either the -start and -count flags, or the -nshard and -shardi flags.
 If both pairs of flags are passed, one set will be used arbitrarily.
 
+With -coordinator, the config, shard and seed come from a fabbench coordinator
+and -config, -start, -count, -nshard, -shardi and -rand-seed-index are ignored.
+
 `
 }
 
@@ -216,12 +490,19 @@ func (c *loadCmd) SetFlags(fs *flag.FlagSet) {
 
 	fs.Int64Var(&c.nshard, "nshard", 0, "number of parallel worker processes (use either start+count, or nshard+shardi)")
 	fs.Int64Var(&c.shardi, "shardi", 0, "parallel worker process index (use either start+count, or nshard+shardi)")
+	fs.BoolVar(&c.verify, "verify", false, "write verifiable values (needed for run -verify)")
+	fs.StringVar(&c.coordAddr, "coordinator", "", "address of a fabbench coordinator to get work from")
 	c.baseFlags.SetFlags(fs)
 }
 
 func (c *loadCmd) Execute(ctx context.Context, fs *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	defer c.setupProfiling().Stop()
 	hosts := strings.Split(c.hostsCSV, ",")
+
+	if c.coordAddr != "" {
+		return c.executeCoordinated(ctx, hosts)
+	}
+
 	db, bcfg, err := loadConfig(hosts, c.configPath)
 	if err != nil {
 		log.Fatal(err)
@@ -253,6 +534,7 @@ func (c *loadCmd) Execute(ctx context.Context, fs *flag.FlagSet, args ...interfa
 		AllowedFailFrac: c.maxFailFrac,
 		LoadStart:       loadStart,
 		LoadCount:       loadCount,
+		Verify:          c.verify,
 	}
 
 	if err := l.Run(ctx); err != nil {
@@ -262,45 +544,223 @@ func (c *loadCmd) Execute(ctx context.Context, fs *flag.FlagSet, args ...interfa
 	return subcommands.ExitSuccess
 }
 
+func (c *loadCmd) executeCoordinated(ctx context.Context, hosts []string) subcommands.ExitStatus {
+	cl := dialCoordinator(ctx, c.coordAddr, coord.ModeLoad)
+	defer cl.Close()
+	a := cl.Assignment()
+
+	db, bcfg, err := dialConfig(hosts, a.Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	l := bench.Loader{
+		Log:             log.New(os.Stderr, "fabbench: load: ", log.LstdFlags),
+		DB:              db,
+		Config:          *bcfg,
+		Rand:            rand.New(rand.NewSource(a.Seed)),
+		NumWorkers:      c.workers,
+		AllowedFailFrac: c.maxFailFrac,
+		LoadStart:       a.LoadStart,
+		LoadCount:       a.LoadCount,
+		Verify:          c.verify,
+		Barrier:         cl,
+	}
+
+	err = l.Run(ctx)
+	if ferr := cl.Finish(ctx, nil, err); ferr != nil {
+		log.Printf("unable to report to coordinator: %v", ferr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return subcommands.ExitSuccess
+}
+
 type runCmd struct {
 	configPath    string
 	tracePath     string
 	outPre        string
 	hostsCSV      string
 	randSeedIndex int64
+	verify        bool
+	historyPath   string
+	staleSample   float64
+	coordAddr     string
+	nclients      int
+	clienti       int
+	sloPath       string
+	engine        string
+	poolWorkers   int
 	baseFlags
 }
 
 func (*runCmd) Name() string     { return "run" }
 func (*runCmd) Synopsis() string { return "run the workload" }
-func (*runCmd) Usage() string    { return "" }
+func (*runCmd) Usage() string {
+	return `fabbench run executes the trace against the database.
+
+With -verify, writes use verifiable values and reads check the values they
+get back. The read logs count how many reads returned values that were
+verified, corrupt, stale, or missing. A value is stale if this client had
+overwritten it before the read started, i.e. a write issued after the value's
+write was acknowledged was itself acknowledged before the read started. Values
+written by other clients are not checked for staleness. The data must have
+been loaded with load -verify.
+
+With -history, every request is logged to a gzipped history file that can be
+checked for linearizability with fabcheck.
+
+With -stale-sample, fabbench tracks writes to a sampled fraction of keys and
+records how stale reads of those keys are in a third set of logs (-st.gz).
+Reads are stale if a newer write was acknowledged before the read started,
+and staleness is measured from the earliest such acknowledgement.
+Fresh reads are recorded with a staleness of 0.
+
+For open-loop steps, how late requests are issued relative to their
+schedule is recorded in a fourth set of logs (-il.gz), along with per-step
+counts of the requests that were scheduled and issued. Per-op breakdowns are
+written to -il-sub/read.gz and -il-sub/write.gz. If many requests are issued
+late, or fewer are issued than scheduled, the client cannot keep up and is
+the bottleneck, and run logs a warning.
+
+Steps with maxinflight=queue-N record how long requests waited in the queue
+in a fifth set of logs (-qt.gz), broken down by op in -qt-sub/read.gz and
+-qt-sub/write.gz. Requests dropped by maxinflight=drop-N or queue-N are
+counted as "dropped" in the read and write logs.
+
+To run from multiple processes in parallel (potentially across machines),
+use the -nclients and -clienti flags. Each client runs its share of the QPS
+and closed-loop workers of every step so that the totals match the trace.
+Clients use different random seeds, and their logs record the client index.
+
+By default, every open-loop request is sent from a new goroutine.
+With -engine=pool, requests are instead sent by a fixed pool of -pool-workers
+workers that record results locally and merge them every second, which lets
+one client generate more load. Since each worker sends one request at a time,
+at most -pool-workers requests are outstanding; more are delayed and counted
+as issued late.
+
+With -coordinator, the config, trace and seed come from a fabbench coordinator
+and -config, -trace, -rand-seed-index, -nclients and -clienti are ignored.
+This client runs its share of each step, starting at the same time as the
+other clients, and uploads its logs to the coordinator. If -out is set, logs
+are also written locally.
+
+Once done, the results of each step are checked against the rules in the slo
+section of the config and in the -slo file (see formats), and run exits with
+a non-zero status if any are violated. With -coordinator, the coordinator
+checks the merged results instead. With -nclients, each client checks its own
+share.
+
+`
+}
 
 func (c *runCmd) SetFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.configPath, "config", "", "config file path")
 	fs.StringVar(&c.tracePath, "trace", "", "trace file path")
-	fs.StringVar(&c.outPre, "out", "", "output path prefix (will add -ro.gz and -wo.gz)")
+	fs.StringVar(&c.outPre, "out", "", "output path prefix (will add -ro.gz, -wo.gz, -il.gz, -qt.gz and -st.gz)")
 	fs.StringVar(&c.hostsCSV, "hosts", "", "host addresses (comma separated)")
 	fs.Int64Var(&c.randSeedIndex, "rand-seed-index", 0, "partial see to initialize rng (deterministic if 0)")
+	fs.BoolVar(&c.verify, "verify", false, "verify values returned by reads")
+	fs.StringVar(&c.historyPath, "history", "", "write a history of all requests to this path (gzipped)")
+	fs.Float64Var(&c.staleSample, "stale-sample", 0, "fraction of keys to measure read staleness for (0 to disable)")
+	fs.StringVar(&c.coordAddr, "coordinator", "", "address of a fabbench coordinator to get work from")
+	fs.IntVar(&c.nclients, "nclients", 1, "number of parallel client processes")
+	fs.IntVar(&c.clienti, "clienti", 0, "parallel client process index")
+	fs.StringVar(&c.sloPath, "slo", "", "file with slo rules to check")
+	fs.StringVar(&c.engine, "engine", "goroutine", "how to issue requests (goroutine or pool)")
+	fs.IntVar(&c.poolWorkers, "pool-workers", bench.DefaultPoolWorkers, "number of workers for -engine=pool")
 	c.baseFlags.SetFlags(fs)
 }
 
 func (c *runCmd) Execute(ctx context.Context, fs *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	defer c.setupProfiling().Stop()
-	hosts := strings.Split(c.hostsCSV, ",")
-	db, bcfg, err := loadConfig(hosts, c.configPath)
+	engine, err := bench.ParseEngine(c.engine)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	hosts := strings.Split(c.hostsCSV, ",")
 
-	trace, err := loadTrace(c.tracePath)
-	if err != nil {
-		log.Fatalf("unable to load trace: %v", err)
+	var (
+		cl    *coord.Client
+		db    db.DB
+		bcfg  *bench.Config
+		trace []bench.TraceStep
+		seed  int64
+		rules []*slo.Rule
+
+		nclients = c.nclients
+		clienti  = c.clienti
+	)
+	if c.coordAddr != "" {
+		cl = dialCoordinator(ctx, c.coordAddr, coord.ModeRun)
+		defer cl.Close()
+		a := cl.Assignment()
+		db, bcfg, err = dialConfig(hosts, a.Config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trace, err = bench.ParseTrace(strings.NewReader(a.Trace))
+		if err != nil {
+			log.Fatalf("unable to parse trace from coordinator: %v", err)
+		}
+		nclients, clienti = a.NumClients, a.Client
+		seed = a.Seed
+	} else {
+		if nclients < 1 || clienti < 0 || clienti >= nclients {
+			log.Fatalf("invalid client %d of %d", clienti, nclients)
+		}
+		cfgData, err := ioutil.ReadFile(c.configPath)
+		if err != nil {
+			log.Fatalf("unable to open config: %v", err)
+		}
+		rules, err = slo.Load(cfgData, c.sloPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		db, bcfg, err = dialConfig(hosts, cfgData)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trace, err = loadTrace(c.tracePath)
+		if err != nil {
+			log.Fatalf("unable to load trace: %v", err)
+		}
+		if c.randSeedIndex > 0 {
+			seed = time.Now().UnixNano() ^ c.randSeedIndex
+		}
+		// don't let clients issue the same requests
+		seed += int64(clienti)
 	}
+	defer db.Close()
+	trace = bench.ShardTrace(trace, nclients, clienti)
 
 	benchStart := time.Now()
-	readw := recorders.NewMultiLogWriter(c.outPre+"-ro", benchStart, gzip.BestSpeed)
-	writew := recorders.NewMultiLogWriter(c.outPre+"-wo", benchStart, gzip.BestSpeed)
+	mems := make(map[string]*recorders.MemoryMultiLogWriter)
+	newLogWriter := func(kind string) recorders.MultiLogWriter {
+		var w recorders.MultiLogWriter
+		if cl == nil || c.outPre != "" {
+			w = recorders.NewMultiLogWriter(c.outPre+"-"+kind, benchStart, gzip.BestSpeed)
+		}
+		if cl != nil || len(rules) > 0 {
+			mem := recorders.NewMemoryMultiLogWriter(benchStart)
+			mems[kind] = mem
+			if w == nil {
+				w = mem
+			} else {
+				w = recorders.TeeMultiLogWriter(w, mem)
+			}
+		}
+		if nclients > 1 {
+			w = recorders.CommentMultiLogWriter(w, recorders.ClientComment(clienti, nclients))
+		}
+		return w
+	}
+	readw := newLogWriter("ro")
+	writew := newLogWriter("wo")
+	issuew := newLogWriter("il")
 
 	hdrCfg := hdrhist.Config{
 		LowestDiscernible: int64(10 * time.Microsecond),
@@ -316,10 +776,40 @@ func (c *runCmd) Execute(ctx context.Context, fs *flag.FlagSet, args ...interfac
 
 	readRec := recorders.NewMultiLatency(hdrCfg, traceDescs)
 	writeRec := recorders.NewMultiLatency(hdrCfg, traceDescs)
+	issueRec := recorders.NewMultiLatency(hdrCfg, traceDescs)
 
-	var seed int64
-	if c.randSeedIndex > 0 {
-		seed = time.Now().UnixNano() ^ c.randSeedIndex
+	var staleRec *recorders.MultiLatency
+	var stalew recorders.MultiLogWriter
+	if c.staleSample > 0 {
+		staleRec = recorders.NewMultiLatency(hdrCfg, traceDescs)
+		stalew = newLogWriter("st")
+	}
+
+	var queueRec *recorders.MultiLatency
+	var queuew recorders.MultiLogWriter
+	for i := range trace {
+		if trace[i].QueuesRequests() {
+			queueRec = recorders.NewMultiLatency(hdrCfg, traceDescs)
+			queuew = newLogWriter("qt")
+			break
+		}
+	}
+
+	var hist *history.Writer
+	if c.historyPath != "" {
+		f, err := os.Create(c.historyPath)
+		if err != nil {
+			log.Fatalf("unable to create history: %v", err)
+		}
+		defer f.Close()
+		gw, _ := gzip.NewWriterLevel(f, gzip.BestSpeed)
+		defer gw.Close()
+		hist = history.NewWriter(gw, clientName())
+		defer func() {
+			if err := hist.Flush(); err != nil {
+				log.Printf("unable to write history: %v", err)
+			}
+		}()
 	}
 
 	r := bench.Runner{
@@ -328,17 +818,55 @@ func (c *runCmd) Execute(ctx context.Context, fs *flag.FlagSet, args ...interfac
 		Config:        *bcfg,
 		Rand:          rand.New(rand.NewSource(seed)),
 		Trace:         trace,
+		Verify:        c.verify,
+		VerifyClient:  clienti,
+		History:       hist,
 		ReadRecorder:  readRec,
 		ReadWriter:    readw,
 		WriteRecorder: writeRec,
 		WriteWriter:   writew,
+
+		StaleSampleFrac: c.staleSample,
+		StaleRecorder:   staleRec,
+		StaleWriter:     stalew,
+
+		IssueRecorder: issueRec,
+		IssueWriter:   issuew,
+		QueueRecorder: queueRec,
+		QueueWriter:   queuew,
+
+		Engine:      engine,
+		PoolWorkers: c.poolWorkers,
+	}
+	if cl != nil {
+		r.Barrier = cl
 	}
 
-	if err := r.Run(ctx); err != nil {
+	err = r.Run(ctx)
+	if cl != nil {
+		if ferr := cl.Finish(ctx, memLogs(mems), err); ferr != nil {
+			log.Printf("unable to upload logs to coordinator: %v", ferr)
+		}
+	}
+	if err != nil {
 		log.Print(err)
 		return subcommands.ExitFailure
 	}
 
+	if len(rules) > 0 {
+		read, err := readers.ReadLatency(mems["ro"].AllReader())
+		if err != nil {
+			log.Fatalf("unable to read results: %v", err)
+		}
+		write, err := readers.ReadLatency(mems["wo"].AllReader())
+		if err != nil {
+			log.Fatalf("unable to read results: %v", err)
+		}
+		if !checkSLO(rules, read, write) {
+			return subcommands.ExitFailure
+		}
+	}
+
 	return subcommands.ExitSuccess
 }
 
@@ -367,6 +895,7 @@ func main() {
 	subcommands.Register(new(mkTableCmd), "")
 	subcommands.Register(new(loadCmd), "")
 	subcommands.Register(new(runCmd), "")
+	subcommands.Register(new(coordinatorCmd), "")
 
 	flag.Parse()
 	os.Exit(int(subcommands.Execute(context.Background())))
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uluyol/fabbench/history"
+)
+
+var (
+	timeout = flag.Duration("timeout", time.Minute, "max time to spend checking any one key (0 for no limit)")
+	verbose = flag.Bool("v", false, "print the linearized prefix of each violation")
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fabcheck [flags] history.gz...")
+	fmt.Fprintln(os.Stderr, "\nChecks that the operations on each key in the histories are linearizable.")
+	fmt.Fprintln(os.Stderr, "Histories from multiple clients are merged, so client clocks must be synchronized.")
+	fmt.Fprintln(os.Stderr, "Exits with status 1 if any violations are found, or otherwise")
+	fmt.Fprintln(os.Stderr, "with status 3 if any keys could not be checked before the timeout.")
+	fmt.Fprintln(os.Stderr, "\nOUTPUT FORMAT")
+	fmt.Fprintln(os.Stderr, "\tviolation key=KEY op=OP value=VALUE call=UNIXNANOS return=UNIXNANOS client=CLIENT")
+	fmt.Fprintln(os.Stderr, "\ttimeout key=KEY nops=N")
+	fmt.Fprintln(os.Stderr, "\tchecked NKEYS keys NOPS ops: NVIOL violations NTIMEOUT timeouts")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetPrefix("fabcheck: ")
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+	}
+
+	var events []history.Event
+	for _, p := range flag.Args() {
+		evs, err := readFile(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		events = append(events, evs...)
+	}
+
+	byKey, err := history.Pair(events)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys := make([]string, 0, len(byKey))
+	nops := 0
+	for k, ops := range byKey {
+		keys = append(keys, k)
+		nops += len(ops)
+	}
+	sort.Strings(keys)
+
+	type result struct {
+		v   *history.Violation
+		err error
+	}
+	results := make([]result, len(keys))
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				var deadline time.Time
+				if *timeout > 0 {
+					deadline = time.Now().Add(*timeout)
+				}
+				v, err := history.CheckKey(byKey[keys[i]], deadline)
+				results[i] = result{v, err}
+			}
+		}()
+	}
+	for i := range keys {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	nviol := 0
+	ntimeout := 0
+	for i, res := range results {
+		switch {
+		case res.err == history.ErrTimeout:
+			ntimeout++
+			fmt.Fprintf(w, "timeout key=%s nops=%d\n", keys[i], len(byKey[keys[i]]))
+		case res.err != nil:
+			log.Fatalf("error checking key %s: %v", keys[i], res.err)
+		case res.v != nil:
+			nviol++
+			fprintOp(w, "violation", res.v.Op)
+			if *verbose {
+				for _, op := range res.v.Linearized {
+					fprintOp(w, "\tlinearized", op)
+				}
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "checked %d keys %d ops: %d violations %d timeouts\n", len(keys), nops, nviol, ntimeout)
+
+	switch {
+	case nviol > 0:
+		w.Flush()
+		os.Exit(1)
+	case ntimeout > 0:
+		w.Flush()
+		os.Exit(3)
+	}
+}
+
+func fprintOp(w *bufio.Writer, pre string, op history.Operation) {
+	ret := fmt.Sprint(op.Return)
+	if op.Indeterminate {
+		ret = "unknown"
+	}
+	fmt.Fprintf(w, "%s key=%s op=%s value=%s call=%d return=%s client=%s\n",
+		pre, op.Key, op.Op, op.Value, op.Call, ret, op.Client)
+}
+
+func readFile(p string) ([]history.Event, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	defer gr.Close()
+
+	evs, err := history.ReadEvents(bufio.NewReader(gr))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", p, err)
+	}
+	return evs, nil
+}
@@ -17,13 +17,15 @@ import (
 var (
 	start = flag.Int64("start", 0, "filter from this start time (in unix seconds)")
 	end   = flag.Int64("end", -1, "filter from this end time (in unix seconds)")
+	mbps  = flag.Bool("mbps", false, "add a column with MB read/written per second")
 )
 
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: fabloadts [flags] log.gz > cdfs.csv")
+	fmt.Fprintln(os.Stderr, "usage: fabloadts [flags] log.gz > load.csv")
 	fmt.Fprintln(os.Stderr, "\nOUTPUT FORMAT")
-	fmt.Fprintln(os.Stderr, "\t#start StepNum=N NumSamples=K UnixTime=Sec,Nano")
-	fmt.Fprintln(os.Stderr, "\tStepNum,Percenile,Micros")
+	fmt.Fprintln(os.Stderr, "\tUnixStart,OpsPerSec,ErrsPerSec")
+	fmt.Fprintln(os.Stderr, "or, with -mbps,")
+	fmt.Fprintln(os.Stderr, "\tUnixStart,OpsPerSec,ErrsPerSec,MBPerSec")
 	flag.PrintDefaults()
 	os.Exit(2)
 }
@@ -78,6 +80,7 @@ func procFile(p string, w io.Writer, startTime, endTime time.Time, accum *hdrhis
 	for i := range l.Hists {
 		hist := l.Hists[i]
 		errs := l.Errs[i]
+		nbytes := l.Bytes[i]
 
 		hstart, ok := hist.StartTime()
 		if !ok {
@@ -93,7 +96,11 @@ func procFile(p string, w io.Writer, startTime, endTime time.Time, accum *hdrhis
 		}
 
 		dur := float64(hend.Sub(hstart)) / float64(time.Second)
-		fmt.Fprintf(w, "%f,%f,%f\n", float64(hstart.UnixNano())/1e9, float64(hist.TotalCount())/dur, float64(errs)/dur)
+		if *mbps {
+			fmt.Fprintf(w, "%f,%f,%f,%f\n", float64(hstart.UnixNano())/1e9, float64(hist.TotalCount())/dur, float64(errs)/dur, float64(nbytes)/dur/1e6)
+		} else {
+			fmt.Fprintf(w, "%f,%f,%f\n", float64(hstart.UnixNano())/1e9, float64(hist.TotalCount())/dur, float64(errs)/dur)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uluyol/fabbench/readers"
+	"github.com/uluyol/fabbench/recorders"
+)
+
+var (
+	out    = flag.String("o", "", "output log or prefix (required)")
+	byTime = flag.Duration("bytime", 0, "align steps to wall-clock intervals of this length instead of by step index")
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fabmerge [flags] -o OUT RUN...")
+	fmt.Fprintln(os.Stderr, "\nMerges latency logs from multiple clients.")
+	fmt.Fprintln(os.Stderr, "Histograms are added and error, byte and other counts are summed.")
+	fmt.Fprintln(os.Stderr, "\nA RUN is either a log (ending in .gz) or the -out prefix passed to fabbench run.")
+	fmt.Fprintln(os.Stderr, "Logs are merged into OUT, and the logs in their -sub directories into OUT-sub.")
+	fmt.Fprintln(os.Stderr, "For prefixes, each kind of log (-ro.gz, -wo.gz, -st.gz, -il.gz, -qt.gz) that")
+	fmt.Fprintln(os.Stderr, "the runs have is merged into OUT-ro.gz, OUT-wo.gz, etc.")
+	fmt.Fprintln(os.Stderr, "\nBy default, steps are aligned by index, so all logs must have the same steps.")
+	fmt.Fprintln(os.Stderr, "With -bytime, each step is added to the wall-clock interval it starts in,")
+	fmt.Fprintln(os.Stderr, "so client clocks must be synchronized and intervals should not be shorter than steps.")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+var logKinds = []string{"ro", "wo", "st", "il", "qt"}
+
+func main() {
+	log.SetPrefix("fabmerge: ")
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 || *out == "" {
+		usage()
+	}
+
+	runs := flag.Args()
+	if strings.HasSuffix(runs[0], ".gz") {
+		var bases []string
+		for _, p := range runs {
+			if !strings.HasSuffix(p, ".gz") {
+				log.Fatalf("%s: cannot merge logs with run prefixes", p)
+			}
+			bases = append(bases, strings.TrimSuffix(p, ".gz"))
+		}
+		if err := mergeLogs(strings.TrimSuffix(*out, ".gz"), bases); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	found := false
+	for _, kind := range logKinds {
+		var bases []string
+		for _, p := range runs {
+			if _, err := os.Stat(p + "-" + kind + ".gz"); err == nil {
+				bases = append(bases, p+"-"+kind)
+			}
+		}
+		if len(bases) == 0 {
+			continue
+		}
+		if len(bases) != len(runs) {
+			log.Fatalf("only %d of %d runs have %s logs", len(bases), len(runs), kind)
+		}
+		found = true
+		if err := mergeLogs(*out+"-"+kind, bases); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if !found {
+		log.Fatal("no logs found")
+	}
+}
+
+// mergeLogs merges the logs base.gz and base-sub/NAME.gz of each of bases
+// and writes them to out.gz and out-sub/NAME.gz.
+func mergeLogs(out string, bases []string) error {
+	var all []*readers.Latency
+	subs := make(map[string][]*readers.Latency)
+	for _, base := range bases {
+		l, err := readers.ReadLatencyFile(base + ".gz")
+		if err != nil {
+			return err
+		}
+		all = append(all, l)
+		paths, err := filepath.Glob(filepath.Join(base+"-sub", "*.gz"))
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			l, err := readers.ReadLatencyFile(p)
+			if err != nil {
+				return err
+			}
+			name := strings.TrimSuffix(filepath.Base(p), ".gz")
+			subs[name] = append(subs[name], l)
+		}
+	}
+
+	var start time.Time
+	for _, l := range all {
+		for _, h := range l.Hists {
+			if t, ok := h.StartTime(); ok && (start.IsZero() || t.Before(start)) {
+				start = t
+			}
+		}
+	}
+
+	merged, err := merge(all)
+	if err != nil {
+		return fmt.Errorf("%s: %v", out, err)
+	}
+	w := recorders.NewMultiLogWriter(out, start, gzip.BestSpeed)
+	if err := w.WriteAll(merged.WriteTo); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(subs))
+	for name := range subs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// not every client needs to have every specific log (e.g. per host)
+		m, err := merge(subs[name])
+		if err != nil {
+			return fmt.Errorf("%s-sub/%s: %v", out, name, err)
+		}
+		if err := w.Write(name, m.WriteTo); err != nil {
+			return err
+		}
+	}
+	return w.Err()
+}
+
+func merge(ls []*readers.Latency) (*readers.Latency, error) {
+	if *byTime > 0 {
+		return readers.MergeByTime(ls, *byTime)
+	}
+	return readers.Merge(ls)
+}
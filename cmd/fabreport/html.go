@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uluyol/fabbench/readers"
+)
+
+type series struct {
+	name   string
+	xs, ys []float64
+	dashed bool
+}
+
+type lineChart struct {
+	title, xlabel, ylabel string
+	logX                  bool
+	series                []series
+}
+
+const (
+	chartW      = 640
+	chartH      = 300
+	chartLeft   = 60
+	chartRight  = 160
+	chartTop    = 30
+	chartBottom = 40
+)
+
+var palette = []string{
+	"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd",
+	"#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf",
+}
+
+func fmtTick(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// ticks returns about n round values spanning [lo, hi].
+func ticks(lo, hi float64, n int) []float64 {
+	span := hi - lo
+	mag := math.Pow(10, math.Floor(math.Log10(span/float64(n))))
+	var step float64
+	for _, m := range []float64{1, 2, 5, 10} {
+		step = mag * m
+		if span/step <= float64(n) {
+			break
+		}
+	}
+	var ts []float64
+	for t := math.Ceil(lo/step) * step; t <= hi+step/1e6; t += step {
+		ts = append(ts, t)
+	}
+	return ts
+}
+
+func (c *lineChart) writeSVG(w io.Writer) {
+	tx := func(x float64) float64 {
+		if c.logX {
+			return math.Log10(x)
+		}
+		return x
+	}
+
+	xmin, xmax := math.Inf(1), math.Inf(-1)
+	ymin, ymax := 0.0, math.Inf(-1)
+	for _, s := range c.series {
+		for i, x := range s.xs {
+			if c.logX && x <= 0 {
+				continue
+			}
+			xmin = math.Min(xmin, tx(x))
+			xmax = math.Max(xmax, tx(x))
+			ymin = math.Min(ymin, s.ys[i])
+			ymax = math.Max(ymax, s.ys[i])
+		}
+	}
+
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-size=\"11\">\n", chartW, chartH)
+	fmt.Fprintf(w, "<text x=\"%d\" y=\"18\" font-size=\"13\" font-weight=\"bold\">%s</text>\n", chartLeft, html.EscapeString(c.title))
+	if math.IsInf(xmin, 0) {
+		fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\">no data</text>\n</svg>\n", chartLeft, chartH/2)
+		return
+	}
+	if xmax == xmin {
+		xmin, xmax = xmin-1, xmax+1
+	}
+	if ymax == ymin {
+		ymax = ymin + 1
+	}
+	if c.logX {
+		xmin, xmax = math.Floor(xmin), math.Ceil(xmax)
+	}
+
+	pw := float64(chartW - chartLeft - chartRight)
+	ph := float64(chartH - chartTop - chartBottom)
+	px := func(x float64) float64 { return chartLeft + (tx(x)-xmin)/(xmax-xmin)*pw }
+	py := func(y float64) float64 { return chartTop + ph - (y-ymin)/(ymax-ymin)*ph }
+
+	// axes and grid
+	fmt.Fprintf(w, "<rect x=\"%d\" y=\"%d\" width=\"%g\" height=\"%g\" fill=\"none\" stroke=\"#000\"/>\n",
+		chartLeft, chartTop, pw, ph)
+	var xts []float64
+	if c.logX {
+		for e := xmin; e <= xmax; e++ {
+			xts = append(xts, math.Pow(10, e))
+		}
+	} else {
+		xts = ticks(xmin, xmax, 6)
+	}
+	for _, t := range xts {
+		x := px(t)
+		fmt.Fprintf(w, "<line x1=\"%.1f\" y1=\"%d\" x2=\"%.1f\" y2=\"%g\" stroke=\"#ddd\"/>\n", x, chartTop, x, chartTop+ph)
+		fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%g\" text-anchor=\"middle\">%s</text>\n", x, chartTop+ph+14, fmtTick(t))
+	}
+	for _, t := range ticks(ymin, ymax, 5) {
+		y := py(t)
+		fmt.Fprintf(w, "<line x1=\"%d\" y1=\"%.1f\" x2=\"%g\" y2=\"%.1f\" stroke=\"#ddd\"/>\n", chartLeft, y, chartLeft+pw, y)
+		fmt.Fprintf(w, "<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\">%s</text>\n", chartLeft-4, y+4, fmtTick(t))
+	}
+	fmt.Fprintf(w, "<text x=\"%g\" y=\"%d\" text-anchor=\"middle\">%s</text>\n",
+		chartLeft+pw/2, chartH-6, html.EscapeString(c.xlabel))
+	fmt.Fprintf(w, "<text transform=\"translate(14,%g) rotate(-90)\" text-anchor=\"middle\">%s</text>\n",
+		chartTop+ph/2, html.EscapeString(c.ylabel))
+
+	for i, s := range c.series {
+		color := palette[i%len(palette)]
+		var pts []string
+		for j, x := range s.xs {
+			if c.logX && x <= 0 {
+				continue
+			}
+			pts = append(pts, fmt.Sprintf("%.1f,%.1f", px(x), py(s.ys[j])))
+		}
+		dash := ""
+		if s.dashed {
+			dash = " stroke-dasharray=\"5,3\""
+		}
+		fmt.Fprintf(w, "<polyline fill=\"none\" stroke=\"%s\" stroke-width=\"1.5\"%s points=\"%s\"/>\n",
+			color, dash, strings.Join(pts, " "))
+		if len(pts) <= 50 {
+			for _, p := range pts {
+				xy := strings.Split(p, ",")
+				fmt.Fprintf(w, "<circle cx=\"%s\" cy=\"%s\" r=\"2\" fill=\"%s\"/>\n", xy[0], xy[1], color)
+			}
+		}
+		ly := chartTop + 10 + 16*i
+		lx := chartW - chartRight + 10
+		fmt.Fprintf(w, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\" stroke-width=\"2\"%s/>\n",
+			lx, ly, lx+16, ly, color, dash)
+		fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\">%s</text>\n", lx+20, ly+4, html.EscapeString(s.name))
+	}
+	fmt.Fprintln(w, "</svg>")
+}
+
+// stepTimes returns the middle of each step in seconds since the first started.
+// If start times are missing, steps are numbered instead.
+func stepTimes(l *readers.Latency) ([]float64, string) {
+	var first time.Time
+	mids := make([]float64, len(l.Hists))
+	for i, h := range l.Hists {
+		start, okStart := h.StartTime()
+		end, okEnd := h.EndTime()
+		if !okStart || !okEnd {
+			for i := range mids {
+				mids[i] = float64(i)
+			}
+			return mids, "step"
+		}
+		if i == 0 {
+			first = start
+		}
+		mids[i] = (start.Sub(first) + end.Sub(start)/2).Seconds()
+	}
+	return mids, "time (s)"
+}
+
+// targetQPS returns the QPS that step aims for in a log of the given kind.
+// ok is false for closed-loop steps and logs other than read and write.
+func targetQPS(l *readers.Latency, step int, kind string) (qps float64, ok bool) {
+	if l.Targets == nil || l.Targets[step] == nil {
+		return 0, false
+	}
+	t := l.Targets[step]
+	switch kind {
+	case "read":
+		return t.QPS * t.ReadRatio, true
+	case "write":
+		return t.QPS * (1 - t.ReadRatio), true
+	}
+	return 0, false
+}
+
+func (r *report) charts(pcts []float64, pctNames []string) []*lineChart {
+	mids, xlabel := stepTimes(r.lat)
+
+	cdf := &lineChart{title: "latency cdf", xlabel: "latency (ms)", ylabel: "fraction", logX: true}
+	for i, h := range r.lat.Hists {
+		s := series{name: "step " + strconv.Itoa(i)}
+		for _, v := range h.AllVals() {
+			if v.Count > 0 {
+				s.xs = append(s.xs, float64(v.Value)/float64(time.Millisecond))
+				s.ys = append(s.ys, v.Percentile/100)
+			}
+		}
+		cdf.series = append(cdf.series, s)
+	}
+
+	lat := &lineChart{title: "latency percentiles", xlabel: xlabel, ylabel: "latency (ms)"}
+	for j, n := range pctNames {
+		s := series{name: n}
+		for i, st := range r.Steps {
+			if st.Ops > 0 {
+				s.xs = append(s.xs, mids[i])
+				s.ys = append(s.ys, st.Percentiles[j])
+			}
+		}
+		lat.series = append(lat.series, s)
+	}
+
+	tput := &lineChart{title: "throughput", xlabel: xlabel, ylabel: "ops/s"}
+	achieved := series{name: "achieved"}
+	target := series{name: "target", dashed: true}
+	errs := &lineChart{title: "error rate", xlabel: xlabel, ylabel: "errors (%)"}
+	errSeries := series{name: "errors"}
+	for i, st := range r.Steps {
+		achieved.xs = append(achieved.xs, mids[i])
+		achieved.ys = append(achieved.ys, st.Throughput)
+		if qps, ok := targetQPS(r.lat, i, r.Log); ok {
+			target.xs = append(target.xs, mids[i])
+			target.ys = append(target.ys, qps)
+		}
+		errSeries.xs = append(errSeries.xs, mids[i])
+		errSeries.ys = append(errSeries.ys, 100*st.ErrorRate)
+	}
+	tput.series = append(tput.series, achieved)
+	if len(target.xs) > 0 {
+		tput.series = append(tput.series, target)
+	}
+	errs.series = append(errs.series, errSeries)
+
+	charts := []*lineChart{cdf, lat, tput, errs}
+	if len(r.subs) == 0 {
+		return charts
+	}
+
+	last := len(pcts) - 1
+	subTput := &lineChart{title: "throughput by sub-log", xlabel: xlabel, ylabel: "ops/s"}
+	subLat := &lineChart{title: pctNames[last] + " latency by sub-log", xlabel: xlabel, ylabel: "latency (ms)"}
+	for _, sub := range r.subs {
+		ts := series{name: sub.name}
+		ls := series{name: sub.name}
+		for i, st := range summarize(sub.lat, pcts) {
+			if i >= len(mids) {
+				break
+			}
+			ts.xs = append(ts.xs, mids[i])
+			ts.ys = append(ts.ys, st.Throughput)
+			if st.Ops > 0 {
+				ls.xs = append(ls.xs, mids[i])
+				ls.ys = append(ls.ys, st.Percentiles[last])
+			}
+		}
+		subTput.series = append(subTput.series, ts)
+		subLat.series = append(subLat.series, ls)
+	}
+	return append(charts, subTput, subLat)
+}
+
+func writeHTML(w io.Writer, reports []report, pcts []float64, pctNames []string) error {
+	fmt.Fprintln(w, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>fabreport</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: right; }
+.regressed { color: #c00; font-weight: bold; }
+svg { margin: 0 1em 1em 0; }
+</style>
+</head>
+<body>`)
+	for _, r := range reports {
+		fmt.Fprintf(w, "<h2>%s</h2>\n<table>\n<tr>", html.EscapeString(title(r)))
+		header, rows := table(r, pctNames)
+		for _, h := range header {
+			fmt.Fprintf(w, "<th>%s</th>", html.EscapeString(h))
+		}
+		fmt.Fprintln(w, "</tr>")
+		for i, row := range rows {
+			fmt.Fprint(w, "<tr>")
+			regressed := i < len(r.Deltas) && len(r.Deltas[i].Regressions) > 0
+			for j, c := range row {
+				if regressed && j == len(row)-1 {
+					fmt.Fprintf(w, "<td class=\"regressed\">%s</td>", html.EscapeString(c))
+				} else {
+					fmt.Fprintf(w, "<td>%s</td>", html.EscapeString(c))
+				}
+			}
+			fmt.Fprintln(w, "</tr>")
+		}
+		fmt.Fprintln(w, "</table>")
+		fmt.Fprintln(w, "<div>")
+		for _, c := range r.charts(pcts, pctNames) {
+			c.writeSVG(w)
+		}
+		fmt.Fprintln(w, "</div>")
+	}
+	_, err := fmt.Fprintln(w, "</body>\n</html>")
+	return err
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/uluyol/fabbench/readers"
+)
+
+var (
+	format       = flag.String("format", "text", "output format (text, csv, json, markdown, html)")
+	pctsFlag     = flag.String("p", "50,90,99,99.9", "percentiles to report (comma separated)")
+	basePath     = flag.String("base", "", "run to compare against")
+	threshold    = flag.Float64("threshold", 10, "flag percentiles that grow or throughput that shrinks by more than this percent")
+	errThreshold = flag.Float64("err-threshold", 0.1, "flag error rates that grow by more than this many percentage points")
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fabreport [flags] RUN...")
+	fmt.Fprintln(os.Stderr, "\nSummarizes each step of the runs: throughput of successful requests,")
+	fmt.Fprintln(os.Stderr, "error rate, and latency percentiles in milliseconds.")
+	fmt.Fprintln(os.Stderr, "\nA RUN is either a log (ending in .gz) or the -out prefix passed to fabbench run,")
+	fmt.Fprintln(os.Stderr, "in which case the -ro.gz, -wo.gz, -st.gz, -il.gz and -qt.gz logs that exist are")
+	fmt.Fprintln(os.Stderr, "reported. Logs are matched with the base run by kind (read, write, staleness,")
+	fmt.Fprintln(os.Stderr, "issue lag or queueing).")
+	fmt.Fprintln(os.Stderr, "\nWith -base, steps are compared to the same steps of the base run and")
+	fmt.Fprintln(os.Stderr, "regressions beyond the thresholds are flagged. If any are found, fabreport")
+	fmt.Fprintln(os.Stderr, "exits with status 1.")
+	fmt.Fprintln(os.Stderr, "\nWith -format html, fabreport writes a self-contained page with charts of")
+	fmt.Fprintln(os.Stderr, "latency CDFs, percentiles, throughput and errors over time, and breakdowns")
+	fmt.Fprintln(os.Stderr, "by sub-log (e.g. per host) from the -sub directories next to the logs.")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+type namedLog struct {
+	name string
+	lat  *readers.Latency
+	subs []namedLog
+}
+
+var logKinds = []struct{ suffix, name string }{
+	{"-ro.gz", "read"},
+	{"-wo.gz", "write"},
+	{"-st.gz", "staleness"},
+	{"-il.gz", "issue lag"},
+	{"-qt.gz", "queueing"},
+}
+
+func loadRun(p string, withSubs bool) ([]namedLog, error) {
+	var paths, names []string
+	if strings.HasSuffix(p, ".gz") {
+		name := "log"
+		for _, k := range logKinds {
+			if strings.HasSuffix(p, k.suffix) {
+				name = k.name
+			}
+		}
+		paths, names = []string{p}, []string{name}
+	} else {
+		for _, k := range logKinds {
+			if _, err := os.Stat(p + k.suffix); err == nil {
+				paths = append(paths, p+k.suffix)
+				names = append(names, k.name)
+			}
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("%s: no logs found", p)
+		}
+	}
+
+	var logs []namedLog
+	for i, path := range paths {
+		l, err := readers.ReadLatencyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		nl := namedLog{name: names[i], lat: l}
+		if withSubs {
+			nl.subs, err = loadSubs(strings.TrimSuffix(path, ".gz") + "-sub")
+			if err != nil {
+				return nil, err
+			}
+		}
+		logs = append(logs, nl)
+	}
+	return logs, nil
+}
+
+// loadSubs reads the specific logs in dir, if it exists.
+func loadSubs(dir string) ([]namedLog, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.gz"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var subs []namedLog
+	for _, p := range paths {
+		l, err := readers.ReadLatencyFile(p)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, namedLog{name: strings.TrimSuffix(filepath.Base(p), ".gz"), lat: l})
+	}
+	return subs, nil
+}
+
+type stepStats struct {
+	Step        int       `json:"step"`
+	Desc        string    `json:"desc"`
+	Seconds     float64   `json:"seconds"`
+	Ops         int64     `json:"ops"`
+	Errors      int64     `json:"errors"`
+	Throughput  float64   `json:"throughput"`
+	ErrorRate   float64   `json:"errorRate"`
+	Percentiles []float64 `json:"percentilesMs"`
+}
+
+func summarize(l *readers.Latency, pcts []float64) []stepStats {
+	stats := make([]stepStats, len(l.Hists))
+	for i, h := range l.Hists {
+		s := stepStats{
+			Step:   i,
+			Desc:   l.Descs[i],
+			Ops:    h.TotalCount(),
+			Errors: int64(l.Errs[i]),
+		}
+		start, okStart := h.StartTime()
+		end, okEnd := h.EndTime()
+		if okStart && okEnd {
+			s.Seconds = end.Sub(start).Seconds()
+		}
+		if s.Seconds > 0 {
+			s.Throughput = float64(s.Ops) / s.Seconds
+		}
+		if s.Ops+s.Errors > 0 {
+			s.ErrorRate = float64(s.Errors) / float64(s.Ops+s.Errors)
+		}
+		for _, p := range pcts {
+			var v float64
+			if s.Ops > 0 {
+				v = float64(h.PercentileVal(p).Value) / float64(time.Millisecond)
+			}
+			s.Percentiles = append(s.Percentiles, v)
+		}
+		stats[i] = s
+	}
+	return stats
+}
+
+// relDelta returns the change from base to v in percent.
+func relDelta(v, base float64) float64 {
+	if base == 0 {
+		if v == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return 100 * (v - base) / base
+}
+
+// delta is a change that is encoded as null in JSON if it is infinite.
+type delta float64
+
+func (d delta) MarshalJSON() ([]byte, error) {
+	if math.IsInf(float64(d), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(d))
+}
+
+type stepDelta struct {
+	Throughput  delta    `json:"throughputPct"`
+	ErrorRate   delta    `json:"errorRatePts"`
+	Percentiles []delta  `json:"percentilesPct"`
+	Regressions []string `json:"regressions,omitempty"`
+}
+
+func compare(s, base stepStats, pctNames []string) stepDelta {
+	d := stepDelta{
+		Throughput: delta(relDelta(s.Throughput, base.Throughput)),
+		ErrorRate:  delta(100 * (s.ErrorRate - base.ErrorRate)),
+	}
+	if float64(d.Throughput) < -*threshold {
+		d.Regressions = append(d.Regressions, "throughput")
+	}
+	if float64(d.ErrorRate) > *errThreshold {
+		d.Regressions = append(d.Regressions, "errors")
+	}
+	for i := range s.Percentiles {
+		pd := relDelta(s.Percentiles[i], base.Percentiles[i])
+		d.Percentiles = append(d.Percentiles, delta(pd))
+		if pd > *threshold {
+			d.Regressions = append(d.Regressions, pctNames[i])
+		}
+	}
+	return d
+}
+
+type report struct {
+	Run    string      `json:"run"`
+	Log    string      `json:"log"`
+	Steps  []stepStats `json:"steps"`
+	Base   []stepStats `json:"base,omitempty"`
+	Deltas []stepDelta `json:"deltas,omitempty"`
+
+	lat  *readers.Latency
+	subs []namedLog
+}
+
+func main() {
+	log.SetPrefix("fabreport: ")
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+	}
+
+	var pcts []float64
+	var pctNames []string
+	for _, f := range strings.Split(*pctsFlag, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || p < 0 || p > 100 {
+			log.Fatalf("invalid percentile %q", f)
+		}
+		pcts = append(pcts, p)
+		pctNames = append(pctNames, "p"+strconv.FormatFloat(p, 'f', -1, 64))
+	}
+
+	var base map[string][]stepStats
+	if *basePath != "" {
+		logs, err := loadRun(*basePath, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		base = make(map[string][]stepStats)
+		for _, l := range logs {
+			base[l.name] = summarize(l.lat, pcts)
+		}
+	}
+
+	var reports []report
+	nregress := 0
+	for _, p := range flag.Args() {
+		logs, err := loadRun(p, *format == "html")
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, l := range logs {
+			r := report{Run: p, Log: l.name, Steps: summarize(l.lat, pcts), lat: l.lat, subs: l.subs}
+			if base != nil {
+				r.Base = base[l.name]
+				if r.Base == nil && len(logs) == 1 && len(base) == 1 {
+					// compare single logs regardless of kind
+					for _, b := range base {
+						r.Base = b
+					}
+				}
+				if r.Base == nil {
+					log.Printf("%s: base run has no %s log", p, l.name)
+				} else if len(r.Base) != len(r.Steps) {
+					log.Printf("%s: %s log has %d steps, base has %d", p, l.name, len(r.Steps), len(r.Base))
+				}
+				for i := range r.Steps {
+					if i >= len(r.Base) {
+						break
+					}
+					d := compare(r.Steps[i], r.Base[i], pctNames)
+					nregress += len(d.Regressions)
+					r.Deltas = append(r.Deltas, d)
+				}
+			}
+			reports = append(reports, r)
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	var err error
+	switch *format {
+	case "text":
+		err = writeText(w, reports, pctNames)
+	case "markdown":
+		err = writeMarkdown(w, reports, pctNames)
+	case "csv":
+		err = writeCSV(w, reports, pctNames)
+	case "html":
+		err = writeHTML(w, reports, pcts, pctNames)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(reports)
+	default:
+		log.Fatalf("unknown format %q", *format)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if nregress > 0 {
+		os.Exit(1)
+	}
+}
+
+func fmtFloat(v float64, prec int) string {
+	if math.IsInf(v, 0) {
+		return "inf"
+	}
+	return strconv.FormatFloat(v, 'f', prec, 64)
+}
+
+func fmtDelta(d delta) string {
+	v := float64(d)
+	if v >= 0 {
+		return "+" + fmtFloat(v, 1)
+	}
+	return fmtFloat(v, 1)
+}
+
+// table returns the header and rows for r.
+// If r has deltas, values are followed by their change from the base
+// and a final column lists the regressions.
+func table(r report, pctNames []string) ([]string, [][]string) {
+	header := []string{"step", "secs", "ops", "ops/s", "err%"}
+	for _, n := range pctNames {
+		header = append(header, n+"(ms)")
+	}
+	if r.Deltas != nil {
+		header = append(header, "regressions")
+	}
+
+	var rows [][]string
+	for i, s := range r.Steps {
+		var d *stepDelta
+		if i < len(r.Deltas) {
+			d = &r.Deltas[i]
+		}
+		row := []string{
+			strconv.Itoa(s.Step),
+			fmtFloat(s.Seconds, 1),
+			strconv.FormatInt(s.Ops, 10),
+			fmtFloat(s.Throughput, 1),
+			fmtFloat(100*s.ErrorRate, 2),
+		}
+		if d != nil {
+			row[3] += " (" + fmtDelta(d.Throughput) + "%)"
+			row[4] += " (" + fmtDelta(d.ErrorRate) + ")"
+		}
+		for j, p := range s.Percentiles {
+			v := fmtFloat(p, 3)
+			if d != nil {
+				v += " (" + fmtDelta(d.Percentiles[j]) + "%)"
+			}
+			row = append(row, v)
+		}
+		if r.Deltas != nil {
+			var regs string
+			if d != nil {
+				regs = strings.Join(d.Regressions, ",")
+			}
+			row = append(row, regs)
+		}
+		rows = append(rows, row)
+	}
+	return header, rows
+}
+
+func title(r report) string {
+	if strings.HasSuffix(r.Run, ".gz") {
+		return r.Run
+	}
+	return r.Run + " " + r.Log
+}
+
+func writeText(w io.Writer, reports []report, pctNames []string) error {
+	for i, r := range reports {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "== %s ==\n", title(r))
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		header, rows := table(r, pctNames)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMarkdown(w io.Writer, reports []report, pctNames []string) error {
+	for i, r := range reports {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "### %s\n\n", title(r))
+		header, rows := table(r, pctNames)
+		fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+		fmt.Fprintf(w, "|%s\n", strings.Repeat(" ---: |", len(header)))
+		for _, row := range rows {
+			if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | ")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeCSV(w io.Writer, reports []report, pctNames []string) error {
+	cw := csv.NewWriter(w)
+	header := []string{"run", "log", "step", "desc", "seconds", "ops", "errors", "throughput", "error_rate"}
+	for _, n := range pctNames {
+		header = append(header, n+"_ms")
+	}
+	hasBase := false
+	for _, r := range reports {
+		hasBase = hasBase || r.Deltas != nil
+	}
+	if hasBase {
+		header = append(header, "throughput_delta_pct", "error_rate_delta_pts")
+		for _, n := range pctNames {
+			header = append(header, n+"_delta_pct")
+		}
+		header = append(header, "regressions")
+	}
+	cw.Write(header)
+
+	for _, r := range reports {
+		for i, s := range r.Steps {
+			row := []string{
+				r.Run,
+				r.Log,
+				strconv.Itoa(s.Step),
+				s.Desc,
+				fmtFloat(s.Seconds, 3),
+				strconv.FormatInt(s.Ops, 10),
+				strconv.FormatInt(s.Errors, 10),
+				fmtFloat(s.Throughput, 3),
+				fmtFloat(s.ErrorRate, 6),
+			}
+			for _, p := range s.Percentiles {
+				row = append(row, fmtFloat(p, 3))
+			}
+			if hasBase {
+				if i < len(r.Deltas) {
+					d := r.Deltas[i]
+					row = append(row, fmtFloat(float64(d.Throughput), 2), fmtFloat(float64(d.ErrorRate), 3))
+					for _, p := range d.Percentiles {
+						row = append(row, fmtFloat(float64(p), 2))
+					}
+					row = append(row, strings.Join(d.Regressions, " "))
+				} else {
+					row = append(row, make([]string, 3+len(pctNames))...)
+				}
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/uluyol/fabbench/readers"
+	"github.com/uluyol/fabbench/slo"
+)
+
+var (
+	configPath = flag.String("config", "", "config file with an slo section")
+	rulesPath  = flag.String("rules", "", "file with slo rules, one per line")
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fabslo [-config PATH] [-rules PATH] PREFIX")
+	fmt.Fprintln(os.Stderr, "\nChecks the logs PREFIX-ro.gz and PREFIX-wo.gz written by fabbench run")
+	fmt.Fprintln(os.Stderr, "against the rules in the slo section of the config and in the rules file.")
+	fmt.Fprintln(os.Stderr, "Violations are printed and fabslo exits with status 1 if there are any.")
+	fmt.Fprintln(os.Stderr, "See fabbench formats for the rule format.")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetPrefix("fabslo: ")
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 || (*configPath == "" && *rulesPath == "") {
+		usage()
+	}
+
+	var cfgData []byte
+	if *configPath != "" {
+		var err error
+		cfgData, err = ioutil.ReadFile(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	rules, err := slo.Load(cfgData, *rulesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pre := flag.Arg(0)
+	read, err := readers.ReadLatencyFile(pre + "-ro.gz")
+	if err != nil {
+		log.Fatal(err)
+	}
+	write, err := readers.ReadLatencyFile(pre + "-wo.gz")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	vs, err := slo.Check(rules, read, write)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, v := range vs {
+		fmt.Println(v)
+	}
+	if len(vs) > 0 {
+		os.Exit(1)
+	}
+}
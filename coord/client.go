@@ -0,0 +1,83 @@
+package coord
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// A Client is a benchmark client controlled by a Coordinator.
+// It implements bench.StepBarrier.
+type Client struct {
+	conn *conn
+	a    Assignment
+}
+
+// Dial registers with the coordinator at addr
+// and waits until it sends an assignment.
+// name identifies the client in logs.
+func Dial(ctx context.Context, addr, mode, name string) (*Client, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: newConn(nc)}
+	if err := c.conn.send(&message{Type: msgRegister, Mode: mode, Name: name}); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	m, err := c.conn.expect(ctx, msgAssign)
+	if err != nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("unable to get assignment: %v", err)
+	}
+	if m.Assign == nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("got empty assignment")
+	}
+	c.a = *m.Assign
+	return c, nil
+}
+
+func (c *Client) Assignment() *Assignment { return &c.a }
+
+// WaitStep tells the coordinator that the client is ready for step
+// and waits until the step should start.
+func (c *Client) WaitStep(ctx context.Context, step int) error {
+	if err := c.conn.send(&message{Type: msgReady, Step: step}); err != nil {
+		return err
+	}
+	m, err := c.conn.expect(ctx, msgStart)
+	if err != nil {
+		return err
+	}
+	if m.Step != step {
+		return fmt.Errorf("waiting for step %d, coordinator started %d", step, m.Step)
+	}
+	t := time.NewTimer(time.Until(m.At))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Finish uploads logs along with the error (if any) that the client ended with.
+// It returns once the coordinator has received them.
+func (c *Client) Finish(ctx context.Context, logs map[string][]byte, runErr error) error {
+	m := message{Type: msgResults, Logs: logs}
+	if runErr != nil {
+		m.Err = runErr.Error()
+	}
+	if err := c.conn.send(&m); err != nil {
+		return err
+	}
+	_, err := c.conn.expect(ctx, msgDone)
+	return err
+}
+
+func (c *Client) Close() error { return c.conn.Close() }
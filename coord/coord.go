@@ -0,0 +1,131 @@
+// Package coord coordinates benchmark clients running on multiple machines.
+//
+// A Coordinator listens for clients over TCP.
+// Once all expected clients have registered,
+// each is sent an Assignment with the config, trace, seed and shard to use.
+// Before each step, clients tell the coordinator that they are ready.
+// Once all are, the coordinator picks a wall-clock time for the step to start
+// and sends it to every client.
+// At the end, clients upload their logs to the coordinator.
+//
+// Messages are JSON objects, one per line.
+// Since steps start at wall-clock times,
+// client clocks must be synchronized (e.g. with NTP).
+package coord
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	ModeLoad = "load"
+	ModeRun  = "run"
+)
+
+// An Assignment tells a client what to do.
+type Assignment struct {
+	Client     int             `json:"client"`
+	NumClients int             `json:"numClients"`
+	Config     json.RawMessage `json:"config"`
+	Trace      string          `json:"trace,omitempty"`
+	Seed       int64           `json:"seed"`
+
+	// records to load
+	LoadStart int64 `json:"loadStart"`
+	LoadCount int64 `json:"loadCount"`
+}
+
+const (
+	msgRegister = "register"
+	msgAssign   = "assign"
+	msgReady    = "ready"
+	msgStart    = "start"
+	msgResults  = "results"
+	msgDone     = "done"
+	msgError    = "error"
+)
+
+type message struct {
+	Type   string            `json:"type"`
+	Mode   string            `json:"mode,omitempty"`
+	Name   string            `json:"name,omitempty"`
+	Assign *Assignment       `json:"assign,omitempty"`
+	Step   int               `json:"step,omitempty"`
+	At     time.Time         `json:"at,omitempty"`
+	Logs   map[string][]byte `json:"logs,omitempty"`
+	Err    string            `json:"err,omitempty"`
+}
+
+type conn struct {
+	c   net.Conn
+	w   *bufio.Writer
+	enc *json.Encoder
+	dec *json.Decoder
+}
+
+func newConn(c net.Conn) *conn {
+	w := bufio.NewWriter(c)
+	return &conn{
+		c:   c,
+		w:   w,
+		enc: json.NewEncoder(w),
+		dec: json.NewDecoder(bufio.NewReader(c)),
+	}
+}
+
+func (c *conn) send(m *message) error {
+	if err := c.enc.Encode(m); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *conn) recv() (*message, error) {
+	var m message
+	if err := c.dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m.Type == msgError {
+		return nil, fmt.Errorf("remote error: %s", m.Err)
+	}
+	return &m, nil
+}
+
+// recvCtx is like recv but gives up when ctx is done.
+func (c *conn) recvCtx(ctx context.Context) (*message, error) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			c.c.SetReadDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	m, err := c.recv()
+	close(done)
+	<-stopped
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return m, err
+}
+
+func (c *conn) expect(ctx context.Context, typ string) (*message, error) {
+	m, err := c.recvCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if m.Type != typ {
+		return nil, fmt.Errorf("expected %s message, got %s", typ, m.Type)
+	}
+	return m, nil
+}
+
+func (c *conn) Close() error { return c.c.Close() }
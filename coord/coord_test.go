@@ -0,0 +1,307 @@
+package coord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newCoordinator(t *testing.T, mode string, n int) *Coordinator {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	return &Coordinator{
+		Listener:    ln,
+		Mode:        mode,
+		NumClients:  n,
+		Config:      []byte(`{"workload":{"recordCount":10}}`),
+		Trace:       "d=1s qps=10",
+		RecordCount: 10,
+		StartDelay:  50 * time.Millisecond,
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	const (
+		nclients = 3
+		nsteps   = 3
+	)
+	c := newCoordinator(t, ModeRun, nclients)
+	addr := c.Listener.Addr().String()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	starts := make([][]time.Time, nclients)
+	errs := make([]error, nclients)
+	seeds := make(map[int64]bool)
+	var mu sync.Mutex
+	for i := 0; i < nclients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cl, err := Dial(ctx, addr, ModeRun, fmt.Sprintf("c%d", i))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer cl.Close()
+			a := cl.Assignment()
+			if a.NumClients != nclients || a.Trace != c.Trace || string(a.Config) != string(c.Config) {
+				errs[i] = fmt.Errorf("bad assignment: %+v", a)
+				return
+			}
+			mu.Lock()
+			seeds[a.Seed] = true
+			mu.Unlock()
+			for step := 0; step < nsteps; step++ {
+				// stagger clients so that the barrier matters
+				time.Sleep(time.Duration(a.Client) * 10 * time.Millisecond)
+				if err := cl.WaitStep(ctx, step); err != nil {
+					errs[i] = err
+					return
+				}
+				starts[a.Client] = append(starts[a.Client], time.Now())
+			}
+			logs := map[string][]byte{"ro": []byte(cl.Assignment().Trace)}
+			errs[i] = cl.Finish(ctx, logs, nil)
+		}(i)
+	}
+
+	results, err := c.Run(ctx)
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("client %d: %v", i, err)
+		}
+	}
+	if len(seeds) != nclients {
+		t.Errorf("want %d different seeds, got %v", nclients, seeds)
+	}
+	for step := 0; step < nsteps; step++ {
+		var min, max time.Time
+		for i := range starts {
+			if len(starts[i]) != nsteps {
+				t.Fatalf("client %d: want %d steps, got %d", i, nsteps, len(starts[i]))
+			}
+			s := starts[i][step]
+			if min.IsZero() || s.Before(min) {
+				min = s
+			}
+			if max.IsZero() || s.After(max) {
+				max = s
+			}
+		}
+		if d := max.Sub(min); d > 15*time.Millisecond {
+			t.Errorf("step %d: clients started %v apart", step, d)
+		}
+	}
+	for i, res := range results {
+		if res.Client != i || res.Err != "" || string(res.Logs["ro"]) != c.Trace {
+			t.Errorf("bad result for client %d: %+v", i, res)
+		}
+	}
+}
+
+func TestRunClientFails(t *testing.T) {
+	t.Parallel()
+	c := newCoordinator(t, ModeRun, 2)
+	addr := c.Listener.Addr().String()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		cl, err := Dial(ctx, addr, ModeRun, "good")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer cl.Close()
+		for step := 0; step < 3; step++ {
+			if err := cl.WaitStep(ctx, step); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if err := cl.Finish(ctx, nil, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		cl, err := Dial(ctx, addr, ModeRun, "bad")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer cl.Close()
+		if err := cl.WaitStep(ctx, 0); err != nil {
+			t.Error(err)
+			return
+		}
+		// the remaining steps must not wait on this client
+		if err := cl.Finish(ctx, nil, errors.New("db is down")); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	results, err := c.Run(ctx)
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	nfailed := 0
+	for _, res := range results {
+		if res.Err != "" {
+			nfailed++
+		}
+	}
+	if nfailed != 1 {
+		t.Errorf("want 1 failed client, got %d", nfailed)
+	}
+}
+
+func TestRunReadyClientFails(t *testing.T) {
+	t.Parallel()
+	c := newCoordinator(t, ModeRun, 3)
+	addr := c.Listener.Addr().String()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var slowReady, fastStart time.Time
+	run := func(name string, f func(cl *Client) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cl, err := Dial(ctx, addr, ModeRun, name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer cl.Close()
+			if err := cl.WaitStep(ctx, 0); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := f(cl); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}()
+	}
+	run("fails", func(cl *Client) error {
+		// ready for step 1, then fail before it starts
+		if err := cl.conn.send(&message{Type: msgReady, Step: 1}); err != nil {
+			return err
+		}
+		return cl.Finish(ctx, nil, errors.New("db is down"))
+	})
+	run("fast", func(cl *Client) error {
+		if err := cl.WaitStep(ctx, 1); err != nil {
+			return err
+		}
+		fastStart = time.Now()
+		return cl.Finish(ctx, nil, nil)
+	})
+	run("slow", func(cl *Client) error {
+		time.Sleep(200 * time.Millisecond)
+		slowReady = time.Now()
+		if err := cl.WaitStep(ctx, 1); err != nil {
+			return err
+		}
+		return cl.Finish(ctx, nil, nil)
+	})
+
+	_, err := c.Run(ctx)
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	if fastStart.Before(slowReady) {
+		t.Errorf("step 1 started at %v, before the last client was ready at %v", fastStart, slowReady)
+	}
+}
+
+func TestLoadShards(t *testing.T) {
+	t.Parallel()
+	const nclients = 4
+	c := newCoordinator(t, ModeLoad, nclients)
+	addr := c.Listener.Addr().String()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resC := make(chan error, 1)
+	go func() {
+		_, err := c.Run(ctx)
+		resC <- err
+	}()
+
+	// wrong mode is rejected and does not count as a client
+	if _, err := Dial(ctx, addr, ModeRun, "wrong"); err == nil {
+		t.Error("want error registering run client with load coordinator")
+	}
+
+	var wg sync.WaitGroup
+	loaded := make([]int, c.RecordCount)
+	var mu sync.Mutex
+	for i := 0; i < nclients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cl, err := Dial(ctx, addr, ModeLoad, fmt.Sprintf("c%d", i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer cl.Close()
+			a := cl.Assignment()
+			mu.Lock()
+			for j := a.LoadStart; j < a.LoadStart+a.LoadCount; j++ {
+				loaded[j]++
+			}
+			mu.Unlock()
+			if err := cl.WaitStep(ctx, 0); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := cl.Finish(ctx, nil, nil); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	err := <-resC
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("coordinator failed: %v", err)
+	}
+	for i, n := range loaded {
+		if n != 1 {
+			t.Errorf("record %d loaded %d times", i, n)
+		}
+	}
+}
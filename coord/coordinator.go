@@ -0,0 +1,223 @@
+package coord
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/uluyol/fabbench/internal/ranges"
+)
+
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+const registerTimeout = 30 * time.Second
+
+type Coordinator struct {
+	_          struct{}
+	Log        Logger
+	Listener   net.Listener
+	Mode       string
+	NumClients int
+
+	// Config and Trace are sent to clients as is.
+	Config []byte
+	Trace  string
+
+	// Seed is used to pick a different seed for each client.
+	Seed int64
+
+	// RecordCount is split among clients when loading.
+	RecordCount int64
+
+	// StartDelay is how long after all clients are ready a step starts.
+	// It must be long enough to notify all clients.
+	StartDelay time.Duration
+}
+
+// A Result is what a client sent back at the end.
+type Result struct {
+	Client int
+	Name   string
+	Logs   map[string][]byte
+	Err    string // error the client ended with, if any
+}
+
+func (c *Coordinator) logf(format string, v ...interface{}) {
+	if c.Log != nil {
+		c.Log.Printf(format, v...)
+	}
+}
+
+type event struct {
+	client int
+	m      *message
+	err    error
+}
+
+// Run waits for clients to register, assigns them work,
+// coordinates the start of steps, and returns their results.
+// Run closes the listener.
+func (c *Coordinator) Run(ctx context.Context) ([]Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		c.Listener.Close()
+	}()
+
+	var clients []*conn
+	var names []string
+	defer func() {
+		for _, cn := range clients {
+			cn.Close()
+		}
+	}()
+
+	for len(clients) < c.NumClients {
+		nc, err := c.Listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		cn := newConn(nc)
+		regCtx, regCancel := context.WithTimeout(ctx, registerTimeout)
+		m, err := cn.expect(regCtx, msgRegister)
+		regCancel()
+		if err != nil {
+			c.logf("bad registration from %s: %v", nc.RemoteAddr(), err)
+			cn.Close()
+			continue
+		}
+		if m.Mode != c.Mode {
+			c.logf("rejecting %s: wants to %s", m.Name, m.Mode)
+			cn.send(&message{Type: msgError, Err: fmt.Sprintf("coordinator is running %s, not %s", c.Mode, m.Mode)})
+			cn.Close()
+			continue
+		}
+		c.logf("client %d registered: %s", len(clients), m.Name)
+		clients = append(clients, cn)
+		names = append(names, m.Name)
+	}
+
+	rng := rand.New(rand.NewSource(c.Seed))
+	var shards []ranges.WorkShard
+	if c.Mode == ModeLoad {
+		shards = ranges.SplitRecords(c.RecordCount, int64(c.NumClients))
+	}
+	for i, cn := range clients {
+		a := Assignment{
+			Client:     i,
+			NumClients: c.NumClients,
+			Config:     c.Config,
+			Trace:      c.Trace,
+			Seed:       rng.Int63(),
+		}
+		if shards != nil {
+			a.LoadStart = shards[i].Start
+			a.LoadCount = shards[i].Count
+		}
+		if err := cn.send(&message{Type: msgAssign, Assign: &a}); err != nil {
+			return nil, fmt.Errorf("unable to assign work to client %d (%s): %v", i, names[i], err)
+		}
+	}
+
+	events := make(chan event)
+	for i, cn := range clients {
+		go func(i int, cn *conn) {
+			for {
+				m, err := cn.recv()
+				select {
+				case events <- event{i, m, err}:
+				case <-ctx.Done():
+					return
+				}
+				if err != nil || m.Type == msgResults {
+					return
+				}
+			}
+		}(i, cn)
+	}
+
+	results := make([]Result, c.NumClients)
+	finished := make([]bool, c.NumClients)
+	active := c.NumClients
+	ready := make(map[int]map[int]bool) // step -> clients ready for it
+	started := make(map[int]bool)
+
+	// allReady reports whether every unfinished client is ready for step.
+	allReady := func(step int) bool {
+		for i := range clients {
+			if !finished[i] && !ready[step][i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// startReady starts all steps that every active client is ready for.
+	startReady := func() error {
+		for step := range ready {
+			if started[step] || !allReady(step) {
+				continue
+			}
+			started[step] = true
+			at := time.Now().Add(c.StartDelay)
+			c.logf("starting step %d at %s", step, at.Format(time.RFC3339Nano))
+			for i, cn := range clients {
+				if finished[i] {
+					continue
+				}
+				if err := cn.send(&message{Type: msgStart, Step: step, At: at}); err != nil {
+					return fmt.Errorf("unable to start step %d on client %d (%s): %v", step, i, names[i], err)
+				}
+			}
+		}
+		return nil
+	}
+
+	for active > 0 {
+		var ev event
+		select {
+		case ev = <-events:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if ev.err != nil {
+			return nil, fmt.Errorf("client %d (%s): %v", ev.client, names[ev.client], ev.err)
+		}
+		switch ev.m.Type {
+		case msgReady:
+			if ready[ev.m.Step] == nil {
+				ready[ev.m.Step] = make(map[int]bool)
+			}
+			ready[ev.m.Step][ev.client] = true
+		case msgResults:
+			results[ev.client] = Result{
+				Client: ev.client,
+				Name:   names[ev.client],
+				Logs:   ev.m.Logs,
+				Err:    ev.m.Err,
+			}
+			finished[ev.client] = true
+			if ev.m.Err != "" {
+				c.logf("client %d (%s) failed: %s", ev.client, names[ev.client], ev.m.Err)
+			} else {
+				c.logf("client %d (%s) done", ev.client, names[ev.client])
+			}
+			clients[ev.client].send(&message{Type: msgDone})
+			active--
+		default:
+			return nil, fmt.Errorf("client %d (%s): unexpected %s message", ev.client, names[ev.client], ev.m.Type)
+		}
+		if err := startReady(); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
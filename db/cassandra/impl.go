@@ -3,6 +3,7 @@ package cassandra
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/gocql/gocql"
 	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/internal/tlsconf"
 	"github.com/uluyol/fabbench/recorders"
 )
 
@@ -30,6 +32,10 @@ type conf struct {
 	ConnectTimeout       string `json:"connectTimeout"`
 	Timeout              string `json:"timeout"`
 
+	TLS      *tlsconf.Config `json:"tls,omitempty"`
+	Username string          `json:"username"`
+	Password string          `json:"password"`
+
 	TraceData *string `json:"traceData,omitempty"`
 	TraceRate *uint32 `json:"traceRate,omitempty"`
 }
@@ -194,6 +200,27 @@ func newClient(hosts []string, cfg *conf) (db.DB, error) {
 
 	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
 
+	if (cfg.Username != "" || cfg.Password != "") && cfg.TLS == nil {
+		// PasswordAuthenticator would send them in cleartext
+		return nil, errors.New("username and password require tls")
+	}
+	tlsCfg, err := cfg.TLS.Load()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls config: %v", err)
+	}
+	if tlsCfg != nil {
+		cluster.SslOpts = &gocql.SslOptions{
+			Config:                 tlsCfg,
+			EnableHostVerification: !tlsCfg.InsecureSkipVerify,
+		}
+	}
+	if cfg.Username != "" || cfg.Password != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: cfg.Username,
+			Password: cfg.Password,
+		}
+	}
+
 	// Test that we can create a session.
 	// We don't know if the Keyspace exists yet,
 	// so we can't actually create the session used for gets/puts now.
@@ -23,11 +23,30 @@ func (hi hostInfo) ID() string { return string(hi) }
 
 var errClosed = errors.New("db is closed")
 
-func (c *client) reqMeta() db.Meta {
+// pickedHostKey holds the index of the host chosen by PickHost.
+type pickedHostKey struct{}
+
+// pickHost returns the index of the host to send a request made with ctx to.
+func pickHost(ctx context.Context, n int) int {
+	if i, ok := ctx.Value(pickedHostKey{}).(int); ok && i < n {
+		return i
+	}
+	return rand.Intn(n)
+}
+
+func (c *client) PickHost(ctx context.Context, _ string) (context.Context, db.HostInfo) {
 	if len(c.hosts) == 0 {
-		return db.EmptyMeta()
+		return ctx, nil
 	}
 	i := rand.Intn(len(c.hosts))
+	return context.WithValue(ctx, pickedHostKey{}, i), hostInfo(c.hosts[i])
+}
+
+func (c *client) reqMeta(ctx context.Context) db.Meta {
+	if len(c.hosts) == 0 {
+		return db.EmptyMeta()
+	}
+	i := pickHost(ctx, len(c.hosts))
 	return db.MetaWithHostInfo(db.EmptyMeta(), hostInfo(c.hosts[i]))
 }
 
@@ -45,25 +64,53 @@ func (c *client) Init(_ context.Context) error {
 	return nil
 }
 
-func (c *client) Get(_ context.Context, key string) (string, db.Meta, error) {
+func (c *client) Get(ctx context.Context, key string) (string, db.Meta, error) {
 	if c.isClosed() {
 		return "", db.EmptyMeta(), errClosed
 	}
-	return key + "-value", c.reqMeta(), nil
+	return key + "-value", c.reqMeta(ctx), nil
 }
 
-func (c *client) Put(_ context.Context, key, val string) (db.Meta, error) {
+func (c *client) Put(ctx context.Context, key, val string) (db.Meta, error) {
 	if c.isClosed() {
 		return db.EmptyMeta(), errClosed
 	}
-	return c.reqMeta(), nil
+	return c.reqMeta(ctx), nil
+}
+
+type conf struct {
+	MaxQPS        *int               `json:"maxQPS,omitempty"`
+	Servers       int                `json:"servers"`
+	Service       string             `json:"service"`
+	HostVariation float64            `json:"hostVariation"`
+	HostFactors   map[string]float64 `json:"hostFactors"`
+	StallEvery    string             `json:"stallEvery"`
+	StallDuration string             `json:"stallDuration"`
+	Seed          int64              `json:"seed"`
+}
+
+// simOption returns the name of an option that is set
+// and only applies to simulated hosts, or "" if there are none.
+func (c *conf) simOption() string {
+	switch {
+	case c.Servers != 0:
+		return "servers"
+	case c.HostVariation != 0:
+		return "hostVariation"
+	case len(c.HostFactors) > 0:
+		return "hostFactors"
+	case c.StallEvery != "":
+		return "stallEvery"
+	case c.StallDuration != "":
+		return "stallDuration"
+	case c.Seed != 0:
+		return "seed"
+	}
+	return ""
 }
 
 func init() {
 	db.Register("dummy", func(hosts []string, data []byte) (db.DB, error) {
-		type conf struct {
-			MaxQPS *int `json:"maxQPS,omitempty"`
-		}
 		if len(data) == 0 {
 			data = []byte("{}")
 		}
@@ -71,13 +118,29 @@ func init() {
 		if err := json.Unmarshal(data, &cfg); err != nil {
 			return nil, fmt.Errorf("invalid dummy config: %v", err)
 		}
-		if cfg.MaxQPS == nil {
-			return &client{hosts: hosts}, nil
-		} else {
-			c := &rtClient{
-				Latency: time.Second / time.Duration(*cfg.MaxQPS),
+		if cfg.MaxQPS != nil {
+			if *cfg.MaxQPS <= 0 || cfg.Service != "" {
+				return nil, errors.New("invalid dummy config: maxQPS must be positive and cannot be used with service")
+			}
+			if cfg.Servers != 0 {
+				return nil, errors.New("invalid dummy config: servers cannot be used with maxQPS")
 			}
-			return c, nil
+			cfg.Servers = 1
+			cfg.Service = "const-" + (time.Second / time.Duration(*cfg.MaxQPS)).String()
+		}
+		if cfg.Service == "" {
+			if opt := cfg.simOption(); opt != "" {
+				return nil, fmt.Errorf("invalid dummy config: %s requires service or maxQPS", opt)
+			}
+			return &client{hosts: hosts}, nil
+		}
+		if cfg.Servers == 0 {
+			cfg.Servers = 1
+		}
+		m, err := newSimModel(hosts, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dummy config: %v", err)
 		}
+		return &simClient{m: m, named: len(hosts) > 0}, nil
 	})
 }
@@ -0,0 +1,238 @@
+package dummy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+// serviceDist is a distribution of service times.
+type serviceDist struct {
+	kind string
+	a, b time.Duration
+	p    float64 // sigma for lognormal, probability of b for bimodal
+}
+
+func parseServiceDist(s string) (serviceDist, error) {
+	fields := strings.Split(s, "-")
+	var want int
+	switch fields[0] {
+	case "const", "exp":
+		want = 2
+	case "lognormal":
+		want = 3
+	case "bimodal":
+		want = 4
+	default:
+		return serviceDist{}, fmt.Errorf("unknown service time dist: %s", s)
+	}
+	if len(fields) != want {
+		return serviceDist{}, fmt.Errorf("bad service time dist: %s", s)
+	}
+	d := serviceDist{kind: fields[0]}
+	var err error
+	if d.a, err = time.ParseDuration(fields[1]); err != nil || d.a < 0 {
+		return serviceDist{}, fmt.Errorf("bad service time in %s", s)
+	}
+	switch d.kind {
+	case "lognormal":
+		if d.p, err = strconv.ParseFloat(fields[2], 64); err != nil || d.p < 0 {
+			return serviceDist{}, fmt.Errorf("bad sigma in %s", s)
+		}
+	case "bimodal":
+		if d.b, err = time.ParseDuration(fields[2]); err != nil || d.b < 0 {
+			return serviceDist{}, fmt.Errorf("bad service time in %s", s)
+		}
+		if d.p, err = strconv.ParseFloat(fields[3], 64); err != nil || d.p < 0 || d.p > 1 {
+			return serviceDist{}, fmt.Errorf("bad probability in %s", s)
+		}
+	}
+	return d, nil
+}
+
+func (d serviceDist) next(rng *rand.Rand) time.Duration {
+	switch d.kind {
+	case "exp":
+		return time.Duration(rng.ExpFloat64() * float64(d.a))
+	case "lognormal":
+		return time.Duration(float64(d.a) * math.Exp(d.p*rng.NormFloat64()))
+	case "bimodal":
+		if rng.Float64() < d.p {
+			return d.b
+		}
+	}
+	return d.a
+}
+
+// simHost is a simulated host with a FCFS queue served by several servers.
+type simHost struct {
+	name   string
+	factor float64       // service time multiplier
+	phase  time.Duration // offset of stalls
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	freeAt []time.Time // when each server finishes its queued work
+}
+
+// simModel computes when requests complete without running them.
+type simModel struct {
+	service    serviceDist
+	stallEvery time.Duration
+	stallDur   time.Duration
+	epoch      time.Time
+	hosts      []*simHost
+}
+
+// schedule queues a request that arrives at h at now
+// and returns when it will complete.
+func (m *simModel) schedule(h *simHost, now time.Time) time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := 0
+	for i := range h.freeAt {
+		if h.freeAt[i].Before(h.freeAt[s]) {
+			s = i
+		}
+	}
+	start := now
+	if start.Before(h.freeAt[s]) {
+		start = h.freeAt[s]
+	}
+	end := m.stall(h, start, time.Duration(float64(m.service.next(h.rng))*h.factor))
+	h.freeAt[s] = end
+	return end
+}
+
+// stall returns when service of length d that is ready to start at start
+// ends on h. Service that is ready during a stall waits for it to finish,
+// and service is paused by every stall that interrupts it.
+func (m *simModel) stall(h *simHost, start time.Time, d time.Duration) time.Time {
+	if m.stallEvery <= 0 {
+		return start.Add(d)
+	}
+	first := m.epoch.Add(h.phase)
+	k := time.Duration(-1) // last stall that began before start
+	if off := start.Sub(first); off >= 0 {
+		k = off / m.stallEvery
+		if in := off - k*m.stallEvery; in < m.stallDur {
+			start = start.Add(m.stallDur - in)
+		}
+	}
+	end := start.Add(d)
+	for next := first.Add((k + 1) * m.stallEvery); next.Before(end); next = next.Add(m.stallEvery) {
+		end = end.Add(m.stallDur)
+	}
+	return end
+}
+
+type simClient struct {
+	m       *simModel
+	named   bool
+	_closed int32
+}
+
+func (c *simClient) isClosed() bool { return atomic.LoadInt32(&c._closed) != 0 }
+
+func (c *simClient) Close() error {
+	atomic.StoreInt32(&c._closed, 1)
+	return nil
+}
+
+func (c *simClient) Init(_ context.Context) error {
+	if c.isClosed() {
+		return errClosed
+	}
+	return nil
+}
+
+func (c *simClient) PickHost(ctx context.Context, _ string) (context.Context, db.HostInfo) {
+	if !c.named {
+		return ctx, nil
+	}
+	i := rand.Intn(len(c.m.hosts))
+	return context.WithValue(ctx, pickedHostKey{}, i), hostInfo(c.m.hosts[i].name)
+}
+
+func (c *simClient) doReq(ctx context.Context) (db.Meta, error) {
+	if c.isClosed() {
+		return db.EmptyMeta(), errClosed
+	}
+	h := c.m.hosts[pickHost(ctx, len(c.m.hosts))]
+	meta := db.EmptyMeta()
+	if c.named {
+		meta = db.MetaWithHostInfo(meta, hostInfo(h.name))
+	}
+	t := time.NewTimer(time.Until(c.m.schedule(h, time.Now())))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return meta, nil
+	case <-ctx.Done():
+		return meta, ctx.Err()
+	}
+}
+
+func (c *simClient) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	meta, err := c.doReq(ctx)
+	if err != nil {
+		return "", meta, err
+	}
+	return key + "-value", meta, nil
+}
+
+func (c *simClient) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	return c.doReq(ctx)
+}
+
+func newSimModel(hosts []string, cfg *conf) (*simModel, error) {
+	service, err := parseServiceDist(cfg.Service)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Servers < 1 {
+		return nil, errors.New("servers must be positive")
+	}
+	if cfg.HostVariation < 0 || cfg.HostVariation >= 1 {
+		return nil, errors.New("hostVariation must be in [0, 1)")
+	}
+	m := &simModel{service: service, epoch: time.Now()}
+	if cfg.StallEvery != "" {
+		if m.stallEvery, err = time.ParseDuration(cfg.StallEvery); err != nil || m.stallEvery <= 0 {
+			return nil, errors.New("stallEvery must be a positive duration")
+		}
+		if m.stallDur, err = time.ParseDuration(cfg.StallDuration); err != nil || m.stallDur <= 0 || m.stallDur >= m.stallEvery {
+			return nil, errors.New("stallDuration must be a positive duration less than stallEvery")
+		}
+	}
+
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	for _, name := range hosts {
+		h := &simHost{
+			name:   name,
+			factor: 1 + cfg.HostVariation*(2*rng.Float64()-1),
+			rng:    rand.New(rand.NewSource(rng.Int63())),
+			freeAt: make([]time.Time, cfg.Servers),
+		}
+		if f, ok := cfg.HostFactors[name]; ok {
+			h.factor = f
+		}
+		if m.stallEvery > 0 {
+			h.phase = time.Duration(rng.Int63n(int64(m.stallEvery)))
+		}
+		m.hosts = append(m.hosts, h)
+	}
+	return m, nil
+}
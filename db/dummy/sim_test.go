@@ -0,0 +1,239 @@
+package dummy
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+func TestParseServiceDist(t *testing.T) {
+	tests := []struct {
+		s    string
+		want serviceDist
+		bad  bool
+	}{
+		{s: "const-1ms", want: serviceDist{kind: "const", a: time.Millisecond}},
+		{s: "exp-250us", want: serviceDist{kind: "exp", a: 250 * time.Microsecond}},
+		{s: "lognormal-2ms-0.5", want: serviceDist{kind: "lognormal", a: 2 * time.Millisecond, p: 0.5}},
+		{s: "bimodal-1ms-20ms-0.01", want: serviceDist{kind: "bimodal", a: time.Millisecond, b: 20 * time.Millisecond, p: 0.01}},
+		{s: "uniform-1ms", bad: true},
+		{s: "const", bad: true},
+		{s: "exp-1ms-2ms", bad: true},
+		{s: "const-soon", bad: true},
+		{s: "lognormal-1ms-x", bad: true},
+		{s: "bimodal-1ms-2ms-1.5", bad: true},
+	}
+	for _, test := range tests {
+		got, err := parseServiceDist(test.s)
+		if test.bad {
+			if err == nil {
+				t.Errorf("%s: want error", test.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.s, err)
+		} else if got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestServiceDistMoments(t *testing.T) {
+	tests := []struct {
+		s         string
+		mean, p50 time.Duration
+	}{
+		{s: "const-1ms", mean: time.Millisecond, p50: time.Millisecond},
+		{s: "exp-1ms", mean: time.Millisecond, p50: 693147 * time.Nanosecond},            // ln(2) ms
+		{s: "lognormal-1ms-0.5", mean: 1133148 * time.Nanosecond, p50: time.Millisecond}, // exp(0.5^2/2) ms
+		{s: "bimodal-1ms-11ms-0.1", mean: 2 * time.Millisecond, p50: time.Millisecond},
+	}
+	const n = 100000
+	for _, test := range tests {
+		d, err := parseServiceDist(test.s)
+		if err != nil {
+			t.Fatalf("%s: %v", test.s, err)
+		}
+		rng := rand.New(rand.NewSource(1))
+		var sum time.Duration
+		var below int
+		for i := 0; i < n; i++ {
+			v := d.next(rng)
+			sum += v
+			if v <= test.p50 {
+				below++
+			}
+		}
+		if mean := sum / n; !near(mean, test.mean, 0.02) {
+			t.Errorf("%s: got mean %v, want %v", test.s, mean, test.mean)
+		}
+		if frac := float64(below) / n; frac < 0.49 {
+			t.Errorf("%s: %f of samples are <= %v, want at least half", test.s, frac, test.p50)
+		}
+	}
+}
+
+func near(got, want time.Duration, tol float64) bool {
+	return math.Abs(float64(got-want)) <= tol*float64(want)
+}
+
+// meanResponse feeds n Poisson arrivals at qps into a host of m
+// and returns the mean time they spend in the system.
+func meanResponse(m *simModel, qps float64, n int) time.Duration {
+	rng := rand.New(rand.NewSource(2))
+	now := m.epoch
+	var sum time.Duration
+	for i := 0; i < n; i++ {
+		now = now.Add(time.Duration(rng.ExpFloat64() / qps * float64(time.Second)))
+		sum += m.schedule(m.hosts[0], now).Sub(now)
+	}
+	return sum / time.Duration(n)
+}
+
+func TestSimModelQueueing(t *testing.T) {
+	// all at 1000 qps with each server busy half of the time
+	tests := []struct {
+		name    string
+		servers int
+		service string
+		want    float64
+	}{
+		// M/M/1: W = 1/(mu - lambda)
+		{"M/M/1", 1, "exp-500us", 1 / (2000.0 - 1000)},
+		// M/D/1: W = S + rho*S/(2(1-rho))
+		{"M/D/1", 1, "const-500us", 0.0005 + 0.5*0.0005/(2*0.5)},
+		// M/G/1 (Pollaczek-Khinchine): W = E[S] + lambda*E[S^2]/(2(1-rho))
+		{"M/G/1", 1, "bimodal-250us-2750us-0.1", 0.0005 + 1000*(0.9*0.25*0.25+0.1*2.75*2.75)*1e-6/(2*0.5)},
+		// M/M/2 with rho = 0.5: Erlang C = 1/3, Wq = C/(c*mu - lambda)
+		{"M/M/2", 2, "exp-1ms", 0.001 + (1.0/3)/(2000-1000)},
+	}
+	for _, test := range tests {
+		m, err := newSimModel(nil, &conf{Servers: test.servers, Service: test.service})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		want := time.Duration(test.want * float64(time.Second))
+		if got := meanResponse(m, 1000, 400000); !near(got, want, 0.05) {
+			t.Errorf("%s: got mean response time %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+func TestSimModelStalls(t *testing.T) {
+	m, err := newSimModel(nil, &conf{
+		Servers:       1,
+		Service:       "const-1ms",
+		StallEvery:    "100ms",
+		StallDuration: "10ms",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := m.hosts[0]
+	h.phase = 50 * time.Millisecond
+	at := func(d time.Duration) time.Time { return m.epoch.Add(d) }
+	tests := []struct {
+		arrive, want time.Duration
+	}{
+		{0, time.Millisecond},
+		{49*time.Millisecond + 500*time.Microsecond, 60*time.Millisecond + 500*time.Microsecond}, // interrupted by a stall
+		{55 * time.Millisecond, 61*time.Millisecond + 500*time.Microsecond},                      // queued behind it
+		{70 * time.Millisecond, 71 * time.Millisecond},
+		{155 * time.Millisecond, 161 * time.Millisecond}, // waits for a stall
+	}
+	for _, test := range tests {
+		if got := m.schedule(h, at(test.arrive)).Sub(m.epoch); got != test.want {
+			t.Errorf("arrive at %v: got done at %v, want %v", test.arrive, got, test.want)
+		}
+	}
+}
+
+func TestSimModelHosts(t *testing.T) {
+	hosts := []string{"a", "b", "c", "d"}
+	cfg := &conf{
+		Servers:       1,
+		Service:       "const-1ms",
+		HostVariation: 0.2,
+		HostFactors:   map[string]float64{"d": 3},
+		Seed:          7,
+	}
+	m, err := newSimModel(hosts, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, _ := newSimModel(hosts, cfg)
+	for i, h := range m.hosts {
+		if h.name != hosts[i] {
+			t.Errorf("host %d: got name %s, want %s", i, h.name, hosts[i])
+		}
+		if h.factor != m2.hosts[i].factor {
+			t.Errorf("host %s: factor %f differs across models with the same seed", h.name, h.factor)
+		}
+		if h.name == "d" {
+			if h.factor != 3 {
+				t.Errorf("host d: got factor %f, want 3", h.factor)
+			}
+		} else if h.factor < 0.8 || h.factor > 1.2 {
+			t.Errorf("host %s: got factor %f, want it in [0.8, 1.2]", h.name, h.factor)
+		}
+	}
+
+	bad := []conf{
+		{Servers: 0, Service: "const-1ms"},
+		{Servers: 1, Service: "const-1ms", HostVariation: 1},
+		{Servers: 1, Service: "const-1ms", StallEvery: "10ms"},
+		{Servers: 1, Service: "const-1ms", StallEvery: "10ms", StallDuration: "10ms"},
+	}
+	for _, cfg := range bad {
+		if _, err := newSimModel(hosts, &cfg); err == nil {
+			t.Errorf("%+v: want error", cfg)
+		}
+	}
+}
+
+func TestSimClient(t *testing.T) {
+	d, err := db.Dial("dummy", []string{"h1", "h2"}, []byte(`{"servers": 2, "service": "const-5ms"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	start := time.Now()
+	val, meta, err := d.Get(context.Background(), "k")
+	if err != nil || val != "k-value" {
+		t.Errorf("got %q, %v, want k-value", val, err)
+	}
+	if took := time.Since(start); took < 5*time.Millisecond {
+		t.Errorf("get took %v, want at least 5ms", took)
+	}
+	if hi, ok := db.GetHostInfo(meta); !ok || (hi.ID() != "h1" && hi.ID() != "h2") {
+		t.Errorf("got host info %v, want h1 or h2", hi)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.Put(ctx, "k", "v"); err == nil {
+		t.Error("want error with canceled context")
+	}
+
+	bad := []string{
+		`{"maxQPS": 0}`,
+		`{"maxQPS": 10, "service": "exp-1ms"}`,
+		`{"maxQPS": 10, "servers": 2}`,
+		`{"service": "nope"}`,
+		`{"servers": 2}`,
+		`{"hostVariation": 0.1}`,
+		`{"hostFactors": {"h1": 2}}`,
+		`{"stallEvery": "1s", "stallDuration": "10ms"}`,
+		`{"seed": 1}`,
+	}
+	for _, opts := range bad {
+		if _, err := db.Dial("dummy", nil, []byte(opts)); err == nil {
+			t.Errorf("%s: want error", opts)
+		}
+	}
+}
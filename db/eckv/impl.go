@@ -2,48 +2,211 @@ package eckv
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/uluyol/fabbench/db"
 	"github.com/uluyol/fabbench/db/eckv/internal/pb"
+	"github.com/uluyol/fabbench/internal/tlsconf"
 )
 
+type conf struct {
+	Balance  string          `json:"balance"`
+	TLS      *tlsconf.Config `json:"tls"`
+	Username string          `json:"username"`
+	Password string          `json:"password"`
+}
+
+// basicAuth sends a username and password with every request.
+// They are only sent over TLS.
+type basicAuth string
+
+func (a basicAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": string(a)}, nil
+}
+
+func (a basicAuth) RequireTransportSecurity() bool { return true }
+
+func dialOpts(cfg *conf) ([]grpc.DialOption, error) {
+	tlsCfg, err := cfg.TLS.Load()
+	if err != nil {
+		return nil, err
+	}
+	var opts []grpc.DialOption
+	if tlsCfg != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if cfg.Username != "" || cfg.Password != "" {
+		creds := base64.StdEncoding.EncodeToString([]byte(cfg.Username + ":" + cfg.Password))
+		opts = append(opts, grpc.WithPerRPCCredentials(basicAuth("Basic "+creds)))
+	}
+	return opts, nil
+}
+
+type hostInfo string
+
+func (hi hostInfo) ID() string { return string(hi) }
+
+type host struct {
+	addr        string
+	cc          *grpc.ClientConn
+	c           pb.ECKVClient
+	outstanding int64 // atomic
+}
+
+// A balancer picks the host to send each request to.
+type balancer func(hosts []*host) *host
+
+func roundRobin() balancer {
+	var next uint32
+	return func(hosts []*host) *host {
+		return hosts[int(atomic.AddUint32(&next, 1)-1)%len(hosts)]
+	}
+}
+
+func random() balancer {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(rand.Int63()))
+	return func(hosts []*host) *host {
+		mu.Lock()
+		i := rng.Intn(len(hosts))
+		mu.Unlock()
+		return hosts[i]
+	}
+}
+
+// leastOutstanding picks the host with the fewest requests in flight,
+// starting from a different host each time to break ties.
+func leastOutstanding() balancer {
+	var next uint32
+	return func(hosts []*host) *host {
+		start := int(atomic.AddUint32(&next, 1)-1) % len(hosts)
+		best := hosts[start]
+		bestN := atomic.LoadInt64(&best.outstanding)
+		for i := 1; i < len(hosts) && bestN > 0; i++ {
+			h := hosts[(start+i)%len(hosts)]
+			if n := atomic.LoadInt64(&h.outstanding); n < bestN {
+				best, bestN = h, n
+			}
+		}
+		return best
+	}
+}
+
+var balancers = map[string]func() balancer{
+	"round-robin":       roundRobin,
+	"random":            random,
+	"least-outstanding": leastOutstanding,
+}
+
 type client struct {
-	cc *grpc.ClientConn
-	c  pb.ECKVClient
+	hosts []*host
+	pick  balancer
 }
 
 func (c *client) Init(_ context.Context) error { return nil }
 
+// pickedHostKey holds the host chosen by PickHost.
+type pickedHostKey struct{}
+
+func (c *client) PickHost(ctx context.Context, _ string) (context.Context, db.HostInfo) {
+	h := c.pick(c.hosts)
+	return context.WithValue(ctx, pickedHostKey{}, h), hostInfo(h.addr)
+}
+
+// start picks the host for a request made with ctx, unless PickHost
+// already has. The caller must call done(h) when the request finishes.
+func (c *client) start(ctx context.Context) *host {
+	h, ok := ctx.Value(pickedHostKey{}).(*host)
+	if !ok {
+		h = c.pick(c.hosts)
+	}
+	atomic.AddInt64(&h.outstanding, 1)
+	return h
+}
+
+func done(h *host) { atomic.AddInt64(&h.outstanding, -1) }
+
+func (h *host) meta() db.Meta {
+	return db.MetaWithHostInfo(db.EmptyMeta(), hostInfo(h.addr))
+}
+
 func (c *client) Get(ctx context.Context, key string) (string, db.Meta, error) {
-	resp, err := c.c.Get(ctx, &pb.GetReq{Key: key})
+	h := c.start(ctx)
+	defer done(h)
+	resp, err := h.c.Get(ctx, &pb.GetReq{Key: key})
 	if err != nil {
-		return "", db.EmptyMeta(), err
+		return "", h.meta(), err
 	}
-	return string(resp.Val), db.EmptyMeta(), err
+	return string(resp.Val), h.meta(), err
 }
 
 func (c *client) Put(ctx context.Context, key, val string) (db.Meta, error) {
-	m := db.EmptyMeta()
-	_, err := c.c.Put(ctx, &pb.PutReq{Key: key, Val: []byte(val)})
-	return m, err
+	h := c.start(ctx)
+	defer done(h)
+	_, err := h.c.Put(ctx, &pb.PutReq{Key: key, Val: []byte(val)})
+	return h.meta(), err
 }
 
-func (c *client) Close() error { return c.cc.Close() }
+func (c *client) Close() error {
+	var err error
+	for _, h := range c.hosts {
+		if cerr := h.cc.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
 
 func makeClient(hosts []string, data []byte) (db.DB, error) {
-	if len(hosts) == 0 {
-		return nil, errors.New("no host")
+	var cfg conf
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid eckv config: %v", err)
+		}
 	}
-
-	cc, err := grpc.Dial(hosts[0], grpc.WithInsecure())
+	if cfg.Balance == "" {
+		cfg.Balance = "round-robin"
+	}
+	mkBalancer, ok := balancers[cfg.Balance]
+	if !ok {
+		return nil, fmt.Errorf("invalid eckv config: unknown balance policy %q", cfg.Balance)
+	}
+	if (cfg.Username != "" || cfg.Password != "") && cfg.TLS == nil {
+		// basic auth would send them in cleartext
+		return nil, errors.New("invalid eckv config: username and password require tls")
+	}
+	opts, err := dialOpts(&cfg)
 	if err != nil {
-		return nil, fmt.Errorf("unable to connect to host: %v", err)
+		return nil, fmt.Errorf("invalid eckv config: %v", err)
+	}
+
+	c := &client{pick: mkBalancer()}
+	for _, addr := range hosts {
+		if addr == "" {
+			continue
+		}
+		cc, err := grpc.Dial(addr, opts...)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("unable to connect to host %s: %v", addr, err)
+		}
+		c.hosts = append(c.hosts, &host{addr: addr, cc: cc, c: pb.NewECKVClient(cc)})
+	}
+	if len(c.hosts) == 0 {
+		return nil, errors.New("no host")
 	}
-	return &client{cc: cc, c: pb.NewECKVClient(cc)}, nil
+	return c, nil
 }
 
 func init() {
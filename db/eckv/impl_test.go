@@ -0,0 +1,267 @@
+package eckv
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/db/eckv/internal/pb"
+	"github.com/uluyol/fabbench/internal/tlsconf/tlstest"
+)
+
+type fakeServer struct {
+	delay time.Duration
+	reqs  int64 // atomic
+
+	mu   sync.Mutex
+	m    map[string][]byte
+	auth []string // authorization metadata of the last request
+}
+
+func (s *fakeServer) Get(ctx context.Context, req *pb.GetReq) (*pb.GetResp, error) {
+	atomic.AddInt64(&s.reqs, 1)
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &pb.GetResp{Val: s.m[req.Key]}, nil
+}
+
+func (s *fakeServer) Put(ctx context.Context, req *pb.PutReq) (*pb.PutResp, error) {
+	atomic.AddInt64(&s.reqs, 1)
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[req.Key] = req.Val
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		s.auth = md["authorization"]
+	}
+	return &pb.PutResp{}, nil
+}
+
+func (s *fakeServer) CAS(ctx context.Context, req *pb.CASReq) (*pb.CASResp, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (s *fakeServer) CVAS(ctx context.Context, req *pb.CVASReq) (*pb.CASResp, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+// startServers starts a server for each delay and returns their addresses.
+func startServers(t *testing.T, delays ...time.Duration) ([]*fakeServer, []string, func()) {
+	return startServersOpts(t, nil, delays...)
+}
+
+func startServersOpts(t *testing.T, opts []grpc.ServerOption, delays ...time.Duration) ([]*fakeServer, []string, func()) {
+	var (
+		fakes []*fakeServer
+		addrs []string
+		srvs  []*grpc.Server
+	)
+	for _, d := range delays {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unable to listen: %v", err)
+		}
+		f := &fakeServer{delay: d, m: make(map[string][]byte)}
+		s := grpc.NewServer(opts...)
+		pb.RegisterECKVServer(s, f)
+		go s.Serve(ln)
+		fakes = append(fakes, f)
+		addrs = append(addrs, ln.Addr().String())
+		srvs = append(srvs, s)
+	}
+	return fakes, addrs, func() {
+		for _, s := range srvs {
+			s.Stop()
+		}
+	}
+}
+
+func TestBalance(t *testing.T) {
+	ctx := context.Background()
+	fakes, addrs, stop := startServers(t, 0, 0, 0)
+	defer stop()
+
+	for _, policy := range []string{"round-robin", "random", "least-outstanding"} {
+		for _, f := range fakes {
+			atomic.StoreInt64(&f.reqs, 0)
+		}
+		d, err := db.Dial("eckv", addrs, []byte(fmt.Sprintf(`{"balance": %q}`, policy)))
+		if err != nil {
+			t.Fatalf("%s: unable to dial: %v", policy, err)
+		}
+		served := make(map[string]int)
+		for i := 0; i < 300; i++ {
+			m, err := d.Put(ctx, "k", "v")
+			if err != nil {
+				t.Fatalf("%s: unable to put: %v", policy, err)
+			}
+			hi, ok := db.GetHostInfo(m)
+			if !ok {
+				t.Fatalf("%s: missing host info", policy)
+			}
+			served[hi.ID()]++
+		}
+		for i, addr := range addrs {
+			n := atomic.LoadInt64(&fakes[i].reqs)
+			if n < 50 || n > 150 {
+				t.Errorf("%s: %s got %d of 300 requests, want about 100", policy, addr, n)
+			}
+			if int64(served[addr]) != n {
+				t.Errorf("%s: %s served %d requests but host info says %d", policy, addr, n, served[addr])
+			}
+		}
+		d.Close()
+	}
+}
+
+func TestPickHost(t *testing.T) {
+	_, addrs, stop := startServers(t, 0, 0)
+	defer stop()
+	d, err := db.Dial("eckv", addrs, nil)
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer d.Close()
+	for i := 0; i < 10; i++ {
+		ctx, want := d.(db.HostPicker).PickHost(context.Background(), "k")
+		m, err := d.Put(ctx, "k", "v")
+		if err != nil {
+			t.Fatalf("unable to put: %v", err)
+		}
+		if hi, ok := db.GetHostInfo(m); !ok || hi.ID() != want.ID() {
+			t.Errorf("put %d: served by %v, want picked host %s", i, hi, want.ID())
+		}
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	ctx := context.Background()
+	fakes, addrs, stop := startServers(t, 0, 50*time.Millisecond)
+	defer stop()
+	d, err := db.Dial("eckv", addrs, []byte(`{"balance": "least-outstanding"}`))
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer d.Close()
+
+	// with 4 concurrent clients sending requests back to back,
+	// the slow host should rarely have more than 1 in flight,
+	// while round-robin would send it half of them
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				d.Get(ctx, "k")
+			}
+		}()
+	}
+	wg.Wait()
+	fast, slow := atomic.LoadInt64(&fakes[0].reqs), atomic.LoadInt64(&fakes[1].reqs)
+	if slow > fast/3 {
+		t.Errorf("slow host got %d requests and fast host %d, want the fast one to get most", slow, fast)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eckv-tls-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files, err := tlstest.WriteFiles(dir)
+	if err != nil {
+		t.Fatalf("unable to write certs: %v", err)
+	}
+	srvCfg, err := files.ServerConfig(true)
+	if err != nil {
+		t.Fatalf("unable to load server config: %v", err)
+	}
+	fakes, addrs, stop := startServersOpts(t,
+		[]grpc.ServerOption{grpc.Creds(credentials.NewTLS(srvCfg))}, 0)
+	defer stop()
+
+	tests := []struct {
+		name string
+		opts string
+		ok   bool
+	}{
+		{
+			name: "server name",
+			opts: fmt.Sprintf(`{"tls": {"ca": %q, "cert": %q, "key": %q, "serverName": "localhost"}}`,
+				files.CA, files.ClientCert, files.ClientKey),
+			ok: true,
+		},
+		{
+			name: "mtls",
+			opts: fmt.Sprintf(`{"tls": {"ca": %q, "cert": %q, "key": %q}, "username": "u", "password": "p:w"}`,
+				files.CA, files.ClientCert, files.ClientKey),
+			ok: true,
+		},
+		{name: "insecure", opts: `{}`},
+		{name: "no client cert", opts: fmt.Sprintf(`{"tls": {"ca": %q}}`, files.CA)},
+		{
+			name: "unknown CA",
+			opts: fmt.Sprintf(`{"tls": {"cert": %q, "key": %q}}`, files.ClientCert, files.ClientKey),
+		},
+		{
+			name: "wrong server name",
+			opts: fmt.Sprintf(`{"tls": {"ca": %q, "cert": %q, "key": %q, "serverName": "db.example.com"}}`,
+				files.CA, files.ClientCert, files.ClientKey),
+		},
+	}
+	for _, test := range tests {
+		d, err := db.Dial("eckv", addrs, []byte(test.opts))
+		if err != nil {
+			t.Fatalf("%s: unable to dial: %v", test.name, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err = d.Put(ctx, "k", test.name)
+		cancel()
+		d.Close()
+		if (err == nil) != test.ok {
+			t.Errorf("%s: put got error %v, want success: %t", test.name, err, test.ok)
+		}
+	}
+
+	fakes[0].mu.Lock()
+	defer fakes[0].mu.Unlock()
+	if got := string(fakes[0].m["k"]); got != "mtls" {
+		t.Errorf("got value %q, want %q", got, "mtls")
+	}
+	// base64("u:p:w")
+	if want := "Basic dTpwOnc="; len(fakes[0].auth) != 1 || fakes[0].auth[0] != want {
+		t.Errorf("got authorization %v, want %s", fakes[0].auth, want)
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	tests := []struct {
+		hosts []string
+		opts  string
+	}{
+		{[]string{""}, `{}`},
+		{[]string{"localhost:1"}, `{"balance": "fastest"}`},
+		{[]string{"localhost:1"}, `{"tls": {"ca": "/nonexistent/ca.pem"}}`},
+		{[]string{"localhost:1"}, `{"tls": {"cert": "/nonexistent/client.pem"}}`},
+		{[]string{"localhost:1"}, `{"username": "u", "password": "p:w"}`},
+	}
+	for _, test := range tests {
+		if _, err := db.Dial("eckv", test.hosts, []byte(test.opts)); err == nil {
+			t.Errorf("%v %s: want error", test.hosts, test.opts)
+		}
+	}
+}
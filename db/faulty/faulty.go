@@ -0,0 +1,252 @@
+// Package faulty provides a DB that wraps another and injects faults
+// into the requests sent to it.
+package faulty
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/internal/jsontime"
+	"github.com/uluyol/fabbench/internal/splitmix"
+)
+
+var errInjected = errors.New("faulty: injected error")
+
+// faults are the faults that may be injected into a request.
+type faults struct {
+	ErrorRate    float64           `json:"errorRate"`
+	SpikeRate    float64           `json:"spikeRate"`
+	SpikeLatency jsontime.Duration `json:"spikeLatency"`
+	DownHosts    []string          `json:"downHosts"`
+}
+
+func (f *faults) validate() error {
+	if f.ErrorRate < 0 || f.ErrorRate > 1 {
+		return errors.New("errorRate must be in [0, 1]")
+	}
+	if f.SpikeRate < 0 || f.SpikeRate > 1 {
+		return errors.New("spikeRate must be in [0, 1]")
+	}
+	if f.SpikeRate > 0 && f.SpikeLatency <= 0 {
+		return errors.New("spikeLatency must be positive if spikeRate is set")
+	}
+	return nil
+}
+
+func (f *faults) isDown(host string) bool {
+	for _, h := range f.DownHosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// A window is when additional faults are injected:
+// either during the given trace steps or from Start to End
+// after the first request.
+type window struct {
+	Steps []int             `json:"steps"`
+	Start jsontime.Duration `json:"start"`
+	End   jsontime.Duration `json:"end"`
+	faults
+}
+
+func (w *window) active(step int, hasStep bool, sinceStart time.Duration) bool {
+	if len(w.Steps) > 0 {
+		if !hasStep {
+			return false
+		}
+		for _, s := range w.Steps {
+			if s == step {
+				return true
+			}
+		}
+		return false
+	}
+	return time.Duration(w.Start) <= sinceStart && sinceStart < time.Duration(w.End)
+}
+
+type conf struct {
+	DB struct {
+		Name    string          `json:"name"`
+		Options json.RawMessage `json:"options"`
+	} `json:"db"`
+	Seed    int64    `json:"seed"`
+	Windows []window `json:"windows"`
+	faults
+}
+
+// hasDownHosts reports whether any requests may go to a down host.
+func (c *conf) hasDownHosts() bool {
+	if len(c.DownHosts) > 0 {
+		return true
+	}
+	for i := range c.Windows {
+		if len(c.Windows[i].DownHosts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type client struct {
+	db.DB
+	cfg    conf
+	picker db.HostPicker // nil unless there are down hosts
+
+	nreqs int64 // atomic
+	start int64 // atomic, unix nanos of first request
+}
+
+// rands returns uniform values in [0, 1) for the next request.
+// They depend only on the seed and the number of earlier requests,
+// so the same faults are injected in the same order in every run.
+func (c *client) rands() (errU, spikeU float64) {
+	n := atomic.AddInt64(&c.nreqs, 1)
+	s := splitmix.Mix(uint64(c.cfg.Seed) ^ splitmix.Mix(uint64(n)))
+	return float64(s>>11) / (1 << 53), float64(splitmix.Mix(s)>>11) / (1 << 53)
+}
+
+// active returns the faults that apply to a request made now with ctx.
+func (c *client) active(ctx context.Context) []*faults {
+	now := time.Now().UnixNano()
+	atomic.CompareAndSwapInt64(&c.start, 0, now)
+	sinceStart := time.Duration(now - atomic.LoadInt64(&c.start))
+	step, hasStep := db.StepFromContext(ctx)
+
+	fs := []*faults{&c.cfg.faults}
+	for i := range c.cfg.Windows {
+		if c.cfg.Windows[i].active(step, hasStep, sinceStart) {
+			fs = append(fs, &c.cfg.Windows[i].faults)
+		}
+	}
+	return fs
+}
+
+// before injects faults before a request is sent.
+// If it returns an error, the request should fail without being sent.
+func (c *client) before(ctx context.Context, fs []*faults) error {
+	errU, spikeU := c.rands()
+	var spike time.Duration
+	for _, f := range fs {
+		// each set of faults applies independently
+		if errU < f.ErrorRate {
+			return errInjected
+		}
+		errU = (errU - f.ErrorRate) / (1 - f.ErrorRate)
+		if spikeU < f.SpikeRate {
+			if d := time.Duration(f.SpikeLatency); d > spike {
+				spike = d
+			}
+			spikeU /= f.SpikeRate
+		} else {
+			spikeU = (spikeU - f.SpikeRate) / (1 - f.SpikeRate)
+		}
+	}
+	if spike > 0 {
+		t := time.NewTimer(spike)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// route picks the host for a request for key made with ctx.
+// If the host is down, it returns an error and the request
+// should fail without being sent.
+func (c *client) route(ctx context.Context, key string, fs []*faults) (context.Context, db.Meta, error) {
+	m := db.EmptyMeta()
+	if c.picker == nil {
+		return ctx, m, nil
+	}
+	ctx, hi := c.picker.PickHost(ctx, key)
+	if hi == nil {
+		return ctx, m, nil
+	}
+	m = db.MetaWithHostInfo(m, hi)
+	for _, f := range fs {
+		if f.isDown(hi.ID()) {
+			return ctx, m, fmt.Errorf("faulty: host %s is down", hi.ID())
+		}
+	}
+	return ctx, m, nil
+}
+
+func (c *client) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	fs := c.active(ctx)
+	if err := c.before(ctx, fs); err != nil {
+		return "", db.EmptyMeta(), err
+	}
+	ctx, m, err := c.route(ctx, key, fs)
+	if err != nil {
+		return "", m, err
+	}
+	return c.DB.Get(ctx, key)
+}
+
+func (c *client) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	fs := c.active(ctx)
+	if err := c.before(ctx, fs); err != nil {
+		return db.EmptyMeta(), err
+	}
+	ctx, m, err := c.route(ctx, key, fs)
+	if err != nil {
+		return m, err
+	}
+	return c.DB.Put(ctx, key, val)
+}
+
+func makeDB(hosts []string, data []byte) (db.DB, error) {
+	var cfg conf
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid faulty config: %v", err)
+	}
+	if cfg.DB.Name == "" || cfg.DB.Name == "faulty" {
+		return nil, errors.New("invalid faulty config: must wrap another db")
+	}
+	if err := cfg.faults.validate(); err != nil {
+		return nil, fmt.Errorf("invalid faulty config: %v", err)
+	}
+	for i := range cfg.Windows {
+		w := &cfg.Windows[i]
+		if err := w.validate(); err != nil {
+			return nil, fmt.Errorf("invalid faulty config: window %d: %v", i, err)
+		}
+		if len(w.Steps) == 0 && w.End <= w.Start {
+			return nil, fmt.Errorf("invalid faulty config: window %d: need steps or end after start", i)
+		}
+	}
+	if cfg.hasDownHosts() && len(hosts) == 0 {
+		return nil, errors.New("invalid faulty config: downHosts requires hosts")
+	}
+	inner, err := db.Dial(cfg.DB.Name, hosts, []byte(cfg.DB.Options))
+	if err != nil {
+		return nil, err
+	}
+	c := &client{DB: inner, cfg: cfg}
+	if cfg.hasDownHosts() {
+		// the host must be known before a request is sent
+		// so that requests to down hosts are never sent
+		p, ok := inner.(db.HostPicker)
+		if !ok {
+			inner.Close()
+			return nil, fmt.Errorf("invalid faulty config: downHosts is unsupported by %s", cfg.DB.Name)
+		}
+		c.picker = p
+	}
+	return c, nil
+}
+
+func init() {
+	db.Register("faulty", makeDB)
+}
@@ -0,0 +1,157 @@
+package faulty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+	_ "github.com/uluyol/fabbench/db/dummy"
+	_ "github.com/uluyol/fabbench/db/memkv"
+)
+
+func mustDial(t *testing.T, hosts []string, cfg string) db.DB {
+	d, err := db.Dial("faulty", hosts, []byte(cfg))
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	return d
+}
+
+// failures returns which of n gets fail.
+func failures(ctx context.Context, d db.DB, n int) []bool {
+	fails := make([]bool, n)
+	for i := range fails {
+		_, _, err := d.Get(ctx, "k")
+		fails[i] = err != nil
+	}
+	return fails
+}
+
+func count(bs []bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+func TestErrorRate(t *testing.T) {
+	t.Parallel()
+	const cfg = `{"db": {"name": "dummy"}, "seed": 5, "errorRate": 0.1}`
+	ctx := context.Background()
+	a := failures(ctx, mustDial(t, nil, cfg), 10000)
+	if n := count(a); n < 900 || n > 1100 {
+		t.Errorf("got %d errors in 10000 requests, want about 1000", n)
+	}
+	b := failures(ctx, mustDial(t, nil, cfg), 10000)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("request %d: runs with the same seed differ", i)
+		}
+	}
+	c := failures(ctx, mustDial(t, nil, `{"db": {"name": "dummy"}, "seed": 6, "errorRate": 0.1}`), 10000)
+	same := true
+	for i := range a {
+		same = same && a[i] == c[i]
+	}
+	if same {
+		t.Error("runs with different seeds are the same")
+	}
+}
+
+func TestSpikes(t *testing.T) {
+	t.Parallel()
+	d := mustDial(t, nil, `{"db": {"name": "dummy"}, "spikeRate": 0.5, "spikeLatency": "20ms"}`)
+	ctx := context.Background()
+	var spikes int
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		if _, err := d.Put(ctx, "k", "v"); err != nil {
+			t.Fatalf("unable to put: %v", err)
+		}
+		if time.Since(start) >= 20*time.Millisecond {
+			spikes++
+		}
+	}
+	if spikes < 3 || spikes > 17 {
+		t.Errorf("got %d spikes in 20 requests, want about 10", spikes)
+	}
+}
+
+func TestDownHosts(t *testing.T) {
+	t.Parallel()
+	d := mustDial(t, []string{"a", "b"}, `{
+		"db": {"name": "dummy", "options": {"service": "const-5ms"}},
+		"downHosts": ["b"]
+	}`)
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		start := time.Now()
+		_, m, err := d.Get(ctx, "k")
+		hi, ok := db.GetHostInfo(m)
+		if !ok {
+			t.Fatal("missing host info")
+		}
+		if (hi.ID() == "b") != (err != nil) {
+			t.Errorf("request to %s: got err %v", hi.ID(), err)
+		}
+		if err != nil && time.Since(start) >= 5*time.Millisecond {
+			t.Errorf("request to down host %s was sent", hi.ID())
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	t.Parallel()
+	d := mustDial(t, nil, `{
+		"db": {"name": "dummy"},
+		"windows": [
+			{"steps": [1, 3], "errorRate": 1},
+			{"start": "50ms", "end": "100ms", "errorRate": 1}
+		]
+	}`)
+	ctx := context.Background()
+	for step, want := range []bool{false, true, false, true} {
+		_, _, err := d.Get(db.ContextWithStep(ctx, step), "k")
+		if (err != nil) != want {
+			t.Errorf("step %d: got err %v, want err: %t", step, err, want)
+		}
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, _, err := d.Get(ctx, "k"); err == nil {
+		t.Error("want error in time window")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, _, err := d.Get(ctx, "k"); err != nil {
+		t.Errorf("got error %v after time window", err)
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	t.Parallel()
+	bad := []string{
+		`{}`,
+		`{"db": {"name": "faulty"}}`,
+		`{"db": {"name": "nope"}}`,
+		`{"db": {"name": "dummy"}, "errorRate": 2}`,
+		`{"db": {"name": "dummy"}, "spikeRate": 0.1}`,
+		`{"db": {"name": "dummy"}, "windows": [{"errorRate": 1}]}`,
+		`{"db": {"name": "dummy"}, "windows": [{"start": "1x", "end": "2s"}]}`,
+	}
+	for _, cfg := range bad {
+		if _, err := db.Dial("faulty", nil, []byte(cfg)); err == nil {
+			t.Errorf("%s: want error", cfg)
+		}
+	}
+
+	// down hosts must be known before requests are sent
+	if _, err := db.Dial("faulty", nil, []byte(`{"db": {"name": "dummy"}, "downHosts": ["a"]}`)); err == nil {
+		t.Error("want error for downHosts without hosts")
+	}
+	if _, err := db.Dial("faulty", []string{"a"}, []byte(`{"db": {"name": "memkv"}, "windows": [{"steps": [1], "downHosts": ["a"]}]}`)); err == nil {
+		t.Error("want error for downHosts with a db that cannot pick hosts")
+	}
+}
@@ -0,0 +1,71 @@
+package filekv
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cache is an LRU cache of values that holds up to max bytes of keys and values.
+// Values are tagged with their offset in the log, so that stale values
+// are never returned, even if they are added after newer ones.
+type cache struct {
+	mu    sync.Mutex
+	max   int
+	size  int
+	lru   *list.List // of *cacheEntry, most recently used first
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key, val string
+	off      int64
+}
+
+func newCache(max int) *cache {
+	return &cache{max: max, lru: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *cache) get(key string, off int64) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok || e.Value.(*cacheEntry).off != off {
+		return "", false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).val, true
+}
+
+func (c *cache) add(key string, off int64, val string) {
+	n := len(key) + len(val)
+	if n > c.max {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		ce := e.Value.(*cacheEntry)
+		if ce.off > off {
+			return
+		}
+		c.size += len(val) - len(ce.val)
+		ce.val, ce.off = val, off
+		c.lru.MoveToFront(e)
+	} else {
+		c.items[key] = c.lru.PushFront(&cacheEntry{key: key, val: val, off: off})
+		c.size += n
+	}
+	for c.size > c.max {
+		ce := c.lru.Remove(c.lru.Back()).(*cacheEntry)
+		delete(c.items, ce.key)
+		c.size -= len(ce.key) + len(ce.val)
+	}
+}
+
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.items = make(map[string]*list.Element)
+	c.size = 0
+}
@@ -0,0 +1,168 @@
+// Package filekv provides a DB that stores data in local files,
+// as a single-node, disk-backed baseline.
+package filekv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+var (
+	errClosed   = errors.New("filekv: db is closed")
+	errNotExist = errors.New("filekv: store does not exist, create it with mktable")
+)
+
+type conf struct {
+	Path      string `json:"path"`
+	Sync      string `json:"sync"`
+	CacheSize int    `json:"cacheSize"`
+}
+
+type client struct {
+	path      string
+	syncEach  bool
+	syncEvery time.Duration
+	cacheSize int
+
+	mu     sync.RWMutex
+	st     *store // nil until the store exists
+	closed bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (c *client) getStore() (*store, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return nil, errClosed
+	}
+	if c.st == nil {
+		return nil, errNotExist
+	}
+	return c.st, nil
+}
+
+// open opens the store, creating it if create is set.
+// c.mu must be held.
+func (c *client) open(create bool) error {
+	st, err := openStore(c.path, create)
+	if err != nil {
+		return err
+	}
+	if c.cacheSize > 0 {
+		st.cache = newCache(c.cacheSize)
+	}
+	c.st = st
+	if c.syncEvery > 0 {
+		c.wg.Add(1)
+		go c.syncLoop(st)
+	}
+	return nil
+}
+
+func (c *client) syncLoop(st *store) {
+	defer c.wg.Done()
+	t := time.NewTicker(c.syncEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			if err := st.sync(); err != nil {
+				fmt.Fprintf(os.Stderr, "filekv: unable to sync: %v\n", err)
+			}
+		}
+	}
+}
+
+// Init creates the store if it does not exist.
+func (c *client) Init(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errClosed
+	}
+	if c.st != nil {
+		return nil
+	}
+	return c.open(true)
+}
+
+func (c *client) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	st, err := c.getStore()
+	if err != nil {
+		return "", db.EmptyMeta(), err
+	}
+	val, _, err := st.get(key)
+	return val, db.EmptyMeta(), err
+}
+
+func (c *client) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	st, err := c.getStore()
+	if err != nil {
+		return db.EmptyMeta(), err
+	}
+	return db.EmptyMeta(), st.put(key, val, c.syncEach)
+}
+
+func (c *client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errClosed
+	}
+	c.closed = true
+	close(c.done)
+	c.mu.Unlock()
+	c.wg.Wait()
+	if c.st == nil {
+		return nil
+	}
+	return c.st.close()
+}
+
+func makeDB(hosts []string, data []byte) (db.DB, error) {
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+	var cfg conf
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid filekv config: %v", err)
+	}
+	if cfg.Path == "" {
+		return nil, errors.New("invalid filekv config: path is required")
+	}
+	if cfg.CacheSize < 0 {
+		return nil, errors.New("invalid filekv config: cacheSize must not be negative")
+	}
+	c := &client{path: cfg.Path, cacheSize: cfg.CacheSize, done: make(chan struct{})}
+	switch cfg.Sync {
+	case "", "none":
+	case "always":
+		c.syncEach = true
+	default:
+		d, err := time.ParseDuration(cfg.Sync)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid filekv config: bad sync mode %q", cfg.Sync)
+		}
+		c.syncEvery = d
+	}
+	if err := c.open(false); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("filekv: unable to open store: %v", err)
+	}
+	return c, nil
+}
+
+func init() {
+	db.Register("filekv", makeDB)
+}
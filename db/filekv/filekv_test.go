@@ -0,0 +1,213 @@
+package filekv
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "fabbench-filekv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func dial(t *testing.T, opts string) db.DB {
+	d, err := db.Dial("filekv", nil, []byte(opts))
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	return d
+}
+
+func TestDB(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, mode := range []string{"none", "always", "10ms"} {
+		opts := fmt.Sprintf(`{"path": %q, "sync": %q, "cacheSize": 1000}`, filepath.Join(dir, mode), mode)
+		d := dial(t, opts)
+		if _, err := d.Put(ctx, "k", "v"); err == nil {
+			t.Errorf("sync %s: put before init: want error", mode)
+		}
+		if err := d.Init(ctx); err != nil {
+			t.Fatalf("sync %s: unable to init: %v", mode, err)
+		}
+		for i := 0; i < 100; i++ {
+			d.Put(ctx, fmt.Sprint(i), fmt.Sprint("a", i))
+		}
+		for i := 0; i < 100; i += 2 {
+			d.Put(ctx, fmt.Sprint(i), fmt.Sprint("b", i))
+		}
+		if err := d.Close(); err != nil {
+			t.Fatalf("sync %s: unable to close: %v", mode, err)
+		}
+
+		d = dial(t, opts)
+		for i := 0; i < 100; i++ {
+			want := fmt.Sprint("a", i)
+			if i%2 == 0 {
+				want = fmt.Sprint("b", i)
+			}
+			if got, _, err := d.Get(ctx, fmt.Sprint(i)); got != want || err != nil {
+				t.Errorf("sync %s: get %d: got %q, %v, want %q", mode, i, got, err, want)
+			}
+		}
+		if got, _, err := d.Get(ctx, "missing"); got != "" || err != nil {
+			t.Errorf("sync %s: get missing key: got %q, %v, want empty value", mode, got, err)
+		}
+		d.Close()
+	}
+}
+
+func TestTornRecord(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	opts := fmt.Sprintf(`{"path": %q}`, dir)
+
+	d := dial(t, opts)
+	d.Init(ctx)
+	d.Put(ctx, "a", "1")
+	d.Put(ctx, "b", "2")
+	d.Close()
+
+	path := filepath.Join(dir, logName)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// drop the end of the last record
+	if err := ioutil.WriteFile(path, data[:len(data)-1], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d = dial(t, opts)
+	if got, _, _ := d.Get(ctx, "a"); got != "1" {
+		t.Errorf("get a: got %q, want 1", got)
+	}
+	if got, _, _ := d.Get(ctx, "b"); got != "" {
+		t.Errorf("get torn b: got %q, want nothing", got)
+	}
+	d.Put(ctx, "c", "3")
+	d.Close()
+
+	d = dial(t, opts)
+	defer d.Close()
+	if got, _, _ := d.Get(ctx, "c"); got != "3" {
+		t.Errorf("get c after recovery: got %q, want 3", got)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	opts := fmt.Sprintf(`{"path": %q, "cacheSize": 100}`, dir)
+
+	d := dial(t, opts)
+	d.Init(ctx)
+	d.(*client).st.compactMin = 1 << 10
+	for i := 0; i < 20; i++ {
+		for k := 0; k < 10; k++ {
+			d.Put(ctx, fmt.Sprint(k), fmt.Sprintf("%02d", i))
+			d.Get(ctx, fmt.Sprint(k))
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("unable to close: %v", err)
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, logName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 200 records of 15 bytes, 10 of which are live
+	if fi.Size() >= 100*15 {
+		t.Errorf("log has %d bytes, want it compacted", fi.Size())
+	}
+	d = dial(t, opts)
+	defer d.Close()
+	for k := 0; k < 10; k++ {
+		if got, _, err := d.Get(ctx, fmt.Sprint(k)); got != "19" || err != nil {
+			t.Errorf("get %d: got %q, %v, want 19", k, got, err)
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	d := dial(t, fmt.Sprintf(`{"path": %q, "cacheSize": 100}`, dir))
+	defer d.Close()
+	d.Init(ctx)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			key := fmt.Sprint(w % 4)
+			for i := 0; i < 200; i++ {
+				if w < 4 {
+					d.Put(ctx, key, fmt.Sprint(i))
+				} else if _, _, err := d.Get(ctx, key); err != nil {
+					t.Errorf("unable to get: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	for k := 0; k < 4; k++ {
+		if got, _, _ := d.Get(ctx, fmt.Sprint(k)); got != "199" {
+			t.Errorf("key %d: got %q, want 199", k, got)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := newCache(10)
+	c.add("a", 1, "1234")
+	c.add("a", 0, "old") // older value is ignored
+	if v, ok := c.get("a", 1); !ok || v != "1234" {
+		t.Errorf("get a: got %q, %t, want 1234", v, ok)
+	}
+	if _, ok := c.get("a", 0); ok {
+		t.Error("get a at stale offset: want miss")
+	}
+	c.add("b", 2, "1234")
+	c.get("a", 1)
+	c.add("c", 3, "1") // evicts b
+	if _, ok := c.get("b", 2); ok {
+		t.Error("get b: want it evicted")
+	}
+	if _, ok := c.get("a", 1); !ok {
+		t.Error("get a: want hit")
+	}
+	c.add("big", 4, "1234567890")
+	if _, ok := c.get("big", 4); ok || c.size > c.max {
+		t.Errorf("got %d bytes cached, want values that do not fit to be skipped", c.size)
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	for _, opts := range []string{
+		`{}`,
+		`{"path": "x", "sync": "sometimes"}`,
+		`{"path": "x", "cacheSize": -1}`,
+	} {
+		if _, err := db.Dial("filekv", nil, []byte(opts)); err == nil {
+			t.Errorf("%s: want error", opts)
+		}
+	}
+}
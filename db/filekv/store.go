@@ -0,0 +1,279 @@
+package filekv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The store is an append-only log of records with an in-memory index
+// of the latest value of each key. Each record is a header followed by
+// the key and value. The header holds a CRC-32C of the rest of the
+// record, and the lengths of the key and value.
+//
+// Once most of the log holds overwritten values, it is compacted
+// by copying the latest records to a new log that replaces it.
+const (
+	logName   = "data.log"
+	hdrLen    = 12
+	maxKeyLen = 1 << 16
+
+	// logs smaller than this are never compacted
+	minCompactSize = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type valLoc struct {
+	off int64
+	n   uint32
+}
+
+func recordLen(key string, loc valLoc) int64 {
+	return hdrLen + int64(len(key)) + int64(loc.n)
+}
+
+type store struct {
+	dir        string
+	compactMin int64
+
+	// protected by wmu, which serializes appends and compactions
+	wmu        sync.Mutex
+	size       int64
+	live       int64 // bytes of records that hold the latest value of a key
+	compacting bool
+
+	// f and index are replaced by compactions, which hold imu
+	imu   sync.RWMutex
+	f     *os.File
+	index map[string]valLoc
+
+	cache *cache // nil if disabled
+
+	wg sync.WaitGroup // for compactions
+}
+
+// openStore opens the store in dir, creating it if create is set.
+// It recovers from crashes by dropping any torn record at the end of the log.
+func openStore(dir string, create bool) (*store, error) {
+	flag := os.O_RDWR
+	if create {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		flag |= os.O_CREATE
+	}
+	f, err := os.OpenFile(filepath.Join(dir, logName), flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &store{dir: dir, compactMin: minCompactSize, f: f, index: make(map[string]valLoc)}
+	if err := s.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *store) replay() error {
+	fi, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	r := io.NewSectionReader(s.f, 0, fi.Size())
+	var hdr [hdrLen]byte
+	var buf []byte
+	off := int64(0)
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			break
+		}
+		klen, vlen := binary.LittleEndian.Uint32(hdr[4:]), binary.LittleEndian.Uint32(hdr[8:])
+		n := int64(klen) + int64(vlen)
+		if klen > maxKeyLen || off+hdrLen+n > fi.Size() {
+			break
+		}
+		if int64(cap(buf)) < n {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			break
+		}
+		if recordCRC(hdr[4:], buf) != binary.LittleEndian.Uint32(hdr[:]) {
+			break
+		}
+		s.setLoc(string(buf[:klen]), valLoc{off: off + hdrLen + int64(klen), n: vlen})
+		off += hdrLen + n
+	}
+	if off < fi.Size() {
+		if err := s.f.Truncate(off); err != nil {
+			return fmt.Errorf("unable to truncate torn record: %v", err)
+		}
+	}
+	s.size = off
+	return nil
+}
+
+func recordCRC(lens, kv []byte) uint32 {
+	return crc32.Update(crc32.Checksum(lens, crcTable), crcTable, kv)
+}
+
+func appendRecord(b []byte, key, val string) []byte {
+	start := len(b)
+	b = append(b, make([]byte, hdrLen)...)
+	binary.LittleEndian.PutUint32(b[start+4:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(b[start+8:], uint32(len(val)))
+	b = append(b, key...)
+	b = append(b, val...)
+	binary.LittleEndian.PutUint32(b[start:], recordCRC(b[start+4:start+hdrLen], b[start+hdrLen:]))
+	return b
+}
+
+// setLoc points key at loc in the index.
+// s.wmu must be held, and s.imu too if the store is in use.
+func (s *store) setLoc(key string, loc valLoc) {
+	if old, ok := s.index[key]; ok {
+		s.live -= recordLen(key, old)
+	}
+	s.index[key] = loc
+	s.live += recordLen(key, loc)
+}
+
+func (s *store) get(key string) (string, bool, error) {
+	// hold imu so that the log is not swapped out during the read
+	s.imu.RLock()
+	defer s.imu.RUnlock()
+	loc, ok := s.index[key]
+	if !ok {
+		return "", false, nil
+	}
+	if s.cache != nil {
+		if val, ok := s.cache.get(key, loc.off); ok {
+			return val, true, nil
+		}
+	}
+	b := make([]byte, loc.n)
+	if _, err := s.f.ReadAt(b, loc.off); err != nil {
+		return "", false, err
+	}
+	val := string(b)
+	if s.cache != nil {
+		s.cache.add(key, loc.off, val)
+	}
+	return val, true, nil
+}
+
+func (s *store) put(key, val string, fsync bool) error {
+	if len(key) > maxKeyLen {
+		return errors.New("key too long")
+	}
+	rec := appendRecord(nil, key, val)
+
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if _, err := s.f.WriteAt(rec, s.size); err != nil {
+		return err
+	}
+	if fsync {
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+	}
+	loc := valLoc{off: s.size + hdrLen + int64(len(key)), n: uint32(len(val))}
+	s.size += int64(len(rec))
+	s.imu.Lock()
+	s.setLoc(key, loc)
+	s.imu.Unlock()
+	if s.cache != nil {
+		s.cache.add(key, loc.off, val)
+	}
+	if !s.compacting && s.size >= s.compactMin && s.size-s.live > s.live {
+		s.compacting = true
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.compact(); err != nil {
+				fmt.Fprintf(os.Stderr, "filekv: unable to compact: %v\n", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// compact replaces the log with one that only holds
+// the latest value of each key.
+// Reads continue during compaction, but writes wait for it.
+func (s *store) compact() error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	defer func() { s.compacting = false }()
+
+	path := filepath.Join(s.dir, logName)
+	f, err := os.OpenFile(path+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	// the index only changes with wmu held, so it is safe to read here
+	index := make(map[string]valLoc, len(s.index))
+	w := bufio.NewWriter(f)
+	var rec []byte
+	off := int64(0)
+	for key, loc := range s.index {
+		val := make([]byte, loc.n)
+		if _, err := s.f.ReadAt(val, loc.off); err != nil {
+			f.Close()
+			return err
+		}
+		rec = appendRecord(rec[:0], key, string(val))
+		if _, err := w.Write(rec); err != nil {
+			f.Close()
+			return err
+		}
+		index[key] = valLoc{off: off + hdrLen + int64(len(key)), n: loc.n}
+		off += int64(len(rec))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(path+".compact", path)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.imu.Lock()
+	old := s.f
+	s.f, s.index = f, index
+	s.size, s.live = off, off
+	if s.cache != nil {
+		// cached values are tagged with offsets in the old log
+		s.cache.clear()
+	}
+	s.imu.Unlock()
+	return old.Close()
+}
+
+func (s *store) sync() error {
+	s.imu.RLock()
+	defer s.imu.RUnlock()
+	return s.f.Sync()
+}
+
+func (s *store) close() error {
+	s.wg.Wait()
+	err := s.f.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,269 @@
+// Package httpkv provides a DB for key-value services with HTTP APIs.
+// The requests it sends are described by templates in its config,
+// so that new services can be benchmarked without new code.
+package httpkv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+type reqConf struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Body    string            `json:"body"`
+	Headers map[string]string `json:"headers"`
+	OK      []int             `json:"ok"`
+	Missing []int             `json:"missing"`
+	Value   string            `json:"value"`
+}
+
+type conf struct {
+	Get          reqConf `json:"get"`
+	Put          reqConf `json:"put"`
+	Timeout      string  `json:"timeout"`
+	ConnsPerHost int     `json:"connsPerHost"`
+}
+
+// A request is a compiled reqConf.
+type request struct {
+	method  string
+	url     template
+	body    template
+	headers map[string]string
+	ok      []int
+	missing []int
+	value   []string // JSON path to the value, or nil to use the body
+}
+
+func compile(rc reqConf, defMethod string, defOK []int) (*request, error) {
+	r := &request{method: rc.Method, headers: rc.Headers, ok: rc.OK, missing: rc.Missing}
+	if r.method == "" {
+		r.method = defMethod
+	}
+	if len(r.ok) == 0 {
+		r.ok = defOK
+	}
+	if rc.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	var err error
+	if r.url, err = parseTemplate(rc.URL); err != nil {
+		return nil, err
+	}
+	if r.body, err = parseTemplate(rc.Body); err != nil {
+		return nil, err
+	}
+	switch {
+	case rc.Value == "" || rc.Value == "body":
+	case strings.HasPrefix(rc.Value, "json:") && len(rc.Value) > len("json:"):
+		r.value = strings.Split(strings.TrimPrefix(rc.Value, "json:"), ".")
+	default:
+		return nil, fmt.Errorf("bad value %q", rc.Value)
+	}
+	return r, nil
+}
+
+type hostInfo string
+
+func (hi hostInfo) ID() string { return string(hi) }
+
+type client struct {
+	hc    *http.Client
+	hosts []string // to fill in {host}, in turn
+	next  uint32   // atomic
+	get   *request
+	put   *request
+}
+
+func has(codes []int, c int) bool {
+	for _, v := range codes {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+// pickedHostKey holds the entry of hosts chosen by PickHost.
+type pickedHostKey struct{}
+
+// nextHost returns the entry of hosts to fill in for a request made with ctx.
+func (c *client) nextHost(ctx context.Context) string {
+	if host, ok := ctx.Value(pickedHostKey{}).(string); ok {
+		return host
+	}
+	if len(c.hosts) == 0 {
+		return ""
+	}
+	return c.hosts[int(atomic.AddUint32(&c.next, 1))%len(c.hosts)]
+}
+
+// PickHost returns the host that a get of key would be sent to.
+func (c *client) PickHost(ctx context.Context, key string) (context.Context, db.HostInfo) {
+	if len(c.hosts) == 0 {
+		return ctx, nil
+	}
+	host := c.nextHost(ctx)
+	u, err := url.Parse(c.get.url.expand(host, key, "", true))
+	if err != nil {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, pickedHostKey{}, host), hostInfo(u.Host)
+}
+
+// do sends r and returns the response body if the status is ok,
+// or ok=false if the status says the key is missing.
+func (c *client) do(ctx context.Context, r *request, key, val string) (body []byte, ok bool, m db.Meta, err error) {
+	m = db.EmptyMeta()
+	host := c.nextHost(ctx)
+	var rbody io.Reader
+	if !r.body.empty() {
+		rbody = strings.NewReader(r.body.expand(host, key, val, false))
+	}
+	req, err := http.NewRequest(r.method, r.url.expand(host, key, val, true), rbody)
+	if err != nil {
+		return nil, false, m, err
+	}
+	m = db.MetaWithHostInfo(m, hostInfo(req.URL.Host))
+	for k, v := range r.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, false, m, err
+	}
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, m, err
+	}
+	switch {
+	case has(r.ok, resp.StatusCode):
+		return body, true, m, nil
+	case has(r.missing, resp.StatusCode):
+		return nil, false, m, nil
+	}
+	return nil, false, m, fmt.Errorf("httpkv: %s %s: unexpected status %s", r.method, req.URL, resp.Status)
+}
+
+func (c *client) Init(ctx context.Context) error { return nil }
+
+func (c *client) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	body, ok, m, err := c.do(ctx, c.get, key, "")
+	if err != nil || !ok {
+		return "", m, err
+	}
+	if c.get.value == nil {
+		return string(body), m, nil
+	}
+	val, err := extract(body, c.get.value)
+	if err != nil {
+		return "", m, fmt.Errorf("httpkv: unable to extract value: %v", err)
+	}
+	return val, m, nil
+}
+
+func (c *client) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	_, _, m, err := c.do(ctx, c.put, key, val)
+	return m, err
+}
+
+func (c *client) Close() error {
+	if t, ok := c.hc.Transport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+	return nil
+}
+
+// extract returns the string at path in JSON data.
+// A null or absent value is treated like a missing key.
+func extract(data []byte, path []string) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", err
+	}
+	for _, p := range path {
+		switch cur := v.(type) {
+		case map[string]interface{}:
+			v = cur[p]
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(cur) {
+				return "", fmt.Errorf("bad index %s", p)
+			}
+			v = cur[i]
+		case nil:
+			return "", nil
+		default:
+			return "", fmt.Errorf("cannot index %T with %s", v, p)
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("value is %T, not a string", v)
+}
+
+func makeDB(hosts []string, data []byte) (db.DB, error) {
+	var cfg conf
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid httpkv config: %v", err)
+	}
+	if cfg.Timeout == "" {
+		cfg.Timeout = "5s"
+	}
+	if cfg.ConnsPerHost == 0 {
+		cfg.ConnsPerHost = 100
+	}
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid httpkv config: bad timeout: %v", err)
+	}
+	if cfg.ConnsPerHost < 0 {
+		return nil, errors.New("invalid httpkv config: connsPerHost must be positive")
+	}
+	if len(cfg.Get.Missing) == 0 {
+		cfg.Get.Missing = []int{http.StatusNotFound}
+	}
+	c := &client{
+		hc: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{MaxIdleConnsPerHost: cfg.ConnsPerHost},
+		},
+	}
+	if c.get, err = compile(cfg.Get, http.MethodGet, []int{http.StatusOK}); err != nil {
+		return nil, fmt.Errorf("invalid httpkv config: get: %v", err)
+	}
+	if c.put, err = compile(cfg.Put, http.MethodPut, []int{http.StatusOK, http.StatusCreated, http.StatusNoContent}); err != nil {
+		return nil, fmt.Errorf("invalid httpkv config: put: %v", err)
+	}
+	for _, h := range hosts {
+		if h != "" {
+			c.hosts = append(c.hosts, h)
+		}
+	}
+	if len(c.hosts) == 0 && (c.get.url.uses("host") || c.put.url.uses("host")) {
+		return nil, errors.New("httpkv: no host")
+	}
+	return c, nil
+}
+
+func init() {
+	db.Register("httpkv", makeDB)
+}
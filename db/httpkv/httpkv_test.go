@@ -0,0 +1,239 @@
+package httpkv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    string
+		wantURL string
+		bad     bool
+	}{
+		{s: "http://{host}/kv/{key}", want: "http://h:1/kv/a b", wantURL: "http://h:1/kv/a%20b"},
+		{s: `{"k": {keyJSON}, "v": {valueJSON}}`, want: `{"k": "a b", "v": "\"v\""}`},
+		{s: "{value}", want: `"v"`, wantURL: "%22v%22"},
+		{s: "/{key}?k={key}", want: "/a b?k=a b", wantURL: "/a%20b?k=a+b"},
+		{s: "{}{ key}{key", want: "{}{ key}{key"},
+		{s: "", want: ""},
+		{s: "/{nope}", bad: true},
+	}
+	for _, test := range tests {
+		tmpl, err := parseTemplate(test.s)
+		if test.bad {
+			if err == nil {
+				t.Errorf("%s: want error", test.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.s, err)
+			continue
+		}
+		if got := tmpl.expand("h:1", "a b", `"v"`, false); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.s, got, test.want)
+		}
+		if test.wantURL == "" {
+			continue
+		}
+		if got := tmpl.expand("h:1", "a b", `"v"`, true); got != test.wantURL {
+			t.Errorf("%s: got escaped %s, want %s", test.s, got, test.wantURL)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	data := []byte(`{"data": {"items": [{"v": "x"}, {"v": null}, {"v": 3}]}}`)
+	tests := []struct {
+		path string
+		want string
+		bad  bool
+	}{
+		{path: "data.items.0.v", want: "x"},
+		{path: "data.items.1.v", want: ""},
+		{path: "data.missing.v", want: ""},
+		{path: "data.items.2.v", bad: true},
+		{path: "data.items.3.v", bad: true},
+		{path: "data.items.x", bad: true},
+	}
+	for _, test := range tests {
+		got, err := extract(data, strings.Split(test.path, "."))
+		if (err != nil) != test.bad || got != test.want {
+			t.Errorf("%s: got %q, %v, want %q (error: %t)", test.path, got, err, test.want, test.bad)
+		}
+	}
+}
+
+// restServer stores values at /kv/KEY.
+func restServer() *httptest.Server {
+	var mu sync.Mutex
+	m := make(map[string]string)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/kv/")
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			b, _ := ioutil.ReadAll(r.Body)
+			m[key] = string(b)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			if key == "fail" {
+				http.Error(w, "oops", http.StatusInternalServerError)
+				return
+			}
+			v, ok := m[key]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, v)
+		}
+	}))
+}
+
+// jsonServer has an RPC-like JSON API.
+func jsonServer() *httptest.Server {
+	var mu sync.Mutex
+	m := make(map[string]string)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/set":
+			var req struct{ K, V string }
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			m[req.K] = req.V
+			w.WriteHeader(http.StatusCreated)
+		case "/get":
+			resp := map[string]interface{}{"result": nil}
+			if v, ok := m[r.URL.Query().Get("k")]; ok {
+				resp["result"] = map[string]string{"value": v}
+			}
+			json.NewEncoder(w).Encode(resp)
+		}
+	}))
+}
+
+func TestDB(t *testing.T) {
+	rest, js := restServer(), jsonServer()
+	defer rest.Close()
+	defer js.Close()
+	restHost := strings.TrimPrefix(rest.URL, "http://")
+	tests := []struct {
+		name  string
+		hosts []string
+		opts  string
+		host  string
+	}{
+		{
+			name:  "rest",
+			hosts: []string{restHost},
+			opts: `{
+				"get": {"url": "http://{host}/kv/{key}"},
+				"put": {"url": "http://{host}/kv/{key}", "body": "{value}"}
+			}`,
+			host: restHost,
+		},
+		{
+			name: "json",
+			opts: fmt.Sprintf(`{
+				"get": {"url": "%[1]s/get?k={key}", "headers": {"X-Token": "secret"}, "value": "json:result.value"},
+				"put": {"method": "POST", "url": "%[1]s/set", "headers": {"X-Token": "secret"},
+					"body": "{\"k\": {keyJSON}, \"v\": {valueJSON}}", "ok": [201]}
+			}`, js.URL),
+			host: strings.TrimPrefix(js.URL, "http://"),
+		},
+	}
+	ctx := context.Background()
+	for _, test := range tests {
+		d, err := db.Dial("httpkv", test.hosts, []byte(test.opts))
+		if err != nil {
+			t.Fatalf("%s: unable to dial: %v", test.name, err)
+		}
+		for _, key := range []string{"a", "b/c d", `"q"&x=y`} {
+			val := key + "-" + `"val"/`
+			m, err := d.Put(ctx, key, val)
+			if err != nil {
+				t.Errorf("%s: unable to put %s: %v", test.name, key, err)
+			}
+			if hi, ok := db.GetHostInfo(m); !ok || hi.ID() != test.host {
+				t.Errorf("%s: put %s: got host info %v, want %s", test.name, key, hi, test.host)
+			}
+			if got, _, err := d.Get(ctx, key); got != val || err != nil {
+				t.Errorf("%s: get %s: got %q, %v, want %q", test.name, key, got, err, val)
+			}
+		}
+		if got, _, err := d.Get(ctx, "missing"); got != "" || err != nil {
+			t.Errorf("%s: get missing key: got %q, %v, want empty value", test.name, got, err)
+		}
+		d.Close()
+	}
+
+	d, _ := db.Dial("httpkv", []string{restHost}, []byte(tests[0].opts))
+	defer d.Close()
+	if _, _, err := d.Get(ctx, "fail"); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("get with server error: got %v, want unexpected status error", err)
+	}
+}
+
+func TestPickHost(t *testing.T) {
+	s1, s2 := restServer(), restServer()
+	defer s1.Close()
+	defer s2.Close()
+	hosts := []string{strings.TrimPrefix(s1.URL, "http://"), strings.TrimPrefix(s2.URL, "http://")}
+	d, err := db.Dial("httpkv", hosts, []byte(`{
+		"get": {"url": "http://{host}/kv/{key}"},
+		"put": {"url": "http://{host}/kv/{key}", "body": "{value}"}
+	}`))
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer d.Close()
+	for i := 0; i < 10; i++ {
+		ctx, want := d.(db.HostPicker).PickHost(context.Background(), "k")
+		m, err := d.Put(ctx, "k", "v")
+		if err != nil {
+			t.Fatalf("unable to put: %v", err)
+		}
+		if hi, ok := db.GetHostInfo(m); !ok || hi.ID() != want.ID() {
+			t.Errorf("put %d: served by %v, want picked host %s", i, hi, want.ID())
+		}
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	tests := []struct {
+		hosts []string
+		opts  string
+	}{
+		{nil, `{"put": {"url": "http://x/{key}"}}`},
+		{nil, `{"get": {"url": "http://x/{key}"}, "put": {"url": "http://x/{keyy}"}}`},
+		{nil, `{"get": {"url": "http://x/{key}", "value": "xml:a"}, "put": {"url": "http://x/{key}"}}`},
+		{nil, `{"get": {"url": "http://{host}/{key}"}, "put": {"url": "http://x/{key}"}}`},
+		{[]string{"h"}, `{"get": {"url": "http://x/{key}"}, "put": {"url": "http://x/{key}"}, "timeout": "soon"}`},
+	}
+	for _, test := range tests {
+		if _, err := db.Dial("httpkv", test.hosts, []byte(test.opts)); err == nil {
+			t.Errorf("%s: want error", test.opts)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package httpkv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// A template is text with placeholders like {key}.
+type template struct {
+	lits    []string // len(lits) == len(vars)+1
+	vars    []string
+	inQuery []bool // whether each var comes after a ?
+}
+
+var templateVars = map[string]bool{
+	"host": true, "key": true, "value": true, "keyJSON": true, "valueJSON": true,
+}
+
+// parseTemplate parses s. Braces that do not enclose a name,
+// like those in JSON objects, are left as they are.
+func parseTemplate(s string) (template, error) {
+	var t template
+	lit := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '{' {
+			continue
+		}
+		j := i + 1
+		for j < len(s) && isNameByte(s[j]) {
+			j++
+		}
+		if j == i+1 || j == len(s) || s[j] != '}' {
+			continue
+		}
+		name := s[i+1 : j]
+		if !templateVars[name] {
+			return template{}, fmt.Errorf("unknown placeholder {%s}", name)
+		}
+		t.lits = append(t.lits, s[lit:i])
+		t.vars = append(t.vars, name)
+		t.inQuery = append(t.inQuery, strings.IndexByte(s[:i], '?') >= 0)
+		lit = j + 1
+		i = j
+	}
+	t.lits = append(t.lits, s[lit:])
+	return t, nil
+}
+
+func isNameByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func (t template) empty() bool { return len(t.vars) == 0 && t.lits[0] == "" }
+
+func (t template) uses(name string) bool {
+	for _, v := range t.vars {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// expand fills in the placeholders. If escape is set, key and value
+// are escaped for use in the path or query of URLs.
+func (t template) expand(host, key, val string, escape bool) string {
+	var b strings.Builder
+	for i, v := range t.vars {
+		b.WriteString(t.lits[i])
+		switch v {
+		case "host":
+			b.WriteString(host)
+		case "key", "value":
+			s := key
+			if v == "value" {
+				s = val
+			}
+			if escape && t.inQuery[i] {
+				s = url.QueryEscape(s)
+			} else if escape {
+				s = url.PathEscape(s)
+			}
+			b.WriteString(s)
+		case "keyJSON", "valueJSON":
+			s := key
+			if v == "valueJSON" {
+				s = val
+			}
+			enc, _ := json.Marshal(s)
+			b.Write(enc)
+		}
+	}
+	b.WriteString(t.lits[len(t.lits)-1])
+	return b.String()
+}
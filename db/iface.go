@@ -73,3 +73,26 @@ func GetHostInfo(m Meta) (HostInfo, bool) {
 	}
 	return v.(HostInfo), true
 }
+
+// A HostPicker is a DB that can choose the host for a request
+// before sending it, so that wrappers know where the request will go.
+type HostPicker interface {
+	// PickHost chooses the host for a request for key and returns it
+	// with a context that sends the request made with it to that host.
+	// The host is nil if the DB does not know where key will go.
+	PickHost(ctx context.Context, key string) (context.Context, HostInfo)
+}
+
+type stepKey struct{}
+
+// ContextWithStep returns a context for requests made in the given
+// trace step, so that DBs can tell which step requests belong to.
+func ContextWithStep(ctx context.Context, step int) context.Context {
+	return context.WithValue(ctx, stepKey{}, step)
+}
+
+// StepFromContext returns the trace step of requests made with ctx.
+func StepFromContext(ctx context.Context) (int, bool) {
+	step, ok := ctx.Value(stepKey{}).(int)
+	return step, ok
+}
@@ -0,0 +1,243 @@
+// Package memkv provides an in-process DB that stores data in memory.
+// Besides Get and Put, a Store can delete, scan and conditionally write
+// keys, and it can persist its data in snapshots, so separate load and
+// run processes can share it.
+package memkv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/internal/fnv"
+)
+
+var errClosed = errors.New("memkv: db is closed")
+
+type entry struct {
+	val string
+	ver uint64
+}
+
+type shard struct {
+	mu sync.RWMutex
+	m  map[string]entry
+}
+
+type conf struct {
+	Shards        int    `json:"shards"`
+	Snapshot      string `json:"snapshot"`
+	SnapshotEvery string `json:"snapshotEvery"`
+}
+
+// Store is an in-memory key-value store.
+type Store struct {
+	shards   []shard
+	snapshot string
+
+	closeOnce sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+var _ db.DB = new(Store)
+
+// KV is a key and its value.
+type KV struct {
+	Key, Val string
+}
+
+// New returns an empty Store with n shards.
+func New(n int) *Store {
+	if n < 1 {
+		n = 1
+	}
+	s := &Store{shards: make([]shard, n), done: make(chan struct{})}
+	for i := range s.shards {
+		s.shards[i].m = make(map[string]entry)
+	}
+	return s
+}
+
+func (s *Store) shardFor(key string) *shard {
+	return &s.shards[fnv.HashString(key)%uint64(len(s.shards))]
+}
+
+func (s *Store) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Store) Init(ctx context.Context) error {
+	if s.isClosed() {
+		return errClosed
+	}
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	val, _, m, err := s.GetVersion(ctx, key)
+	return val, m, err
+}
+
+func (s *Store) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	if s.isClosed() {
+		return db.EmptyMeta(), errClosed
+	}
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	sh.m[key] = entry{val: val, ver: sh.m[key].ver + 1}
+	sh.mu.Unlock()
+	return db.EmptyMeta(), nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) (db.Meta, error) {
+	if s.isClosed() {
+		return db.EmptyMeta(), errClosed
+	}
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	delete(sh.m, key)
+	sh.mu.Unlock()
+	return db.EmptyMeta(), nil
+}
+
+// GetVersion returns the value of key and its version.
+// Versions of a key increase with every write
+// and absent keys have version 0.
+func (s *Store) GetVersion(ctx context.Context, key string) (string, uint64, db.Meta, error) {
+	if s.isClosed() {
+		return "", 0, db.EmptyMeta(), errClosed
+	}
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	e := sh.m[key]
+	sh.mu.RUnlock()
+	return e.val, e.ver, db.EmptyMeta(), nil
+}
+
+// CAS writes val to key if its version is ver
+// and reports whether it did.
+func (s *Store) CAS(ctx context.Context, key string, ver uint64, val string) (bool, db.Meta, error) {
+	if s.isClosed() {
+		return false, db.EmptyMeta(), errClosed
+	}
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.m[key].ver != ver {
+		return false, db.EmptyMeta(), nil
+	}
+	sh.m[key] = entry{val: val, ver: ver + 1}
+	return true, db.EmptyMeta(), nil
+}
+
+// Scan reads up to n keys in order, starting from the first key that
+// is not less than start. It is O(N log N) in the number of
+// keys stored and does not see a consistent view of all shards.
+func (s *Store) Scan(ctx context.Context, start string, n int) ([]KV, db.Meta, error) {
+	if s.isClosed() {
+		return nil, db.EmptyMeta(), errClosed
+	}
+	var kvs []KV
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for k, e := range sh.m {
+			if k >= start {
+				kvs = append(kvs, KV{Key: k, Val: e.val})
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	if len(kvs) > n {
+		kvs = kvs[:n]
+	}
+	return kvs, db.EmptyMeta(), nil
+}
+
+// Close stops periodic snapshots and writes a final snapshot,
+// if configured.
+func (s *Store) Close() error {
+	err := errClosed
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+		err = nil
+		if s.snapshot != "" {
+			err = s.WriteSnapshot(s.snapshot)
+		}
+	})
+	return err
+}
+
+func (s *Store) snapshotEvery(d time.Duration) {
+	defer s.wg.Done()
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			if err := s.WriteSnapshot(s.snapshot); err != nil {
+				fmt.Fprintf(os.Stderr, "memkv: unable to write snapshot: %v\n", err)
+			}
+		}
+	}
+}
+
+func makeDB(hosts []string, data []byte) (db.DB, error) {
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+	var cfg conf
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid memkv config: %v", err)
+	}
+	if cfg.Shards == 0 {
+		cfg.Shards = 64
+	}
+	if cfg.Shards < 0 {
+		return nil, errors.New("invalid memkv config: shards must be positive")
+	}
+	var every time.Duration
+	if cfg.SnapshotEvery != "" {
+		var err error
+		every, err = time.ParseDuration(cfg.SnapshotEvery)
+		if err != nil || every <= 0 {
+			return nil, errors.New("invalid memkv config: snapshotEvery must be a positive duration")
+		}
+		if cfg.Snapshot == "" {
+			return nil, errors.New("invalid memkv config: snapshotEvery requires snapshot")
+		}
+	}
+
+	s := New(cfg.Shards)
+	s.snapshot = cfg.Snapshot
+	if s.snapshot != "" {
+		if err := s.ReadSnapshot(s.snapshot); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("memkv: unable to read snapshot: %v", err)
+		}
+	}
+	if every > 0 {
+		s.wg.Add(1)
+		go s.snapshotEvery(every)
+	}
+	return s, nil
+}
+
+func init() {
+	db.Register("memkv", makeDB)
+}
@@ -0,0 +1,153 @@
+package memkv
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := New(4)
+	defer s.Close()
+	if v, _, err := s.Get(ctx, "a"); v != "" || err != nil {
+		t.Errorf("get absent key: got %q, %v, want empty value", v, err)
+	}
+	for _, k := range []string{"c", "a", "d", "b"} {
+		if _, err := s.Put(ctx, k, k+"1"); err != nil {
+			t.Fatalf("unable to put: %v", err)
+		}
+	}
+	s.Put(ctx, "a", "a2")
+	if v, ver, _, _ := s.GetVersion(ctx, "a"); v != "a2" || ver != 2 {
+		t.Errorf("get a: got %q version %d, want a2 version 2", v, ver)
+	}
+
+	kvs, _, _ := s.Scan(ctx, "b", 2)
+	if want := []KV{{Key: "b", Val: "b1"}, {Key: "c", Val: "c1"}}; fmt.Sprint(kvs) != fmt.Sprint(want) {
+		t.Errorf("scan: got %v, want %v", kvs, want)
+	}
+
+	s.Delete(ctx, "b")
+	if v, ver, _, _ := s.GetVersion(ctx, "b"); v != "" || ver != 0 {
+		t.Errorf("get deleted key: got %q version %d, want empty version 0", v, ver)
+	}
+
+	casTests := []struct {
+		key  string
+		ver  uint64
+		ok   bool
+		want string
+	}{
+		{"a", 1, false, "a2"},
+		{"a", 2, true, "new"},
+		{"a", 2, false, "new"},
+		{"b", 1, false, ""},
+		{"b", 0, true, "new"},
+	}
+	for _, test := range casTests {
+		ok, _, err := s.CAS(ctx, test.key, test.ver, "new")
+		if err != nil || ok != test.ok {
+			t.Errorf("cas %s at %d: got %t, %v, want %t", test.key, test.ver, ok, err, test.ok)
+		}
+		if v, _, _ := s.Get(ctx, test.key); v != test.want {
+			t.Errorf("cas %s at %d: got value %q, want %q", test.key, test.ver, v, test.want)
+		}
+	}
+
+	s.Close()
+	if _, err := s.Put(ctx, "a", "b"); err == nil {
+		t.Error("put after close: want error")
+	}
+}
+
+func TestStoreConcurrentCAS(t *testing.T) {
+	ctx := context.Background()
+	s := New(8)
+	defer s.Close()
+	const workers, incrs = 8, 200
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < incrs; {
+				v, ver, _, _ := s.GetVersion(ctx, "ctr")
+				var cur int
+				fmt.Sscan(v, &cur)
+				if ok, _, _ := s.CAS(ctx, "ctr", ver, fmt.Sprint(cur+1)); ok {
+					n++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _, _ := s.Get(ctx, "ctr"); v != fmt.Sprint(workers*incrs) {
+		t.Errorf("got counter %s, want %d", v, workers*incrs)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "fabbench-memkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snap")
+	opts := []byte(fmt.Sprintf(`{"shards": 3, "snapshot": %q}`, path))
+
+	d, err := db.Dial("memkv", nil, opts)
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		d.Put(ctx, fmt.Sprint(i), fmt.Sprint("v", i))
+	}
+	d.Put(ctx, "0", "")
+	if err := d.Close(); err != nil {
+		t.Fatalf("unable to close: %v", err)
+	}
+
+	d, err = db.Dial("memkv", nil, opts)
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer d.Close()
+	v := d.(*Store)
+	for i := 0; i < 1000; i++ {
+		want, wantVer := fmt.Sprint("v", i), uint64(1)
+		if i == 0 {
+			want, wantVer = "", 2
+		}
+		if got, ver, _, _ := v.GetVersion(ctx, fmt.Sprint(i)); got != want || ver != wantVer {
+			t.Errorf("key %d: got %q version %d, want %q version %d", i, got, ver, want, wantVer)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, []byte("junk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Dial("memkv", nil, opts); err == nil {
+		t.Error("dial with bad snapshot: want error")
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	for _, opts := range []string{
+		`{"shards": -1}`,
+		`{"snapshotEvery": "1s"}`,
+		`{"snapshot": "x", "snapshotEvery": "never"}`,
+		`[]`,
+	} {
+		if _, err := db.Dial("memkv", nil, []byte(opts)); err == nil {
+			t.Errorf("%s: want error", opts)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package memkv
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// Snapshots are gzipped and consist of snapMagic followed by a record
+// for each key: the uvarint-prefixed key and value, and the uvarint version.
+const snapMagic = "memkv-snapshot-1\n"
+
+// WriteSnapshot writes the contents of s to path, replacing it atomically.
+// Each shard is copied atomically, but not all of them together.
+func (s *Store) WriteSnapshot(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := s.writeSnapshot(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *Store) writeSnapshot(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	bw.WriteString(snapMagic)
+	var buf [binary.MaxVarintLen64]byte
+	writeUvarint := func(v uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for k, e := range sh.m {
+			writeUvarint(uint64(len(k)))
+			bw.WriteString(k)
+			writeUvarint(uint64(len(e.val)))
+			bw.WriteString(e.val)
+			writeUvarint(e.ver)
+		}
+		sh.mu.RUnlock()
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadSnapshot adds the data in the snapshot at path to s.
+func (s *Store) ReadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(zr)
+	magic := make([]byte, len(snapMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapMagic {
+		return errors.New("not a memkv snapshot")
+	}
+	readString := func(n uint64) (string, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(br, b)
+		return string(b), err
+	}
+	for {
+		n, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		k, err := readString(n)
+		if err != nil {
+			return unexpected(err)
+		}
+		var e entry
+		if n, err = binary.ReadUvarint(br); err != nil {
+			return unexpected(err)
+		}
+		if e.val, err = readString(n); err != nil {
+			return unexpected(err)
+		}
+		if e.ver, err = binary.ReadUvarint(br); err != nil {
+			return unexpected(err)
+		}
+		sh := s.shardFor(k)
+		sh.mu.Lock()
+		sh.m[k] = e
+		sh.mu.Unlock()
+	}
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/internal/jsontime"
+)
+
+// Hedge sends another copy of a request if it has not completed
+// after the Percentile latency of the last Window requests,
+// and returns whichever response arrives first.
+// The delay is clamped to [MinDelay, MaxDelay] and is MaxDelay
+// until enough requests have completed to estimate it.
+// Writes are only hedged if Writes is set.
+type Hedge struct {
+	Percentile float64
+	Window     int
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+	MaxHedges  int
+	Writes     bool
+}
+
+func (h Hedge) Wrap(d db.DB) db.DB {
+	hd := &hedgeDB{DB: d, h: h, lats: make([]time.Duration, 0, h.Window)}
+	hd.delay = int64(h.MaxDelay)
+	return hd
+}
+
+type hedgeDB struct {
+	db.DB
+	h Hedge
+
+	delay int64 // atomic, current hedging delay
+
+	mu     sync.Mutex
+	lats   []time.Duration // ring of recent latencies
+	next   int
+	nadded int
+}
+
+// observe records the latency of a request and
+// periodically updates the hedging delay.
+func (d *hedgeDB) observe(lat time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.lats) < d.h.Window {
+		d.lats = append(d.lats, lat)
+	} else {
+		d.lats[d.next] = lat
+		d.next = (d.next + 1) % d.h.Window
+	}
+	d.nadded++
+	// sorting is too slow to do for every request
+	if d.nadded%(d.h.Window/8+1) != 0 || len(d.lats) < d.h.Window/8+1 {
+		return
+	}
+	sorted := append([]time.Duration(nil), d.lats...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	delay := sorted[int(d.h.Percentile/100*float64(len(sorted)-1))]
+	if delay < d.h.MinDelay {
+		delay = d.h.MinDelay
+	}
+	if delay > d.h.MaxDelay {
+		delay = d.h.MaxDelay
+	}
+	atomic.StoreInt64(&d.delay, int64(delay))
+}
+
+type hedgeResult struct {
+	val  string
+	meta db.Meta
+	err  error
+}
+
+func (d *hedgeDB) do(ctx context.Context, maxHedges int, f func(ctx context.Context) (string, db.Meta, error)) (string, db.Meta, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := make(chan hedgeResult, maxHedges+1)
+	send := func(first bool) {
+		start := time.Now()
+		val, meta, err := f(ctx)
+		// only time the first copy, from when it was sent: hedges are
+		// only sent when it is slow, so timing them or the whole request
+		// would lower the delay. If a hedge won, the first copy took
+		// at least as long as it ran.
+		if first && (err == nil || ctx.Err() != nil) {
+			d.observe(time.Since(start))
+		}
+		c <- hedgeResult{val, meta, err}
+	}
+
+	go send(true)
+	pending := 1
+	delay := time.Duration(atomic.LoadInt64(&d.delay))
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	for hedges := 0; ; {
+		select {
+		case r := <-c:
+			pending--
+			if r.err == nil || pending == 0 {
+				return r.val, r.meta, r.err
+			}
+			// wait for the others in case they succeed
+		case <-t.C:
+			if hedges < maxHedges {
+				hedges++
+				pending++
+				go send(false)
+				t.Reset(delay)
+			}
+		}
+	}
+}
+
+func (d *hedgeDB) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	return d.do(ctx, d.h.MaxHedges, func(ctx context.Context) (string, db.Meta, error) {
+		return d.DB.Get(ctx, key)
+	})
+}
+
+func (d *hedgeDB) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	maxHedges := 0
+	if d.h.Writes {
+		maxHedges = d.h.MaxHedges
+	}
+	_, meta, err := d.do(ctx, maxHedges, func(ctx context.Context) (string, db.Meta, error) {
+		meta, err := d.DB.Put(ctx, key, val)
+		return "", meta, err
+	})
+	return meta, err
+}
+
+func init() {
+	Register("hedge", func(data []byte) (Middleware, error) {
+		cfg := struct {
+			Percentile float64           `json:"percentile"`
+			Window     int               `json:"window"`
+			MinDelay   jsontime.Duration `json:"minDelay"`
+			MaxDelay   jsontime.Duration `json:"maxDelay"`
+			MaxHedges  int               `json:"maxHedges"`
+			Writes     bool              `json:"writes"`
+		}{
+			Percentile: 95,
+			Window:     1000,
+			MaxDelay:   jsontime.Duration(time.Second),
+			MaxHedges:  1,
+		}
+		if err := decodeOptions("hedge", data, &cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Percentile < 0 || cfg.Percentile > 100 {
+			return nil, errors.New("invalid hedge config: percentile must be in [0, 100]")
+		}
+		if cfg.Window < 1 {
+			return nil, errors.New("invalid hedge config: window must be positive")
+		}
+		return Hedge{
+			Percentile: cfg.Percentile,
+			Window:     cfg.Window,
+			MinDelay:   time.Duration(cfg.MinDelay),
+			MaxDelay:   time.Duration(cfg.MaxDelay),
+			MaxHedges:  cfg.MaxHedges,
+			Writes:     cfg.Writes,
+		}.Wrap, nil
+	})
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+// RateLimit limits requests to QPS on average using a token bucket
+// that holds up to Burst tokens. Requests wait for a token.
+type RateLimit struct {
+	QPS   float64
+	Burst int
+}
+
+func (l RateLimit) Wrap(d db.DB) db.DB {
+	return &rateLimitDB{DB: d, b: tokenBucket{
+		rate:   l.QPS,
+		burst:  float64(l.Burst),
+		tokens: float64(l.Burst),
+		last:   time.Now(),
+	}}
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64 // negative if requests are waiting
+	last   time.Time
+}
+
+// take takes a token and returns how long to wait until it is available.
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type rateLimitDB struct {
+	db.DB
+	b tokenBucket
+}
+
+func (d *rateLimitDB) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	if err := sleep(ctx, d.b.take(time.Now())); err != nil {
+		return "", db.EmptyMeta(), err
+	}
+	return d.DB.Get(ctx, key)
+}
+
+func (d *rateLimitDB) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	if err := sleep(ctx, d.b.take(time.Now())); err != nil {
+		return db.EmptyMeta(), err
+	}
+	return d.DB.Put(ctx, key, val)
+}
+
+// ConcurrencyLimit allows at most Max requests to be outstanding.
+// Other requests wait for one to complete.
+type ConcurrencyLimit struct {
+	Max int
+}
+
+func (l ConcurrencyLimit) Wrap(d db.DB) db.DB {
+	return &concLimitDB{DB: d, sem: make(chan struct{}, l.Max)}
+}
+
+type concLimitDB struct {
+	db.DB
+	sem chan struct{}
+}
+
+func (d *concLimitDB) acquire(ctx context.Context) error {
+	select {
+	case d.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *concLimitDB) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	if err := d.acquire(ctx); err != nil {
+		return "", db.EmptyMeta(), err
+	}
+	defer func() { <-d.sem }()
+	return d.DB.Get(ctx, key)
+}
+
+func (d *concLimitDB) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	if err := d.acquire(ctx); err != nil {
+		return db.EmptyMeta(), err
+	}
+	defer func() { <-d.sem }()
+	return d.DB.Put(ctx, key, val)
+}
+
+func init() {
+	Register("ratelimit", func(data []byte) (Middleware, error) {
+		var cfg struct {
+			QPS   float64 `json:"qps"`
+			Burst int     `json:"burst"`
+		}
+		if err := decodeOptions("ratelimit", data, &cfg); err != nil {
+			return nil, err
+		}
+		if cfg.QPS <= 0 {
+			return nil, errors.New("invalid ratelimit config: qps must be positive")
+		}
+		if cfg.Burst < 1 {
+			cfg.Burst = 1
+		}
+		return RateLimit{QPS: cfg.QPS, Burst: cfg.Burst}.Wrap, nil
+	})
+	Register("concurrency", func(data []byte) (Middleware, error) {
+		var cfg struct {
+			Max int `json:"max"`
+		}
+		if err := decodeOptions("concurrency", data, &cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Max < 1 {
+			return nil, errors.New("invalid concurrency config: max must be positive")
+		}
+		return ConcurrencyLimit{Max: cfg.Max}.Wrap, nil
+	})
+}
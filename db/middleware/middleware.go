@@ -0,0 +1,73 @@
+// Package middleware provides wrappers for any db.DB that change how
+// requests are made, e.g. by retrying or rate limiting them.
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+// A Middleware wraps a DB.
+type Middleware func(db.DB) db.DB
+
+var mws = make(map[string]func(b []byte) (Middleware, error))
+
+func Register(name string, mkMW func(data []byte) (Middleware, error)) {
+	mws[name] = mkMW
+}
+
+func New(name string, cfgData []byte) (Middleware, error) {
+	if mkMW, ok := mws[name]; ok {
+		return mkMW(cfgData)
+	}
+	return nil, fmt.Errorf("unknown middleware: %s", name)
+}
+
+// Config configures one middleware in a chain.
+type Config struct {
+	Name    string          `json:"name"`
+	Options json.RawMessage `json:"options"`
+}
+
+// Chain wraps d in the middleware configured by cfgs.
+// The first middleware sees requests first.
+func Chain(d db.DB, cfgs []Config) (db.DB, error) {
+	for i := len(cfgs) - 1; i >= 0; i-- {
+		mw, err := New(cfgs[i].Name, []byte(cfgs[i].Options))
+		if err != nil {
+			return nil, err
+		}
+		d = mw(d)
+	}
+	return d, nil
+}
+
+// decodeOptions decodes data into v, leaving v unchanged if data is empty.
+func decodeOptions(name string, data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid %s config: %v", name, err)
+	}
+	return nil
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,223 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+// fakeDB serves requests with get and tracks how many are in flight.
+type fakeDB struct {
+	get func(n int64) (time.Duration, error) // delay and error of request n
+
+	reqs        int64
+	inflight    int64
+	maxInflight int64
+}
+
+func (d *fakeDB) serve(ctx context.Context) error {
+	n := atomic.AddInt64(&d.reqs, 1) - 1
+	in := atomic.AddInt64(&d.inflight, 1)
+	defer atomic.AddInt64(&d.inflight, -1)
+	for {
+		max := atomic.LoadInt64(&d.maxInflight)
+		if in <= max || atomic.CompareAndSwapInt64(&d.maxInflight, max, in) {
+			break
+		}
+	}
+	delay, err := d.get(n)
+	if serr := sleep(ctx, delay); serr != nil {
+		return serr
+	}
+	return err
+}
+
+func (d *fakeDB) Init(ctx context.Context) error { return nil }
+func (d *fakeDB) Close() error                   { return nil }
+
+func (d *fakeDB) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	err := d.serve(ctx)
+	return key, db.EmptyMeta(), err
+}
+
+func (d *fakeDB) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	return db.EmptyMeta(), d.serve(ctx)
+}
+
+var errFake = errors.New("fake error")
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		fails   int64
+		retries int
+		wantErr bool
+	}{
+		{0, 3, false},
+		{2, 3, false},
+		{3, 3, false},
+		{4, 3, true},
+		{1, 0, true},
+	}
+	for _, test := range tests {
+		fdb := &fakeDB{get: func(n int64) (time.Duration, error) {
+			if n < test.fails {
+				return 0, errFake
+			}
+			return 0, nil
+		}}
+		d := Retry{MaxRetries: test.retries, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, Multiplier: 2}.Wrap(fdb)
+		_, _, err := d.Get(context.Background(), "k")
+		if (err != nil) != test.wantErr {
+			t.Errorf("%d fails, %d retries: got err %v, want err: %t", test.fails, test.retries, err, test.wantErr)
+		}
+		want := test.fails + 1
+		if max := int64(test.retries) + 1; want > max {
+			want = max
+		}
+		if fdb.reqs != want {
+			t.Errorf("%d fails, %d retries: sent %d requests, want %d", test.fails, test.retries, fdb.reqs, want)
+		}
+	}
+}
+
+func TestHedge(t *testing.T) {
+	t.Parallel()
+	// every 10th request is slow
+	fdb := &fakeDB{get: func(n int64) (time.Duration, error) {
+		if n%10 == 9 {
+			return time.Second, nil
+		}
+		return time.Millisecond, nil
+	}}
+	d := Hedge{Percentile: 50, Window: 100, MaxDelay: time.Second, MaxHedges: 1}.Wrap(fdb)
+	ctx := context.Background()
+	// warm up the delay estimate
+	for i := 0; i < 20; i++ {
+		if _, _, err := d.Get(ctx, "k"); err != nil {
+			t.Fatalf("unable to get: %v", err)
+		}
+	}
+	for atomic.LoadInt64(&fdb.reqs)%10 != 9 {
+		d.Get(ctx, "k")
+	}
+	start := time.Now()
+	if _, _, err := d.Get(ctx, "k"); err != nil {
+		t.Fatalf("unable to get: %v", err)
+	}
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Errorf("slow request took %v, want it to be hedged", took)
+	}
+
+	// writes are not hedged
+	for atomic.LoadInt64(&fdb.reqs)%10 != 9 {
+		d.Put(ctx, "k", "v")
+	}
+	start = time.Now()
+	d.Put(ctx, "k", "v")
+	if took := time.Since(start); took < time.Second {
+		t.Errorf("slow write took %v, want it not to be hedged", took)
+	}
+}
+
+func TestHedgeDelay(t *testing.T) {
+	t.Parallel()
+	// latencies are spread evenly over 0.5ms to 5ms
+	fdb := &fakeDB{get: func(n int64) (time.Duration, error) {
+		return time.Duration(n%10+1) * 500 * time.Microsecond, nil
+	}}
+	d := Hedge{Percentile: 50, Window: 50, MaxDelay: time.Second, MaxHedges: 1}.Wrap(fdb)
+	ctx := context.Background()
+	for i := 0; i < 300; i++ {
+		if _, _, err := d.Get(ctx, "k"); err != nil {
+			t.Fatalf("unable to get: %v", err)
+		}
+	}
+	// hedged requests must not pull the delay below the median
+	if delay := time.Duration(atomic.LoadInt64(&d.(*hedgeDB).delay)); delay < 2*time.Millisecond {
+		t.Errorf("got delay %v, want about 2.5ms", delay)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+	fdb := &fakeDB{get: func(int64) (time.Duration, error) { return 0, nil }}
+	d := RateLimit{QPS: 200, Burst: 10}.Wrap(fdb)
+	start := time.Now()
+	for i := 0; i < 60; i++ {
+		d.Get(context.Background(), "k")
+	}
+	// 10 requests are sent right away and the rest at 200 qps
+	if took := time.Since(start); took < 200*time.Millisecond || took > time.Second {
+		t.Errorf("60 requests took %v, want about 250ms", took)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	d = RateLimit{QPS: 1, Burst: 1}.Wrap(fdb)
+	d.Get(ctx, "k")
+	if _, _, err := d.Get(ctx, "k"); err == nil {
+		t.Error("want error when context expires while waiting")
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	t.Parallel()
+	fdb := &fakeDB{get: func(int64) (time.Duration, error) { return 5 * time.Millisecond, nil }}
+	d := ConcurrencyLimit{Max: 3}.Wrap(fdb)
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.Put(context.Background(), "k", "v")
+		}()
+	}
+	wg.Wait()
+	if fdb.reqs != 30 || fdb.maxInflight > 3 {
+		t.Errorf("sent %d requests with up to %d in flight, want 30 with up to 3", fdb.reqs, fdb.maxInflight)
+	}
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+	fdb := &fakeDB{get: func(n int64) (time.Duration, error) {
+		if n == 0 {
+			return 0, errFake
+		}
+		return 0, nil
+	}}
+	d, err := Chain(fdb, []Config{
+		{Name: "concurrency", Options: []byte(`{"max": 2}`)},
+		{Name: "retry", Options: []byte(`{"maxRetries": 1, "backoff": "1ms"}`)},
+		{Name: "ratelimit", Options: []byte(`{"qps": 1000}`)},
+		{Name: "hedge"},
+	})
+	if err != nil {
+		t.Fatalf("unable to make chain: %v", err)
+	}
+	if _, _, err := d.Get(context.Background(), "k"); err != nil {
+		t.Errorf("got error %v, want it to be retried", err)
+	}
+	if _, ok := d.(*concLimitDB); !ok {
+		t.Errorf("outermost db is %T, want the first middleware", d)
+	}
+
+	bad := [][]Config{
+		{{Name: "nope"}},
+		{{Name: "retry", Options: []byte(`{"backoff": "soon"}`)}},
+		{{Name: "ratelimit"}},
+		{{Name: "concurrency", Options: []byte(`{"max": 0}`)}},
+		{{Name: "hedge", Options: []byte(`{"percentile": 101}`)}},
+	}
+	for _, cfgs := range bad {
+		if _, err := Chain(fdb, cfgs); err == nil {
+			t.Errorf("%s: want error", cfgs[0].Options)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+	"github.com/uluyol/fabbench/internal/jsontime"
+)
+
+// Retry retries failed requests up to MaxRetries times.
+// The first retry is after Backoff, and each subsequent one waits
+// Multiplier times longer, up to MaxBackoff.
+type Retry struct {
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+}
+
+func (r Retry) Wrap(d db.DB) db.DB { return &retryDB{DB: d, r: r} }
+
+type retryDB struct {
+	db.DB
+	r Retry
+}
+
+func (d *retryDB) do(ctx context.Context, f func() error) error {
+	err := f()
+	backoff := d.r.Backoff
+	for retry := 0; err != nil && retry < d.r.MaxRetries; retry++ {
+		if sleep(ctx, backoff) != nil {
+			return err
+		}
+		err = f()
+		backoff = time.Duration(float64(backoff) * d.r.Multiplier)
+		if backoff > d.r.MaxBackoff {
+			backoff = d.r.MaxBackoff
+		}
+	}
+	return err
+}
+
+func (d *retryDB) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	var val string
+	var meta db.Meta
+	err := d.do(ctx, func() error {
+		var err error
+		val, meta, err = d.DB.Get(ctx, key)
+		return err
+	})
+	return val, meta, err
+}
+
+func (d *retryDB) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	var meta db.Meta
+	err := d.do(ctx, func() error {
+		var err error
+		meta, err = d.DB.Put(ctx, key, val)
+		return err
+	})
+	return meta, err
+}
+
+func init() {
+	Register("retry", func(data []byte) (Middleware, error) {
+		cfg := struct {
+			MaxRetries int               `json:"maxRetries"`
+			Backoff    jsontime.Duration `json:"backoff"`
+			MaxBackoff jsontime.Duration `json:"maxBackoff"`
+			Multiplier float64           `json:"multiplier"`
+		}{
+			MaxRetries: 3,
+			Backoff:    jsontime.Duration(5 * time.Millisecond),
+			MaxBackoff: jsontime.Duration(time.Second),
+			Multiplier: 5,
+		}
+		if err := decodeOptions("retry", data, &cfg); err != nil {
+			return nil, err
+		}
+		return Retry{
+			MaxRetries: cfg.MaxRetries,
+			Backoff:    time.Duration(cfg.Backoff),
+			MaxBackoff: time.Duration(cfg.MaxBackoff),
+			Multiplier: cfg.Multiplier,
+		}.Wrap, nil
+	})
+}
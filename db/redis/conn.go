@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+type result struct {
+	v   interface{}
+	err error
+}
+
+// conn is a connection to a node that pipelines commands:
+// up to cap(sem) commands may await replies at once.
+type conn struct {
+	nc  net.Conn
+	sem chan struct{}
+
+	wmu     sync.Mutex // protects bw, pending and err
+	bw      *bufio.Writer
+	pending chan chan result // reply channels in command order
+	err     error            // set once the connection fails
+
+	done chan struct{} // closed when the connection fails
+}
+
+func dialConn(addr string, timeout time.Duration, pipeline int) (*conn, error) {
+	nc, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{
+		nc:      nc,
+		sem:     make(chan struct{}, pipeline),
+		bw:      bufio.NewWriter(nc),
+		pending: make(chan chan result, pipeline),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(bufio.NewReader(nc))
+	return c, nil
+}
+
+func (c *conn) broken() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// do sends a command and waits for its reply.
+func (c *conn) do(ctx context.Context, args ...string) (interface{}, error) {
+	select {
+	case c.sem <- struct{}{}:
+	case <-c.done:
+		return nil, c.failure()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	ch := make(chan result, 1)
+
+	c.wmu.Lock()
+	if err := c.err; err != nil {
+		c.wmu.Unlock()
+		<-c.sem
+		return nil, err
+	}
+	writeCommand(c.bw, args...)
+	c.pending <- ch
+	if err := c.bw.Flush(); err != nil {
+		// the read loop fails the pending commands
+		c.nc.Close()
+	}
+	c.wmu.Unlock()
+
+	select {
+	case r := <-ch:
+		return r.v, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *conn) readLoop(br *bufio.Reader) {
+	for {
+		v, err := readReply(br)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		ch := <-c.pending
+		<-c.sem
+		if e, ok := v.(respError); ok {
+			ch <- result{err: e}
+		} else {
+			ch <- result{v: v}
+		}
+	}
+}
+
+func (c *conn) failure() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.err
+}
+
+// fail closes the connection and fails all pending commands.
+func (c *conn) fail(err error) {
+	c.wmu.Lock()
+	if c.err == nil {
+		c.err = err
+		c.nc.Close()
+		close(c.done)
+	}
+	c.wmu.Unlock()
+	for {
+		select {
+		case ch := <-c.pending:
+			<-c.sem
+			ch <- result{err: c.err}
+		default:
+			return
+		}
+	}
+}
+
+func (c *conn) close() { c.fail(errors.New("redis: connection closed")) }
@@ -0,0 +1,354 @@
+// Package redis provides a DB that stores data in Redis,
+// either in standalone servers or in a Redis Cluster.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+const numSlots = 16384
+
+type conf struct {
+	Cluster        bool   `json:"cluster"`
+	ConnsPerHost   int    `json:"connsPerHost"`
+	Pipeline       int    `json:"pipeline"`
+	MaxRedirects   *int   `json:"maxRedirects,omitempty"`
+	ConnectTimeout string `json:"connectTimeout"`
+}
+
+type hostInfo string
+
+func (hi hostInfo) ID() string { return string(hi) }
+
+// node is a Redis server with a fixed number of lazily dialed connections.
+type node struct {
+	addr string
+	next uint32 // atomic
+
+	mu    sync.Mutex
+	conns []*conn
+}
+
+func (n *node) getConn(c *client) (*conn, error) {
+	i := int(atomic.AddUint32(&n.next, 1)) % len(n.conns)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conns[i] == nil || n.conns[i].broken() {
+		cn, err := dialConn(n.addr, c.connectTimeout, c.cfg.Pipeline)
+		if err != nil {
+			return nil, err
+		}
+		n.conns[i] = cn
+	}
+	return n.conns[i], nil
+}
+
+func (n *node) do(ctx context.Context, c *client, args ...string) (interface{}, error) {
+	cn, err := n.getConn(c)
+	if err != nil {
+		return nil, err
+	}
+	return cn.do(ctx, args...)
+}
+
+// asking sends a command to n after ASKING on a dedicated connection,
+// so that no other command is sent in between.
+func (n *node) asking(ctx context.Context, c *client, args ...string) (interface{}, error) {
+	cn, err := dialConn(n.addr, c.connectTimeout, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer cn.close()
+	if _, err := cn.do(ctx, "ASKING"); err != nil {
+		return nil, err
+	}
+	return cn.do(ctx, args...)
+}
+
+func (n *node) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, cn := range n.conns {
+		if cn != nil {
+			cn.close()
+		}
+	}
+}
+
+type client struct {
+	cfg            conf
+	connectTimeout time.Duration
+	seeds          []string
+
+	mu    sync.Mutex
+	nodes map[string]*node
+
+	// In cluster mode, slots maps slots to the nodes that serve them.
+	// Otherwise, keys are sharded over static by slot.
+	smu    sync.RWMutex
+	slots  []*node
+	static []*node
+}
+
+func (c *client) nodeFor(addr string) *node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.nodes[addr]
+	if n == nil {
+		n = &node{addr: addr, conns: make([]*conn, c.cfg.ConnsPerHost)}
+		c.nodes[addr] = n
+	}
+	return n
+}
+
+// refreshSlots gets the slots served by each node in the cluster.
+func (c *client) refreshSlots(ctx context.Context) error {
+	var lastErr error
+	seeds := c.seeds
+	c.smu.RLock()
+	for _, n := range c.slots {
+		if n != nil {
+			seeds = append([]string{n.addr}, seeds...)
+			break
+		}
+	}
+	c.smu.RUnlock()
+	for _, addr := range seeds {
+		v, err := c.nodeFor(addr).do(ctx, c, "CLUSTER", "SLOTS")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		slots, err := c.parseSlots(v)
+		if err != nil {
+			return err
+		}
+		c.smu.Lock()
+		c.slots = slots
+		c.smu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("redis: unable to get cluster slots: %v", lastErr)
+}
+
+func (c *client) parseSlots(v interface{}) ([]*node, error) {
+	bad := errors.New("redis: bad CLUSTER SLOTS reply")
+	ranges, ok := v.([]interface{})
+	if !ok {
+		return nil, bad
+	}
+	slots := make([]*node, numSlots)
+	for _, r := range ranges {
+		f, ok := r.([]interface{})
+		if !ok || len(f) < 3 {
+			return nil, bad
+		}
+		start, ok1 := f[0].(int64)
+		end, ok2 := f[1].(int64)
+		master, ok3 := f[2].([]interface{})
+		if !ok1 || !ok2 || !ok3 || len(master) < 2 || start < 0 || end >= numSlots || start > end {
+			return nil, bad
+		}
+		host, ok1 := master[0].([]byte)
+		port, ok2 := master[1].(int64)
+		if !ok1 || !ok2 {
+			return nil, bad
+		}
+		n := c.nodeFor(net.JoinHostPort(string(host), strconv.FormatInt(port, 10)))
+		for s := start; s <= end; s++ {
+			slots[s] = n
+		}
+	}
+	return slots, nil
+}
+
+// nodeForKey returns the node that commands for key are first sent to.
+func (c *client) nodeForKey(ctx context.Context, key string) (*node, error) {
+	slot := keySlot(key)
+	if !c.cfg.Cluster {
+		return c.static[slot%len(c.static)], nil
+	}
+
+	c.smu.RLock()
+	n := c.slots[slot]
+	c.smu.RUnlock()
+	if n == nil {
+		if err := c.refreshSlots(ctx); err != nil {
+			return nil, err
+		}
+		c.smu.RLock()
+		n = c.slots[slot]
+		c.smu.RUnlock()
+		if n == nil {
+			return nil, fmt.Errorf("redis: no node serves slot %d", slot)
+		}
+	}
+	return n, nil
+}
+
+// PickHost returns the node that serves key.
+// In cluster mode, the request may still be redirected to another node.
+func (c *client) PickHost(ctx context.Context, key string) (context.Context, db.HostInfo) {
+	n, err := c.nodeForKey(ctx, key)
+	if err != nil {
+		return ctx, nil
+	}
+	return ctx, hostInfo(n.addr)
+}
+
+// do sends a command for key to the node that serves it,
+// following cluster redirections.
+func (c *client) do(ctx context.Context, key string, args ...string) (interface{}, *node, error) {
+	n, err := c.nodeForKey(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.cfg.Cluster {
+		v, err := n.do(ctx, c, args...)
+		return v, n, err
+	}
+	slot := keySlot(key)
+
+	ask := false
+	for i := 0; ; i++ {
+		var v interface{}
+		var err error
+		if ask {
+			v, err = n.asking(ctx, c, args...)
+		} else {
+			v, err = n.do(ctx, c, args...)
+		}
+		re, ok := err.(respError)
+		if !ok || i >= *c.cfg.MaxRedirects {
+			return v, n, err
+		}
+		// MOVED SLOT ADDR or ASK SLOT ADDR
+		f := strings.Fields(string(re))
+		if len(f) != 3 || (f[0] != "MOVED" && f[0] != "ASK") {
+			return v, n, err
+		}
+		n = c.nodeFor(f[2])
+		ask = f[0] == "ASK"
+		if !ask {
+			c.smu.Lock()
+			c.slots[slot] = n
+			c.smu.Unlock()
+		}
+	}
+}
+
+func meta(n *node) db.Meta {
+	if n == nil {
+		return db.EmptyMeta()
+	}
+	return db.MetaWithHostInfo(db.EmptyMeta(), hostInfo(n.addr))
+}
+
+// Init checks that the servers can be reached.
+// There is nothing to create in Redis.
+func (c *client) Init(ctx context.Context) error {
+	if c.cfg.Cluster {
+		return c.refreshSlots(ctx)
+	}
+	for _, n := range c.static {
+		if _, err := n.do(ctx, c, "PING"); err != nil {
+			return fmt.Errorf("redis: unable to reach %s: %v", n.addr, err)
+		}
+	}
+	return nil
+}
+
+func (c *client) Get(ctx context.Context, key string) (string, db.Meta, error) {
+	v, n, err := c.do(ctx, key, "GET", key)
+	if err != nil {
+		return "", meta(n), err
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", meta(n), nil
+	case []byte:
+		return string(v), meta(n), nil
+	}
+	return "", meta(n), fmt.Errorf("redis: unexpected GET reply %v", v)
+}
+
+func (c *client) Put(ctx context.Context, key, val string) (db.Meta, error) {
+	_, n, err := c.do(ctx, key, "SET", key, val)
+	return meta(n), err
+}
+
+func (c *client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range c.nodes {
+		n.close()
+	}
+	return nil
+}
+
+func makeDB(hosts []string, data []byte) (db.DB, error) {
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+	var cfg conf
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid redis config: %v", err)
+	}
+	if cfg.ConnsPerHost == 0 {
+		cfg.ConnsPerHost = 1
+	}
+	if cfg.Pipeline == 0 {
+		cfg.Pipeline = 1
+	}
+	if cfg.MaxRedirects == nil {
+		cfg.MaxRedirects = new(int)
+		*cfg.MaxRedirects = 5
+	}
+	if cfg.ConnectTimeout == "" {
+		cfg.ConnectTimeout = "5s"
+	}
+	if cfg.ConnsPerHost < 0 || cfg.Pipeline < 0 || *cfg.MaxRedirects < 0 {
+		return nil, errors.New("invalid redis config: connsPerHost, pipeline and maxRedirects must not be negative")
+	}
+	c := &client{cfg: cfg, nodes: make(map[string]*node)}
+	var err error
+	if c.connectTimeout, err = time.ParseDuration(cfg.ConnectTimeout); err != nil {
+		return nil, fmt.Errorf("invalid redis config: bad connectTimeout: %v", err)
+	}
+
+	for _, h := range hosts {
+		if h == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			h = net.JoinHostPort(h, "6379")
+		}
+		c.seeds = append(c.seeds, h)
+	}
+	if len(c.seeds) == 0 {
+		return nil, errors.New("redis: no host")
+	}
+	if cfg.Cluster {
+		c.slots = make([]*node, numSlots)
+	} else {
+		for _, h := range c.seeds {
+			c.static = append(c.static, c.nodeFor(h))
+		}
+	}
+	return c, nil
+}
+
+func init() {
+	db.Register("redis", makeDB)
+}
@@ -0,0 +1,229 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uluyol/fabbench/db"
+)
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"123456789", 0x31C3},
+		{"foo", 12182},
+		{"bar", 5061},
+		{"{user1000}.following", keySlot("user1000")},
+		{"{user1000}.followers", keySlot("user1000")},
+		{"foo{}{bar}", int(crc16("foo{}{bar}")) % numSlots},
+		{"foo{{bar}}zap", keySlot("{bar")},
+	}
+	for _, test := range tests {
+		if got := keySlot(test.key); got != test.want {
+			t.Errorf("%s: got slot %d, want %d", test.key, got, test.want)
+		}
+	}
+}
+
+func dial(t *testing.T, hosts []string, opts string) db.DB {
+	d, err := db.Dial("redis", hosts, []byte(opts))
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	return d
+}
+
+func hostOf(t *testing.T, m db.Meta) string {
+	hi, ok := db.GetHostInfo(m)
+	if !ok {
+		t.Fatal("missing host info")
+	}
+	return hi.ID()
+}
+
+func TestStandalone(t *testing.T) {
+	ctx := context.Background()
+	s1, s2 := newFakeServer(t), newFakeServer(t)
+	defer s1.close()
+	defer s2.close()
+	d := dial(t, []string{s1.addr(), s2.addr()}, `{"connsPerHost": 2}`)
+	defer d.Close()
+	if err := d.Init(ctx); err != nil {
+		t.Fatalf("unable to init: %v", err)
+	}
+
+	served := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint("k", i)
+		m, err := d.Put(ctx, key, fmt.Sprint("v", i))
+		if err != nil {
+			t.Fatalf("unable to put: %v", err)
+		}
+		served[hostOf(t, m)]++
+		val, m, err := d.Get(ctx, key)
+		if err != nil || val != fmt.Sprint("v", i) {
+			t.Errorf("get %s: got %q, %v, want v%d", key, val, err, i)
+		}
+		if h := hostOf(t, m); h != s1.addr() && h != s2.addr() {
+			t.Errorf("get %s: served by unknown host %s", key, h)
+		}
+	}
+	if len(served) != 2 || len(s1.m)+len(s2.m) != 100 {
+		t.Errorf("want keys sharded over both servers, got %v", served)
+	}
+	if val, _, err := d.Get(ctx, "missing"); val != "" || err != nil {
+		t.Errorf("get missing key: got %q, %v, want empty value", val, err)
+	}
+}
+
+func TestPickHost(t *testing.T) {
+	ctx := context.Background()
+	s1, s2 := newFakeServer(t), newFakeServer(t)
+	defer s1.close()
+	defer s2.close()
+	d := dial(t, []string{s1.addr(), s2.addr()}, `{}`)
+	defer d.Close()
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprint("k", i)
+		pctx, want := d.(db.HostPicker).PickHost(ctx, key)
+		m, err := d.Put(pctx, key, "v")
+		if err != nil {
+			t.Fatalf("unable to put: %v", err)
+		}
+		if h := hostOf(t, m); h != want.ID() {
+			t.Errorf("put %s: served by %s, want picked host %s", key, h, want.ID())
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	for _, pipeline := range []int{1, 8} {
+		s := newFakeServer(t)
+		s.delay = time.Millisecond
+		d := dial(t, []string{s.addr()}, fmt.Sprintf(`{"pipeline": %d}`, pipeline))
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					key := fmt.Sprint(i, "-", j)
+					if _, err := d.Put(context.Background(), key, key); err != nil {
+						t.Errorf("pipeline %d: unable to put: %v", pipeline, err)
+					}
+					if val, _, _ := d.Get(context.Background(), key); val != key {
+						t.Errorf("pipeline %d: get %s: got %q", pipeline, key, val)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		d.Close()
+		s.close()
+		if got := atomic.LoadInt32(&s.pipelined) == 1; got != (pipeline > 1) {
+			t.Errorf("pipeline %d: got pipelined commands: %t", pipeline, got)
+		}
+	}
+}
+
+func TestCluster(t *testing.T) {
+	ctx := context.Background()
+	a, b := newFakeServer(t), newFakeServer(t)
+	defer a.close()
+	defer b.close()
+	a.cluster, a.lo, a.hi, a.other = true, 0, numSlots/2-1, b
+	b.cluster, b.lo, b.hi, b.other = true, numSlots/2, numSlots-1, a
+	truth := func() []interface{} {
+		return []interface{}{slotRange(0, numSlots/2-1, a), slotRange(numSlots/2, numSlots-1, b)}
+	}
+	// a thinks it serves every slot, so requests are MOVED to b
+	a.slots = func() []interface{} { return []interface{}{slotRange(0, numSlots-1, a)} }
+	b.slots = truth
+
+	d := dial(t, []string{a.addr()}, `{"cluster": true}`)
+	defer d.Close()
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint("k", i)
+		want := a.addr()
+		if keySlot(key) > a.hi {
+			want = b.addr()
+		}
+		m, err := d.Put(ctx, key, "v")
+		if err != nil {
+			t.Fatalf("unable to put %s: %v", key, err)
+		}
+		if got := hostOf(t, m); got != want {
+			t.Errorf("put %s: served by %s, want %s", key, got, want)
+		}
+		if val, m, err := d.Get(ctx, key); val != "v" || err != nil || hostOf(t, m) != want {
+			t.Errorf("get %s: got %q, %v from %s, want v from %s", key, val, err, hostOf(t, m), want)
+		}
+	}
+
+	// slots that are being migrated are redirected with ASK
+	a.slots = truth
+	a.askSlot = keySlot("bar")
+	if a.askSlot > a.hi {
+		t.Fatal("bar must be in a's slots")
+	}
+	d2 := dial(t, []string{a.addr()}, `{"cluster": true}`)
+	defer d2.Close()
+	if err := d2.Init(ctx); err != nil {
+		t.Fatalf("unable to init: %v", err)
+	}
+	m, err := d2.Put(ctx, "bar", "baz")
+	if err != nil || hostOf(t, m) != b.addr() {
+		t.Errorf("put bar: got %v from %s, want it to be served by %s", err, hostOf(t, m), b.addr())
+	}
+	if b.m["bar"] != "baz" {
+		t.Error("put bar: want it written to b")
+	}
+
+	d3 := dial(t, []string{a.addr()}, `{"cluster": true, "maxRedirects": 0}`)
+	defer d3.Close()
+	if _, err := d3.Put(ctx, "bar", "baz"); err == nil || !strings.Contains(err.Error(), "ASK") {
+		t.Errorf("put bar without redirects: got %v, want ASK error", err)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeServer(t)
+	defer s.close()
+	d := dial(t, []string{s.addr()}, `{}`)
+	defer d.Close()
+	if _, err := d.Put(ctx, "k", "v"); err != nil {
+		t.Fatalf("unable to put: %v", err)
+	}
+	s.dropConns()
+	var val string
+	for i := 0; i < 10 && val != "v"; i++ {
+		val, _, _ = d.Get(ctx, "k")
+	}
+	if val != "v" {
+		t.Error("unable to get after connection dropped")
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	tests := []struct {
+		hosts []string
+		opts  string
+	}{
+		{[]string{""}, `{}`},
+		{[]string{"localhost"}, `{"pipeline": -1}`},
+		{[]string{"localhost"}, `{"connectTimeout": "soon"}`},
+	}
+	for _, test := range tests {
+		if _, err := db.Dial("redis", test.hosts, []byte(test.opts)); err == nil {
+			t.Errorf("%v %s: want error", test.hosts, test.opts)
+		}
+	}
+}
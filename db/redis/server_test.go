@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeServer is an in-process stand-in for a Redis server
+// that supports enough commands for the tests.
+type fakeServer struct {
+	ln    net.Listener
+	delay time.Duration // before each reply
+
+	// In cluster mode, the server serves slots lo through hi,
+	// and redirects others to other.
+	cluster bool
+	lo, hi  int
+	other   *fakeServer
+	slots   func() []interface{} // reply to CLUSTER SLOTS
+	askSlot int                  // if >= 0, redirect this slot with ASK
+
+	mu    sync.Mutex
+	m     map[string]string
+	conns []net.Conn
+
+	pipelined int32 // atomic, set if commands arrive before earlier replies are sent
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	s := &fakeServer{ln: ln, m: make(map[string]string), askSlot: -1}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeServer) close() {
+	s.ln.Close()
+	s.dropConns()
+}
+
+func (s *fakeServer) dropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeServer) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, c)
+		s.mu.Unlock()
+		go s.serveConn(c)
+	}
+}
+
+func (s *fakeServer) serveConn(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+	asking := false
+	for {
+		v, err := readReply(br)
+		if err != nil {
+			return
+		}
+		if br.Buffered() > 0 {
+			atomic.StoreInt32(&s.pipelined, 1)
+		}
+		var args []string
+		for _, a := range v.([]interface{}) {
+			args = append(args, string(a.([]byte)))
+		}
+		time.Sleep(s.delay)
+		writeValue(bw, s.handle(args, &asking))
+		if err := bw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) handle(args []string, asking *bool) interface{} {
+	wasAsking := *asking
+	*asking = false
+	switch args[0] {
+	case "PING":
+		return "PONG"
+	case "ASKING":
+		*asking = true
+		return "OK"
+	case "CLUSTER":
+		return s.slots()
+	case "GET", "SET":
+	default:
+		return respError("ERR unknown command")
+	}
+
+	if s.cluster {
+		slot := keySlot(args[1])
+		if slot == s.askSlot {
+			return respError(fmt.Sprintf("ASK %d %s", slot, s.other.addr()))
+		}
+		if (slot < s.lo || slot > s.hi) && !wasAsking {
+			return respError(fmt.Sprintf("MOVED %d %s", slot, s.other.addr()))
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if args[0] == "SET" {
+		s.m[args[1]] = args[2]
+		return "OK"
+	}
+	if v, ok := s.m[args[1]]; ok {
+		return []byte(v)
+	}
+	return nil
+}
+
+func writeValue(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		w.WriteString("+" + v + "\r\n")
+	case respError:
+		w.WriteString("-" + string(v) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case []byte:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + string(v) + "\r\n")
+	case []interface{}:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			writeValue(w, e)
+		}
+	}
+}
+
+// slotRange returns an entry of a CLUSTER SLOTS reply.
+func slotRange(lo, hi int, s *fakeServer) interface{} {
+	host, port, _ := net.SplitHostPort(s.addr())
+	p, _ := strconv.ParseInt(port, 10, 64)
+	return []interface{}{int64(lo), int64(hi), []interface{}{[]byte(host), p, []byte("id")}}
+}
@@ -0,0 +1,31 @@
+package redis
+
+import "strings"
+
+// keySlot returns the cluster slot of key. Like Redis, only the part
+// of the key between the first { and the next } is hashed if it is
+// not empty, so related keys can be kept in the same slot.
+func keySlot(key string) int {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return int(crc16(key)) % numSlots
+}
+
+// crc16 is CRC-16/XMODEM, as used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for b := 0; b < 8; b++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
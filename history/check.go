@@ -0,0 +1,209 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+/*
+
+CheckKey uses the algorithm from "Testing for Linearizability",
+Gavin Lowe, 2017, as used by Porcupine and Knossos.
+
+Operations are turned into a list of call and return entries sorted by time.
+We walk the list, tentatively linearizing each operation at its call entry
+if the register model allows it. Reaching a return entry for an operation
+that has not been linearized means that a previous choice was wrong,
+so we backtrack. Previously seen (linearized set, state) pairs are cached
+to prune the search.
+
+The model is a register whose initial value is unknown:
+the first read of an unknown register fixes its value.
+
+*/
+
+// ErrTimeout is returned by CheckKey if the deadline passes
+// before the check completes.
+var ErrTimeout = errors.New("check timed out")
+
+type entry struct {
+	op     int
+	isCall bool
+	time   int64
+	match  *entry // call <-> return
+	prev   *entry
+	next   *entry
+}
+
+func (e *entry) lift() {
+	e.prev.next = e.next
+	if e.next != nil {
+		e.next.prev = e.prev
+	}
+	r := e.match
+	r.prev.next = r.next
+	if r.next != nil {
+		r.next.prev = r.prev
+	}
+}
+
+func (e *entry) unlift() {
+	r := e.match
+	r.prev.next = r
+	if r.next != nil {
+		r.next.prev = r
+	}
+	e.prev.next = e
+	if e.next != nil {
+		e.next.prev = e
+	}
+}
+
+const unknownState = "\x00unknown"
+
+func step(state string, op *Operation) (string, bool) {
+	switch op.Op {
+	case Put:
+		return op.Value, true
+	case Get:
+		if state == unknownState || state == op.Value {
+			return op.Value, true
+		}
+	}
+	return state, false
+}
+
+type bitset []uint64
+
+func newBitset(n int) bitset { return make(bitset, (n+63)/64) }
+
+func (b bitset) set(i int)   { b[i/64] |= 1 << uint(i%64) }
+func (b bitset) clear(i int) { b[i/64] &^= 1 << uint(i%64) }
+
+func (b bitset) key(state string) string {
+	buf := make([]byte, 0, 8*len(b)+len(state))
+	for _, w := range b {
+		for i := uint(0); i < 64; i += 8 {
+			buf = append(buf, byte(w>>i))
+		}
+	}
+	return string(append(buf, state...))
+}
+
+// A Violation describes why a history is not linearizable.
+type Violation struct {
+	// Op is the operation that could not be linearized
+	// by the time it returned.
+	Op Operation
+
+	// Linearized is the longest sequence of operations
+	// that was successfully linearized before reaching Op.
+	Linearized []Operation
+}
+
+// CheckKey checks whether the operations on a single key are linearizable.
+// If they are not, a non-nil Violation is returned.
+// A zero deadline means that there is no time limit.
+// Operations must not return before they are called.
+func CheckKey(ops []Operation, deadline time.Time) (*Violation, error) {
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	for i := range ops {
+		if ops[i].Return < ops[i].Call {
+			return nil, fmt.Errorf("op %d by %s returns before it is called", ops[i].OpID, ops[i].Client)
+		}
+	}
+
+	entries := make([]entry, 2*len(ops))
+	for i := range ops {
+		c := &entries[2*i]
+		r := &entries[2*i+1]
+		*c = entry{op: i, isCall: true, time: ops[i].Call, match: r}
+		*r = entry{op: i, time: ops[i].Return, match: c}
+	}
+	sorted := make([]*entry, len(entries))
+	for i := range entries {
+		sorted[i] = &entries[i]
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].time != sorted[j].time {
+			return sorted[i].time < sorted[j].time
+		}
+		// Treat operations that touch as concurrent.
+		return sorted[i].isCall && !sorted[j].isCall
+	})
+
+	head := &entry{}
+	prev := head
+	for _, e := range sorted {
+		prev.next = e
+		e.prev = prev
+		prev = e
+	}
+
+	type frame struct {
+		e     *entry
+		state string
+	}
+	var stack []frame
+	var best []int
+
+	linearized := newBitset(len(ops))
+	cache := make(map[string]struct{})
+	state := unknownState
+	e := head.next
+	iter := 0
+	for head.next != nil && e != nil {
+		iter++
+		if !deadline.IsZero() && iter%1024 == 0 && time.Now().After(deadline) {
+			return nil, ErrTimeout
+		}
+		if e.isCall {
+			newState, ok := step(state, &ops[e.op])
+			if ok {
+				linearized.set(e.op)
+				k := linearized.key(newState)
+				if _, seen := cache[k]; !seen {
+					cache[k] = struct{}{}
+					stack = append(stack, frame{e, state})
+					state = newState
+					e.lift()
+					e = head.next
+					if len(stack) > len(best) {
+						best = best[:0]
+						for _, f := range stack {
+							best = append(best, f.e.op)
+						}
+					}
+					continue
+				}
+				linearized.clear(e.op)
+			}
+			e = e.next
+			continue
+		}
+
+		// reached the return of an op that wasn't linearized
+		if len(stack) == 0 {
+			v := &Violation{Op: ops[e.op]}
+			for _, i := range best {
+				v.Linearized = append(v.Linearized, ops[i])
+			}
+			return v, nil
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		state = top.state
+		linearized.clear(top.e.op)
+		top.e.unlift()
+		e = top.e.next
+	}
+	if head.next != nil {
+		// e ran off the end, only possible if some call is after its return
+		return nil, errors.New("ran out of entries while checking")
+	}
+	return nil, nil
+}
@@ -0,0 +1,311 @@
+// Package history records and checks histories of operations
+// for linearizability.
+//
+// A history is a text file with one event per line:
+//
+//	TYPE CLIENT OPID OP KEY VALUE UNIXNANOS
+//
+// TYPE is one of invoke, ok, or info.
+// An ok event means the operation completed successfully.
+// An info event means the operation failed,
+// but it is unknown whether or not it took effect.
+// OP is get or put, and VALUE is the ID of the value
+// written by a put or returned by a get (- if unknown).
+package history
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uluyol/fabbench/internal/fnv"
+)
+
+type EventType uint8
+
+const (
+	Invoke EventType = iota + 1
+	OK
+	Info
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Invoke:
+		return "invoke"
+	case OK:
+		return "ok"
+	case Info:
+		return "info"
+	}
+	return fmt.Sprintf("unknown(%d)", t)
+}
+
+type Op uint8
+
+const (
+	Get Op = iota + 1
+	Put
+)
+
+func (o Op) String() string {
+	switch o {
+	case Get:
+		return "get"
+	case Put:
+		return "put"
+	}
+	return fmt.Sprintf("unknown(%d)", o)
+}
+
+type Event struct {
+	Type   EventType
+	Client string
+	OpID   int64
+	Op     Op
+	Key    string
+	Value  string
+	Time   int64 // unix nanos
+}
+
+const (
+	noValue  = "-"
+	nilValue = "nil"
+)
+
+// ValueID returns a short ID for val.
+// Empty values (e.g. missing keys) have ID nil.
+func ValueID(val string) string {
+	if val == "" {
+		return nilValue
+	}
+	return strconv.FormatUint(fnv.HashString(val), 16)
+}
+
+// Writer writes events to a history.
+// It is safe for concurrent use.
+type Writer struct {
+	client string
+	nextID int64
+
+	mu  sync.Mutex
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter creates a Writer that writes events for client to w.
+// Whitespace in client is replaced with underscores.
+func NewWriter(w io.Writer, client string) *Writer {
+	client = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, client)
+	if client == "" {
+		client = "_"
+	}
+	return &Writer{client: client, w: bufio.NewWriter(w)}
+}
+
+func (w *Writer) write(typ EventType, id int64, op Op, key, value string) {
+	t := time.Now().UnixNano()
+	w.mu.Lock()
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, "%s %s %d %s %s %s %d\n", typ, w.client, id, op, key, value, t)
+	}
+	w.mu.Unlock()
+}
+
+// Invoke records the start of an operation and returns its ID.
+// For puts, val is the value being written.
+func (w *Writer) Invoke(op Op, key, val string) int64 {
+	if w == nil {
+		return 0
+	}
+	id := atomic.AddInt64(&w.nextID, 1)
+	v := noValue
+	if op == Put {
+		v = ValueID(val)
+	}
+	w.write(Invoke, id, op, key, v)
+	return id
+}
+
+// Complete records the end of an operation started with Invoke.
+// For gets, val is the value that was read.
+func (w *Writer) Complete(id int64, op Op, key, val string, err error) {
+	if w == nil {
+		return
+	}
+	typ := OK
+	v := noValue
+	if err != nil {
+		typ = Info
+	} else if op == Get {
+		v = ValueID(val)
+	}
+	w.write(typ, id, op, key, v)
+}
+
+// Flush writes any buffered events and returns the first error encountered.
+func (w *Writer) Flush() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.w.Flush()
+	return w.err
+}
+
+func parseEventType(s string) (EventType, error) {
+	switch s {
+	case "invoke":
+		return Invoke, nil
+	case "ok":
+		return OK, nil
+	case "info":
+		return Info, nil
+	}
+	return 0, fmt.Errorf("unknown event type: %s", s)
+}
+
+func parseOp(s string) (Op, error) {
+	switch s {
+	case "get":
+		return Get, nil
+	case "put":
+		return Put, nil
+	}
+	return 0, fmt.Errorf("unknown op: %s", s)
+}
+
+// ReadEvents reads all events in a history.
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	s := bufio.NewScanner(r)
+	lineno := 0
+	for s.Scan() {
+		lineno++
+		t := s.Text()
+		if strings.TrimSpace(t) == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		fields := strings.Fields(t)
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%d: want 7 fields, have %d", lineno, len(fields))
+		}
+		var ev Event
+		var err error
+		if ev.Type, err = parseEventType(fields[0]); err != nil {
+			return nil, fmt.Errorf("%d: %v", lineno, err)
+		}
+		ev.Client = fields[1]
+		if ev.OpID, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+			return nil, fmt.Errorf("%d: bad op id: %v", lineno, err)
+		}
+		if ev.Op, err = parseOp(fields[3]); err != nil {
+			return nil, fmt.Errorf("%d: %v", lineno, err)
+		}
+		ev.Key = fields[4]
+		ev.Value = fields[5]
+		if ev.Time, err = strconv.ParseInt(fields[6], 10, 64); err != nil {
+			return nil, fmt.Errorf("%d: bad time: %v", lineno, err)
+		}
+		events = append(events, ev)
+	}
+	return events, s.Err()
+}
+
+// An Operation is a pair of invoke and completion events.
+type Operation struct {
+	Client string
+	OpID   int64
+	Op     Op
+	Key    string
+	Value  string
+	Call   int64 // unix nanos
+	Return int64 // unix nanos, math.MaxInt64 if unknown
+
+	// Indeterminate is set when the operation failed
+	// or never completed, so it may or may not have taken effect.
+	Indeterminate bool
+}
+
+const maxTime = int64(^uint64(0) >> 1)
+
+// Pair matches invoke events with their completions
+// and groups the resulting operations by key.
+//
+// Gets that did not complete successfully are dropped
+// since they cannot affect the state of the system.
+// Completions that are timestamped before their invocation,
+// e.g. if the clock stepped back, are moved to the invocation time.
+func Pair(events []Event) (map[string][]Operation, error) {
+	type opKey struct {
+		client string
+		id     int64
+	}
+	pending := make(map[opKey]Operation)
+	byKey := make(map[string][]Operation)
+	for _, ev := range events {
+		k := opKey{ev.Client, ev.OpID}
+		switch ev.Type {
+		case Invoke:
+			if _, ok := pending[k]; ok {
+				return nil, fmt.Errorf("duplicate invoke of op %d by %s", ev.OpID, ev.Client)
+			}
+			pending[k] = Operation{
+				Client: ev.Client,
+				OpID:   ev.OpID,
+				Op:     ev.Op,
+				Key:    ev.Key,
+				Value:  ev.Value,
+				Call:   ev.Time,
+			}
+		case OK, Info:
+			op, ok := pending[k]
+			if !ok {
+				return nil, fmt.Errorf("completion of op %d by %s without invoke", ev.OpID, ev.Client)
+			}
+			delete(pending, k)
+			if ev.Type == Info {
+				if op.Op == Get {
+					continue
+				}
+				op.Indeterminate = true
+				op.Return = maxTime
+			} else {
+				op.Return = ev.Time
+				if op.Return < op.Call {
+					op.Return = op.Call
+				}
+				if op.Op == Get {
+					op.Value = ev.Value
+				}
+			}
+			byKey[op.Key] = append(byKey[op.Key], op)
+		default:
+			return nil, errors.New("unknown event type")
+		}
+	}
+	for _, op := range pending {
+		if op.Op == Get {
+			continue
+		}
+		op.Indeterminate = true
+		op.Return = maxTime
+		byKey[op.Key] = append(byKey[op.Key], op)
+	}
+	return byKey, nil
+}
@@ -0,0 +1,131 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWriteReadPair(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, "client 0")
+	id0 := w.Invoke(Put, "k0", "v0")
+	id1 := w.Invoke(Get, "k0", "")
+	w.Complete(id0, Put, "k0", "v0", nil)
+	id2 := w.Invoke(Put, "k1", "v1")
+	w.Complete(id1, Get, "k0", "v0", nil)
+	id3 := w.Invoke(Get, "k1", "")
+	w.Complete(id2, Put, "k1", "v1", errors.New("timeout"))
+	w.Complete(id3, Get, "k1", "", errors.New("timeout"))
+	w.Invoke(Put, "k1", "v2")
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unable to flush: %v", err)
+	}
+
+	events, err := ReadEvents(&buf)
+	if err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	if len(events) != 9 {
+		t.Fatalf("want 9 events, got %d", len(events))
+	}
+	for _, ev := range events {
+		if ev.Client != "client_0" {
+			t.Errorf("bad client: %q", ev.Client)
+		}
+	}
+
+	byKey, err := Pair(events)
+	if err != nil {
+		t.Fatalf("unable to pair: %v", err)
+	}
+	k0 := byKey["k0"]
+	if len(k0) != 2 {
+		t.Fatalf("k0: want 2 ops, got %d", len(k0))
+	}
+	for _, op := range k0 {
+		if op.Value != ValueID("v0") || op.Indeterminate {
+			t.Errorf("k0: bad op %+v", op)
+		}
+	}
+	k1 := byKey["k1"]
+	if len(k1) != 2 {
+		t.Fatalf("k1: want 2 ops, got %d", len(k1))
+	}
+	for _, op := range k1 {
+		if op.Op != Put || !op.Indeterminate || op.Return != maxTime {
+			t.Errorf("k1: bad op %+v", op)
+		}
+	}
+}
+
+func put(v string, call, ret int64) Operation {
+	return Operation{Op: Put, Value: v, Call: call, Return: ret}
+}
+
+func get(v string, call, ret int64) Operation {
+	return Operation{Op: Get, Value: v, Call: call, Return: ret}
+}
+
+func putInfo(v string, call int64) Operation {
+	return Operation{Op: Put, Value: v, Call: call, Return: maxTime, Indeterminate: true}
+}
+
+func TestCheckKey(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		ops  []Operation
+		good bool
+	}{
+		{nil, true},
+		{[]Operation{put("a", 0, 10), get("a", 20, 30)}, true},
+		{[]Operation{put("a", 0, 10), get("b", 20, 30)}, false},
+		{[]Operation{get("x", 0, 5), put("a", 10, 20), get("a", 30, 40)}, true},
+		{[]Operation{get("x", 0, 5), get("y", 10, 20)}, false},
+		{[]Operation{put("a", 0, 10), put("b", 5, 15), get("a", 20, 30)}, true},
+		{[]Operation{put("a", 0, 10), put("b", 5, 15), get("a", 20, 30), get("b", 40, 50)}, false},
+		{[]Operation{put("a", 0, 10), put("b", 5, 15), get("b", 7, 30), get("a", 8, 50)}, true},
+		{[]Operation{put("a", 0, 10), put("b", 5, 15), get("b", 16, 18), get("a", 20, 50)}, false},
+		{[]Operation{put("a", 0, 10), put("b", 5, 45), get("a", 7, 30), get("b", 8, 50)}, true},
+		{[]Operation{put("a", 0, 10), putInfo("b", 15), get("b", 20, 30)}, true},
+		{[]Operation{put("a", 0, 10), putInfo("b", 15), get("a", 20, 30)}, true},
+		{[]Operation{put("a", 0, 10), putInfo("b", 15), get("b", 20, 30), get("a", 40, 50)}, false},
+		{[]Operation{put("a", 0, 10), get("a", 10, 20)}, true},
+	}
+
+	for i, test := range tests {
+		v, err := CheckKey(test.ops, time.Time{})
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if good := v == nil; good != test.good {
+			t.Errorf("case %d: want linearizable %t, got %t (%+v)", i, test.good, good, v)
+		}
+	}
+}
+
+func TestReturnBeforeCall(t *testing.T) {
+	t.Parallel()
+	ops := []Operation{put("a", 0, 10), put("b", 20, 15), get("b", 30, 40)}
+	if _, err := CheckKey(ops, time.Time{}); err == nil {
+		t.Errorf("want error for op that returns before its call")
+	}
+
+	events := []Event{
+		{Type: Invoke, Client: "c", OpID: 0, Op: Put, Key: "k", Value: "a", Time: 20},
+		{Type: OK, Client: "c", OpID: 0, Op: Put, Key: "k", Time: 15},
+	}
+	byKey, err := Pair(events)
+	if err != nil {
+		t.Fatalf("unable to pair: %v", err)
+	}
+	if op := byKey["k"][0]; op.Return != op.Call {
+		t.Errorf("want return clamped to call %d, got %d", op.Call, op.Return)
+	}
+	if _, err := CheckKey(byKey["k"], time.Time{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
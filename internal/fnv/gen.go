@@ -1,9 +1,11 @@
 package fnv
 
-func Hash64(v int64) int64 {
-	const fnvOffsetBasis64 = 0xCBF29CE484222325
-	const fnvPrime64 = 1099511628211
+const (
+	fnvOffsetBasis64 = 0xCBF29CE484222325
+	fnvPrime64       = 1099511628211
+)
 
+func Hash64(v int64) int64 {
 	var hashVal uint64 = fnvOffsetBasis64
 	for i := 0; i < 8; i++ {
 		octet := uint64(v) & 0x00ff
@@ -18,3 +20,14 @@ func Hash64(v int64) int64 {
 	}
 	return ret
 }
+
+// HashString returns the 64-bit FNV-1a hash of s
+// without allocating.
+func HashString(s string) uint64 {
+	var h uint64 = fnvOffsetBasis64
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
@@ -0,0 +1,24 @@
+// Package jsontime has time types for JSON configs.
+package jsontime
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration is a time.Duration that is written as a string in JSON
+// (e.g. "5ms").
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
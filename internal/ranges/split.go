@@ -23,14 +23,18 @@ type WorkShard struct {
 }
 
 func SplitRecords(n int64, numWorkers int64) []WorkShard {
-	maxSize := (n + numWorkers - 1) / numWorkers
+	size := n / numWorkers
+	rem := n % numWorkers
 	chunks := make([]WorkShard, numWorkers)
 	var cum int64
-	for i := int64(0); i < numWorkers-1; i++ {
-		chunks[i] = WorkShard{Start: cum, Count: maxSize}
-		cum += maxSize
+	for i := range chunks {
+		c := size
+		if int64(i) < rem {
+			c++
+		}
+		chunks[i] = WorkShard{Start: cum, Count: c}
+		cum += c
 	}
-	chunks[len(chunks)-1] = WorkShard{Start: cum, Count: n - cum}
 	return chunks
 }
 
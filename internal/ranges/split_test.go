@@ -81,3 +81,38 @@ func TestSplitRecords(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitRecordsUneven(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		numRec     int64
+		numWorkers int64
+	}{
+		{5, 4},
+		{3, 8},
+		{0, 3},
+		{1001, 10},
+		{17, 17},
+	}
+
+	for i, test := range tests {
+		shards := SplitRecords(test.numRec, test.numWorkers)
+		if int64(len(shards)) != test.numWorkers {
+			t.Errorf("case %d: want %d shards got %d", i, test.numWorkers, len(shards))
+			continue
+		}
+		var cum int64
+		for j, s := range shards {
+			if s.Start != cum {
+				t.Errorf("case %d: got wrong Start for chunk %d: want %d got %d", i, j, cum, s.Start)
+			}
+			if s.Count < 0 || s.Count-shards[len(shards)-1].Count > 1 {
+				t.Errorf("case %d: chunk %d has uneven Count %d", i, j, s.Count)
+			}
+			cum += s.Count
+		}
+		if cum != test.numRec {
+			t.Errorf("case %d: chunks don't sum to input: want %d got %d", i, test.numRec, cum)
+		}
+	}
+}
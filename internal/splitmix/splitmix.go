@@ -0,0 +1,23 @@
+// Package splitmix implements the SplitMix64 generator.
+package splitmix
+
+// Source is a small, fast rand.Source64.
+type Source struct{ s uint64 }
+
+func New(seed uint64) *Source { return &Source{s: seed} }
+
+func (m *Source) Seed(seed int64) { m.s = uint64(seed) }
+
+func (m *Source) Uint64() uint64 {
+	m.s += 0x9E3779B97F4A7C15
+	z := m.s
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+func (m *Source) Int63() int64 { return int64(m.Uint64() >> 1) }
+
+// Mix returns the first value of a Source seeded with x.
+// It is a good hash of x.
+func Mix(x uint64) uint64 { return New(x).Uint64() }
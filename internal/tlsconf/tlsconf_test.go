@@ -0,0 +1,126 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uluyol/fabbench/internal/tlsconf/tlstest"
+)
+
+func TestLoad(t *testing.T) {
+	if c, err := (*Config)(nil).Load(); c != nil || err != nil {
+		t.Errorf("nil config: got %v, %v, want nil", c, err)
+	}
+
+	dir, err := ioutil.TempDir("", "tlsconf-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files, err := tlstest.WriteFiles(dir)
+	if err != nil {
+		t.Fatalf("unable to write certs: %v", err)
+	}
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := ioutil.WriteFile(notPEM, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		c    Config
+		bad  bool
+	}{
+		{name: "empty", c: Config{}},
+		{name: "ca", c: Config{CA: files.CA, ServerName: "localhost"}},
+		{name: "client cert", c: Config{CA: files.CA, Cert: files.ClientCert, Key: files.ClientKey}},
+		{name: "missing ca", c: Config{CA: filepath.Join(dir, "nope.pem")}, bad: true},
+		{name: "bad ca", c: Config{CA: notPEM}, bad: true},
+		{name: "cert only", c: Config{Cert: files.ClientCert}, bad: true},
+		{name: "key only", c: Config{Key: files.ClientKey}, bad: true},
+		{name: "bad cert", c: Config{Cert: notPEM, Key: files.ClientKey}, bad: true},
+	}
+	for _, test := range tests {
+		tc, err := test.c.Load()
+		if (err != nil) != test.bad {
+			t.Errorf("%s: got error %v, want error: %t", test.name, err, test.bad)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if tc.ServerName != test.c.ServerName {
+			t.Errorf("%s: got server name %q, want %q", test.name, tc.ServerName, test.c.ServerName)
+		}
+		if (tc.RootCAs != nil) != (test.c.CA != "") {
+			t.Errorf("%s: got root CAs %v, want them iff CA is set", test.name, tc.RootCAs)
+		}
+		if (len(tc.Certificates) == 1) != (test.c.Cert != "") {
+			t.Errorf("%s: got %d client certs", test.name, len(tc.Certificates))
+		}
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconf-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files, err := tlstest.WriteFiles(dir)
+	if err != nil {
+		t.Fatalf("unable to write certs: %v", err)
+	}
+	srvCfg, err := files.ServerConfig(true)
+	if err != nil {
+		t.Fatalf("unable to load server config: %v", err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srvCfg)
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.(*tls.Conn).Handshake()
+			c.Close()
+		}
+	}()
+
+	tests := []struct {
+		name string
+		c    Config
+		ok   bool
+	}{
+		{name: "mtls", c: Config{CA: files.CA, Cert: files.ClientCert, Key: files.ClientKey}, ok: true},
+		{name: "skip verify", c: Config{Cert: files.ClientCert, Key: files.ClientKey, InsecureSkipVerify: true}, ok: true},
+		{name: "unknown CA", c: Config{Cert: files.ClientCert, Key: files.ClientKey}},
+		{name: "wrong name", c: Config{CA: files.CA, Cert: files.ClientCert, Key: files.ClientKey, ServerName: "example.com"}},
+	}
+	for _, test := range tests {
+		tc, err := test.c.Load()
+		if err != nil {
+			t.Fatalf("%s: unable to load: %v", test.name, err)
+		}
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: unable to dial: %v", test.name, err)
+		}
+		if tc.ServerName == "" {
+			tc.ServerName = "127.0.0.1"
+		}
+		err = tls.Client(conn, tc).Handshake()
+		conn.Close()
+		if (err == nil) != test.ok {
+			t.Errorf("%s: handshake got error %v, want success: %t", test.name, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package intgen
+
+import (
+	"math/rand"
+)
+
+// Alias selects numbers up to len(weights)
+// with probabilities proportional to weights.
+//
+// It uses Vose's alias method, so each draw takes constant time
+// regardless of the number of weights.
+type Alias struct {
+	prob  []float64
+	alias []int64
+}
+
+func NewAlias(weights []float64) *Alias {
+	if len(weights) == 0 {
+		panic("need at least one weight")
+	}
+	var sum float64
+	for _, w := range weights {
+		if w < 0 {
+			panic("weights must be non-negative")
+		}
+		sum += w
+	}
+	if sum <= 0 {
+		panic("weights must have a positive sum")
+	}
+
+	n := len(weights)
+	g := &Alias{
+		prob:  make([]float64, n),
+		alias: make([]int64, n),
+	}
+
+	scaled := make([]float64, n)
+	var small, large []int64
+	for i, w := range weights {
+		scaled[i] = w * float64(n) / sum
+		if scaled[i] < 1 {
+			small = append(small, int64(i))
+		} else {
+			large = append(large, int64(i))
+		}
+	}
+
+	for len(small) > 0 && len(large) > 0 {
+		s := small[len(small)-1]
+		small = small[:len(small)-1]
+		l := large[len(large)-1]
+		large = large[:len(large)-1]
+
+		g.prob[s] = scaled[s]
+		g.alias[s] = l
+		scaled[l] = scaled[l] + scaled[s] - 1
+		if scaled[l] < 1 {
+			small = append(small, l)
+		} else {
+			large = append(large, l)
+		}
+	}
+
+	// Anything left over is only there due to rounding error.
+	for _, i := range large {
+		g.prob[i] = 1
+	}
+	for _, i := range small {
+		g.prob[i] = 1
+	}
+
+	return g
+}
+
+func (g *Alias) Next(rng *rand.Rand) int64 {
+	i := rng.Int63n(int64(len(g.prob)))
+	if rng.Float64() < g.prob[i] {
+		return i
+	}
+	return g.alias[i]
+}
@@ -0,0 +1,45 @@
+package intgen
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Exponential selects numbers up to N
+// with exponentially decreasing probabilities.
+//
+// Lambda is the rate of the distribution over [0, 1),
+// which is then scaled to [0, N).
+// The distribution is truncated to [0, 1) and sampled by
+// inverting its CDF, so even tiny rates take one draw.
+type Exponential struct {
+	n      int64
+	lambda float64
+	mass   float64 // of [0, 1) before truncation
+}
+
+func NewExponential(n int64, lambda float64) Exponential {
+	if lambda <= 0 {
+		panic("lambda must be positive")
+	}
+	return Exponential{n: n, lambda: lambda, mass: -math.Expm1(-lambda)}
+}
+
+func (g Exponential) Next(rng *rand.Rand) int64 {
+	x := -math.Log1p(-rng.Float64()*g.mass) / g.lambda
+	return scaleUnit(x, g.n)
+}
+
+// scaleUnit scales x in [0, 1) to [0, n),
+// clamping values that rounding pushed out of range.
+func scaleUnit(x float64, n int64) int64 {
+	v := int64(x * float64(n))
+	if v < 0 {
+		return 0
+	}
+	if v >= n {
+		// can round up to n for large n
+		return n - 1
+	}
+	return v
+}
@@ -0,0 +1,47 @@
+package intgen
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Normal selects numbers up to N from a normal distribution.
+//
+// Mu and sigma are the mean and standard deviation over [0, 1),
+// which is then scaled to [0, N).
+// The distribution is truncated to [0, 1) and sampled by
+// inverting its CDF, so even huge sigmas take one draw.
+type Normal struct {
+	n     int64
+	mu    float64
+	sigma float64
+
+	// CDF of the untruncated distribution at 0 and 1
+	lo, hi float64
+}
+
+func NewNormal(n int64, mu, sigma float64) Normal {
+	if mu < 0 || mu >= 1 {
+		panic("mu must be in [0, 1)")
+	}
+	if sigma < 0 {
+		panic("sigma must be non-negative")
+	}
+	g := Normal{n: n, mu: mu, sigma: sigma}
+	if sigma > 0 {
+		g.lo = stdNormalCDF(-mu / sigma)
+		g.hi = stdNormalCDF((1 - mu) / sigma)
+	}
+	return g
+}
+
+func stdNormalCDF(z float64) float64 { return 0.5 * math.Erfc(-z/math.Sqrt2) }
+
+func (g Normal) Next(rng *rand.Rand) int64 {
+	if g.sigma == 0 {
+		return scaleUnit(g.mu, g.n)
+	}
+	p := g.lo + rng.Float64()*(g.hi-g.lo)
+	x := g.mu + g.sigma*-math.Sqrt2*math.Erfcinv(2*p)
+	return scaleUnit(x, g.n)
+}
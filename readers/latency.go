@@ -3,10 +3,13 @@ package readers
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -16,9 +19,73 @@ import (
 type Latency struct {
 	Hists []*hdrhist.Hist
 	Errs  []int32
+
+	// Descs describes each step.
+	// Steps without a description have an empty string.
+	Descs []string
+
+	// Bytes read or written in each step.
+	// Logs written before byte counts were recorded have all zeros.
+	Bytes []int64
+
+	// Counts holds other named per-step counters.
+	// Counters that were never used are absent.
+	Counts map[string][]int64
+
+	// Targets holds the throughput that each step aims for.
+	// Closed-loop steps, and all steps of logs written
+	// before targets were recorded, have a nil Target.
+	Targets []*Target
+
+	// Client is the index of the client that wrote the log
+	// out of NumClients clients.
+	// NumClients is 0 if the log does not say.
+	Client     int
+	NumClients int
+}
+
+// A Target is the throughput that a step aims for.
+type Target struct {
+	QPS       float64
+	ReadRatio float64
+}
+
+// add adds the target of another client running the same step.
+func (t *Target) add(o *Target) {
+	if o == nil {
+		return
+	}
+	if qps := t.QPS + o.QPS; qps > 0 {
+		t.ReadRatio = (t.QPS*t.ReadRatio + o.QPS*o.ReadRatio) / qps
+	}
+	t.QPS += o.QPS
 }
 
-const errPrefix = "fabbench: error count for previous: "
+// addTarget returns the sum of t and o.
+func addTarget(t, o *Target) *Target {
+	switch {
+	case o == nil:
+		return t
+	case t == nil:
+		c := *o
+		return &c
+	}
+	t.add(o)
+	return t
+}
+
+const (
+	clientPrefix = "fabbench: client "
+	descPrefix   = "fabbench: desc for previous: "
+	errPrefix    = "fabbench: error count for previous: "
+	bytesPrefix  = "fabbench: byte count for previous: "
+
+	countPrefix = "fabbench: "
+	countSuffix = " count for previous: "
+
+	targetQPSPrefix       = "fabbench: target qps for previous: "
+	targetReadRatioPrefix = "fabbench: target read ratio for previous: "
+)
 
 func ReadLatency(r io.Reader) (*Latency, error) {
 	b, err := ioutil.ReadAll(r)
@@ -27,6 +94,18 @@ func ReadLatency(r io.Reader) (*Latency, error) {
 	}
 
 	var l Latency
+	targets := make(map[int]*Target)
+	targetFor := func(t string) (*Target, error) {
+		// targets follow the error count of their step
+		if len(l.Errs) == 0 {
+			return nil, fmt.Errorf("target before first step: %s", t)
+		}
+		step := len(l.Errs) - 1
+		if targets[step] == nil {
+			targets[step] = new(Target)
+		}
+		return targets[step], nil
+	}
 
 	s := bufio.NewScanner(bytes.NewReader(b))
 	for s.Scan() {
@@ -34,13 +113,57 @@ func ReadLatency(r io.Reader) (*Latency, error) {
 		if strings.HasPrefix(t, "#") {
 			// is comment
 			t = strings.TrimSpace(t[1:])
-			if strings.HasPrefix(t, errPrefix) {
+			if strings.HasPrefix(t, clientPrefix) {
+				t = strings.TrimPrefix(t, clientPrefix)
+				if _, err := fmt.Sscanf(t, "%d of %d", &l.Client, &l.NumClients); err != nil {
+					return nil, fmt.Errorf("unable to read client index: %v", err)
+				}
+			} else if strings.HasPrefix(t, descPrefix) {
+				l.Descs = append(l.Descs, strings.TrimPrefix(t, descPrefix))
+			} else if strings.HasPrefix(t, errPrefix) {
 				t = strings.TrimPrefix(t, errPrefix)
 				ec, err := strconv.Atoi(t)
 				if err != nil {
 					return nil, fmt.Errorf("unable to read error count: %v", err)
 				}
 				l.Errs = append(l.Errs, int32(ec))
+			} else if strings.HasPrefix(t, bytesPrefix) {
+				t = strings.TrimPrefix(t, bytesPrefix)
+				bc, err := strconv.ParseInt(t, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("unable to read byte count: %v", err)
+				}
+				l.Bytes = append(l.Bytes, bc)
+			} else if strings.HasPrefix(t, targetQPSPrefix) {
+				tgt, err := targetFor(t)
+				if err != nil {
+					return nil, err
+				}
+				tgt.QPS, err = strconv.ParseFloat(strings.TrimPrefix(t, targetQPSPrefix), 64)
+				if err != nil {
+					return nil, fmt.Errorf("unable to read target qps: %v", err)
+				}
+			} else if strings.HasPrefix(t, targetReadRatioPrefix) {
+				tgt, err := targetFor(t)
+				if err != nil {
+					return nil, err
+				}
+				tgt.ReadRatio, err = strconv.ParseFloat(strings.TrimPrefix(t, targetReadRatioPrefix), 64)
+				if err != nil {
+					return nil, fmt.Errorf("unable to read target read ratio: %v", err)
+				}
+			} else if strings.HasPrefix(t, countPrefix) && strings.Contains(t, countSuffix) {
+				t = strings.TrimPrefix(t, countPrefix)
+				i := strings.Index(t, countSuffix)
+				name := t[:i]
+				c, err := strconv.ParseInt(t[i+len(countSuffix):], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("unable to read %s count: %v", name, err)
+				}
+				if l.Counts == nil {
+					l.Counts = make(map[string][]int64)
+				}
+				l.Counts[name] = append(l.Counts[name], c)
 			}
 		}
 	}
@@ -60,5 +183,129 @@ func ReadLatency(r io.Reader) (*Latency, error) {
 		return nil, errors.New("number of hists and steps for errors do not match")
 	}
 
+	if l.Descs == nil {
+		l.Descs = make([]string, len(l.Hists))
+	} else if len(l.Descs) != len(l.Hists) {
+		return nil, errors.New("number of hists and steps for descs do not match")
+	}
+
+	if l.Bytes == nil {
+		l.Bytes = make([]int64, len(l.Hists))
+	} else if len(l.Bytes) != len(l.Hists) {
+		return nil, errors.New("number of hists and steps for bytes do not match")
+	}
+
+	for name, c := range l.Counts {
+		if len(c) != len(l.Hists) {
+			return nil, fmt.Errorf("number of hists and steps for %s counts do not match", name)
+		}
+	}
+
+	l.Targets = make([]*Target, len(l.Hists))
+	for step, t := range targets {
+		if step >= len(l.Hists) {
+			return nil, errors.New("number of hists and steps for targets do not match")
+		}
+		l.Targets[step] = t
+	}
+
 	return &l, err
 }
+
+// ReadLatencyFile reads a gzipped latency log from the file at path.
+func ReadLatencyFile(path string) (*Latency, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	defer gr.Close()
+
+	l, err := ReadLatency(gr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return l, nil
+}
+
+// Add merges the steps of o into l.
+// Histograms are added, and errors, bytes and other counters are summed.
+// Both must have the same number of steps.
+func (l *Latency) Add(o *Latency) error {
+	if len(l.Hists) != len(o.Hists) {
+		return fmt.Errorf("cannot add logs with %d and %d steps", len(l.Hists), len(o.Hists))
+	}
+	for i := range l.Hists {
+		l.Hists[i].SetAutoResize(true)
+		l.Hists[i].Add(o.Hists[i])
+		l.Errs[i] += o.Errs[i]
+		l.Bytes[i] += o.Bytes[i]
+		if l.Descs[i] == "" {
+			l.Descs[i] = o.Descs[i]
+		}
+		if o.Targets != nil {
+			if l.Targets == nil {
+				l.Targets = make([]*Target, len(l.Hists))
+			}
+			l.Targets[i] = addTarget(l.Targets[i], o.Targets[i])
+		}
+	}
+	for name, oc := range o.Counts {
+		if l.Counts == nil {
+			l.Counts = make(map[string][]int64)
+		}
+		c, ok := l.Counts[name]
+		if !ok {
+			c = make([]int64, len(l.Hists))
+			l.Counts[name] = c
+		}
+		for i := range c {
+			c[i] += oc[i]
+		}
+	}
+	return nil
+}
+
+// WriteTo writes l in the same format as recorders.Latency.
+func (l *Latency) WriteTo(w *hdrhist.LogWriter) error {
+	names := make([]string, 0, len(l.Counts))
+	for name := range l.Counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i := range l.Hists {
+		if err := w.WriteIntervalHist(l.Hists[i]); err != nil {
+			return err
+		}
+		if err := w.WriteComment(descPrefix + l.Descs[i]); err != nil {
+			return err
+		}
+		if err := w.WriteComment(errPrefix + strconv.Itoa(int(l.Errs[i]))); err != nil {
+			return err
+		}
+		if err := w.WriteComment(bytesPrefix + strconv.FormatInt(l.Bytes[i], 10)); err != nil {
+			return err
+		}
+		if l.Targets != nil && l.Targets[i] != nil {
+			t := l.Targets[i]
+			if err := w.WriteComment(targetQPSPrefix + strconv.FormatFloat(t.QPS, 'f', -1, 64)); err != nil {
+				return err
+			}
+			if err := w.WriteComment(targetReadRatioPrefix + strconv.FormatFloat(t.ReadRatio, 'f', -1, 64)); err != nil {
+				return err
+			}
+		}
+		for _, name := range names {
+			err := w.WriteComment(countPrefix + name + countSuffix + strconv.FormatInt(l.Counts[name][i], 10))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
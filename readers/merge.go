@@ -0,0 +1,110 @@
+package readers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/uluyol/hdrhist"
+)
+
+// Merge merges logs with the same steps into one,
+// as if by calling Add on the first for each of the rest.
+func Merge(ls []*Latency) (*Latency, error) {
+	if len(ls) == 0 {
+		return nil, errors.New("no logs to merge")
+	}
+	m := ls[0]
+	for _, l := range ls[1:] {
+		if err := m.Add(l); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// MergeByTime merges logs by aligning their steps to wall-clock intervals.
+// Intervals are aligned to multiples of interval since the zero time,
+// and each step is added to the interval in which it starts,
+// so intervals should be at least as long as the steps.
+// Every interval between the first and last step is included,
+// even if no step starts in it.
+func MergeByTime(ls []*Latency, interval time.Duration) (*Latency, error) {
+	if interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+
+	var first, last time.Time
+	var cfg hdrhist.Config
+	for _, l := range ls {
+		for _, h := range l.Hists {
+			t, ok := h.StartTime()
+			if !ok {
+				return nil, errors.New("histogram is missing start time")
+			}
+			if first.IsZero() || t.Before(first) {
+				first = t
+				cfg = h.Config()
+			}
+			if last.IsZero() || t.After(last) {
+				last = t
+			}
+		}
+	}
+	if first.IsZero() {
+		return nil, errors.New("no steps to merge")
+	}
+
+	first = first.Truncate(interval)
+	n := int(last.Sub(first)/interval) + 1
+	cfg.AutoResize = true
+	m := &Latency{
+		Hists: make([]*hdrhist.Hist, n),
+		Errs:  make([]int32, n),
+		Descs: make([]string, n),
+		Bytes: make([]int64, n),
+
+		Targets: make([]*Target, n),
+	}
+	for i := range m.Hists {
+		m.Hists[i] = hdrhist.WithConfig(cfg)
+	}
+
+	for _, l := range ls {
+		for step, h := range l.Hists {
+			t, _ := h.StartTime()
+			i := int(t.Sub(first) / interval)
+			m.Hists[i].Add(h)
+			m.Errs[i] += l.Errs[step]
+			m.Bytes[i] += l.Bytes[step]
+			if l.Targets != nil && l.Targets[step] != nil {
+				// weigh by how much of the interval the step covers
+				tgt := *l.Targets[step]
+				if end, ok := h.EndTime(); ok {
+					tgt.QPS *= float64(end.Sub(t)) / float64(interval)
+				}
+				m.Targets[i] = addTarget(m.Targets[i], &tgt)
+			}
+			if m.Descs[i] == "" {
+				m.Descs[i] = l.Descs[step]
+			}
+			for name, c := range l.Counts {
+				if m.Counts == nil {
+					m.Counts = make(map[string][]int64)
+				}
+				mc, ok := m.Counts[name]
+				if !ok {
+					mc = make([]int64, n)
+					m.Counts[name] = mc
+				}
+				mc[i] += c[step]
+			}
+		}
+	}
+
+	for i, h := range m.Hists {
+		start := first.Add(time.Duration(i) * interval)
+		h.SetStartTime(start)
+		h.SetEndTime(start.Add(interval))
+	}
+	return m, nil
+}
@@ -0,0 +1,102 @@
+package readers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uluyol/hdrhist"
+)
+
+func latencyAt(starts []time.Time, step time.Duration, counts []int64) *Latency {
+	l := &Latency{
+		Errs:   make([]int32, len(starts)),
+		Descs:  make([]string, len(starts)),
+		Bytes:  make([]int64, len(starts)),
+		Counts: map[string][]int64{"stale": make([]int64, len(starts))},
+	}
+	for i, t := range starts {
+		h := hdrhist.WithConfig(hdrhist.Config{
+			LowestDiscernible: int64(time.Microsecond),
+			HighestTrackable:  int64(time.Second),
+			SigFigs:           3,
+		})
+		h.RecordN(int64(time.Millisecond), counts[i])
+		h.SetStartTime(t)
+		h.SetEndTime(t.Add(step))
+		l.Hists = append(l.Hists, h)
+		l.Errs[i] = 1
+		l.Bytes[i] = 10 * counts[i]
+		l.Counts["stale"][i] = 1
+	}
+	return l
+}
+
+func TestMergeByTime(t *testing.T) {
+	t.Parallel()
+	base := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	sec := func(s float64) time.Time { return base.Add(time.Duration(s * float64(time.Second))) }
+
+	// clients start a little apart, one has a gap
+	ls := []*Latency{
+		latencyAt([]time.Time{sec(0.1), sec(10.1), sec(20.1)}, 10*time.Second, []int64{1, 2, 3}),
+		latencyAt([]time.Time{sec(0.3), sec(10.3), sec(20.3)}, 10*time.Second, []int64{4, 5, 6}),
+		latencyAt([]time.Time{sec(0.2), sec(30.2)}, 10*time.Second, []int64{7, 8}),
+	}
+	m, err := MergeByTime(ls, 10*time.Second)
+	if err != nil {
+		t.Fatalf("unable to merge: %v", err)
+	}
+
+	want := []struct {
+		count int64
+		errs  int32
+	}{
+		{12, 3},
+		{7, 2},
+		{9, 2},
+		{8, 1},
+	}
+	if len(m.Hists) != len(want) {
+		t.Fatalf("want %d intervals, got %d", len(want), len(m.Hists))
+	}
+	for i, w := range want {
+		if c := m.Hists[i].TotalCount(); c != w.count {
+			t.Errorf("interval %d: want count %d, got %d", i, w.count, c)
+		}
+		if m.Errs[i] != w.errs || m.Counts["stale"][i] != int64(w.errs) {
+			t.Errorf("interval %d: want %d errs and stale, got %d and %d", i, w.errs, m.Errs[i], m.Counts["stale"][i])
+		}
+		if m.Bytes[i] != 10*w.count {
+			t.Errorf("interval %d: want %d bytes, got %d", i, 10*w.count, m.Bytes[i])
+		}
+		start, _ := m.Hists[i].StartTime()
+		end, _ := m.Hists[i].EndTime()
+		if !start.Equal(sec(float64(10*i))) || end.Sub(start) != 10*time.Second {
+			t.Errorf("interval %d: bad times [%v, %v)", i, start, end)
+		}
+	}
+}
+
+func TestMergeByStep(t *testing.T) {
+	t.Parallel()
+	base := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	ls := []*Latency{
+		latencyAt([]time.Time{base, base.Add(time.Minute)}, time.Minute, []int64{1, 2}),
+		latencyAt([]time.Time{base.Add(time.Hour), base.Add(time.Hour + time.Minute)}, time.Minute, []int64{3, 4}),
+	}
+	m, err := Merge(ls)
+	if err != nil {
+		t.Fatalf("unable to merge: %v", err)
+	}
+	if len(m.Hists) != 2 || m.Hists[0].TotalCount() != 4 || m.Hists[1].TotalCount() != 6 {
+		t.Errorf("bad merged hists: %v", m.Hists)
+	}
+	if m.Counts["stale"][0] != 2 || m.Errs[1] != 2 {
+		t.Errorf("bad merged counts: %v %v", m.Counts, m.Errs)
+	}
+
+	ls = append(ls, latencyAt([]time.Time{base}, time.Minute, []int64{1}))
+	if _, err := Merge(ls[1:]); err == nil {
+		t.Error("want error merging logs with different steps")
+	}
+}
@@ -3,6 +3,7 @@ package readers
 import (
 	"bytes"
 	"errors"
+	"io"
 	"math/rand"
 	"testing"
 	"time"
@@ -188,3 +189,146 @@ func TestLatencyRecorderReaderMulti(t *testing.T) {
 		}
 	}
 }
+
+func TestLatencyRecorderReaderCounts(t *testing.T) {
+	t.Parallel()
+	rec := recorders.NewLatency(hdrhist.Config{
+		LowestDiscernible: int64(time.Microsecond),
+		HighestTrackable:  int64(100 * time.Second),
+		SigFigs:           3,
+		AutoResize:        true,
+	}, []string{"a", "b"})
+
+	rec.Start(0)
+	rec.Record(0, time.Millisecond, nil)
+	rec.AddBytes(0, 100)
+	rec.AddBytes(0, 23)
+	rec.End(0)
+	rec.Start(1)
+	rec.AddCount(1, "stale", 3)
+	rec.End(1)
+
+	rd := readerOf(t, rec)
+	if c := rd.Counts["stale"]; len(c) != 2 || c[0] != 0 || c[1] != 3 {
+		t.Errorf("want stale counts [0 3], got %v", c)
+	}
+	if len(rd.Bytes) != 2 {
+		t.Fatalf("want 2 byte counts, got %d", len(rd.Bytes))
+	}
+	if rd.Bytes[0] != 123 || rd.Bytes[1] != 0 {
+		t.Errorf("want byte counts [123 0], got %v", rd.Bytes)
+	}
+}
+
+func TestLatencyAddWriteTo(t *testing.T) {
+	t.Parallel()
+	cfg := hdrhist.Config{
+		LowestDiscernible: int64(time.Microsecond),
+		HighestTrackable:  int64(time.Second),
+		SigFigs:           3,
+	}
+	rec1 := recorders.NewLatency(cfg, []string{"a", "b"})
+	rec1.Start(0)
+	rec1.Record(0, time.Millisecond, nil)
+	rec1.Record(0, 0, badRec)
+	rec1.AddBytes(0, 10)
+	rec1.SetTarget(0, recorders.Target{QPS: 100, ReadRatio: 0.25})
+	rec1.End(0)
+	rec1.Start(1)
+	rec1.End(1)
+
+	// needs resizing to add to rec1
+	cfg.AutoResize = true
+	rec2 := recorders.NewLatency(cfg, []string{"a", "b"})
+	rec2.Start(0)
+	rec2.Record(0, 2*time.Millisecond, nil)
+	rec2.SetTarget(0, recorders.Target{QPS: 300, ReadRatio: 0.75})
+	rec2.End(0)
+	rec2.Start(1)
+	rec2.Record(1, 50*time.Second, nil)
+	rec2.AddCount(1, "stale", 2)
+	rec2.End(1)
+
+	rd := readerOf(t, rec1)
+	if err := rd.Add(readerOf(t, rec2)); err != nil {
+		t.Fatalf("unable to add: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := rd.WriteTo(hdrhist.NewLogWriter(&buf)); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	merged, err := ReadLatency(&buf)
+	if err != nil {
+		t.Fatalf("unable to read merged: %v", err)
+	}
+
+	if len(merged.Hists) != 2 {
+		t.Fatalf("want 2 steps, got %d", len(merged.Hists))
+	}
+	if merged.Descs[0] != "a" || merged.Descs[1] != "b" {
+		t.Errorf("want descs [a b], got %v", merged.Descs)
+	}
+	if merged.Hists[0].TotalCount() != 2 || merged.Hists[1].TotalCount() != 1 {
+		t.Errorf("want counts [2 1], got [%d %d]", merged.Hists[0].TotalCount(), merged.Hists[1].TotalCount())
+	}
+	if merged.Errs[0] != 1 || merged.Errs[1] != 0 {
+		t.Errorf("want errs [1 0], got %v", merged.Errs)
+	}
+	if merged.Bytes[0] != 10 {
+		t.Errorf("want 10 bytes in step 0, got %d", merged.Bytes[0])
+	}
+	if c := merged.Counts["stale"]; len(c) != 2 || c[1] != 2 {
+		t.Errorf("want stale counts [0 2], got %v", c)
+	}
+	if tgt := merged.Targets[0]; tgt == nil || *tgt != (Target{QPS: 400, ReadRatio: 0.625}) {
+		t.Errorf("want target {400 0.625} in step 0, got %+v", tgt)
+	}
+	if tgt := merged.Targets[1]; tgt != nil {
+		t.Errorf("want no target in step 1, got %+v", tgt)
+	}
+
+	if err := rd.Add(&Latency{}); err == nil {
+		t.Error("want error adding logs with different steps")
+	}
+}
+
+func TestLatencyClientComment(t *testing.T) {
+	t.Parallel()
+	rec := recorders.NewMultiLatency(hdrhist.Config{
+		LowestDiscernible: int64(time.Microsecond),
+		HighestTrackable:  int64(time.Second),
+		SigFigs:           3,
+	}, []string{"a"})
+	rec.SetStart(0, time.Now())
+	rec.Record("host", 0, time.Millisecond, nil)
+	rec.SetEnd(0, time.Now())
+
+	mem := recorders.NewMemoryMultiLogWriter(time.Now())
+	w := recorders.CommentMultiLogWriter(mem, recorders.ClientComment(2, 3))
+	if err := rec.WriteTo(w); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+
+	for _, r := range []io.Reader{mem.AllReader(), mem.Reader("host")} {
+		rd, err := ReadLatency(r)
+		if err != nil {
+			t.Fatalf("unable to read: %v", err)
+		}
+		if rd.Client != 2 || rd.NumClients != 3 {
+			t.Errorf("want client 2 of 3, got %d of %d", rd.Client, rd.NumClients)
+		}
+		if len(rd.Hists) != 1 || rd.Hists[0].TotalCount() != 1 {
+			t.Errorf("bad hists: %v", rd.Hists)
+		}
+	}
+
+	rd := readerOf(t, recorders.NewLatency(hdrhist.Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  2,
+		SigFigs:           1,
+	}, []string{"a"}))
+	if rd.NumClients != 0 {
+		t.Errorf("want unknown client, got %d of %d", rd.Client, rd.NumClients)
+	}
+}
@@ -1,6 +1,7 @@
 package recorders
 
 import (
+	"sort"
 	"strconv"
 	"time"
 
@@ -46,18 +47,80 @@ func (r *MultiLatency) SetEnd(step int, t time.Time) {
 	}
 }
 
+// Record records a request in the step.
+// Requests are recorded in the aggregate log
+// and, unless name is empty, in the log specific to name.
 func (r *MultiLatency) Record(name string, step int, d time.Duration, e error) {
 	if r == nil {
 		return
 	}
 
 	r.all.Record(step, d, e)
+	if name == "" {
+		return
+	}
+	l := r.subFor(name)
+	l.Record(step, d, e)
+}
+
+// AddBytes adds to the number of bytes read or written in the step.
+func (r *MultiLatency) AddBytes(name string, step int, n int64) {
+	if r == nil {
+		return
+	}
+
+	r.all.AddBytes(step, n)
+	if name == "" {
+		return
+	}
+	l := r.subFor(name)
+	l.AddBytes(step, n)
+}
+
+// AddCount adds n to the counter with the given name in the step.
+func (r *MultiLatency) AddCount(name string, step int, counter string, n int64) {
+	if r == nil {
+		return
+	}
+
+	r.all.AddCount(step, counter, n)
+	if name == "" {
+		return
+	}
+	l := r.subFor(name)
+	l.AddCount(step, counter, n)
+}
+
+// SetTarget records the throughput that the step aims for.
+func (r *MultiLatency) SetTarget(step int, t Target) {
+	if r == nil {
+		return
+	}
+
+	r.all.SetTarget(step, t)
+	for _, l := range r.sub {
+		l.SetTarget(step, t)
+	}
+}
+
+// subFor returns the recorder for name, creating it if needed.
+// New recorders inherit the step times and targets of the aggregate recorder.
+func (r *MultiLatency) subFor(name string) *Latency {
 	l, ok := r.sub[name]
 	if !ok {
 		l = NewLatency(r.cfg, r.descs)
+		copy(l.targets, r.all.targets)
+		for i := range r.all.recs {
+			if t, ok := r.all.recs[i].StartTime(); ok {
+				l.recs[i].SetStartTime(t)
+			}
+			if t, ok := r.all.recs[i].EndTime(); ok {
+				l.recs[i].SetEndTime(t)
+			}
+		}
 		r.sub[name] = l
 	}
-	l.Record(step, d, e)
+	return l
 }
 
 func (r *MultiLatency) WriteTo(w MultiLogWriter) error {
@@ -80,12 +143,28 @@ func (r *MultiLatency) WriteTo(w MultiLogWriter) error {
 type Latency struct {
 	recs  []hdrhist.Hist
 	errs  []int32
+	bytes []int64
 	descs []string
+
+	// named counters, written for every step once used in any
+	counts map[string][]int64
+
+	// nil for steps without a target
+	targets []*Target
+}
+
+// A Target is the throughput that a step aims for.
+// Closed-loop steps have no target.
+type Target struct {
+	QPS       float64
+	ReadRatio float64
 }
 
 func (l *Latency) init(cfg hdrhist.Config, steps []string) {
 	l.recs = make([]hdrhist.Hist, len(steps))
 	l.errs = make([]int32, len(steps))
+	l.bytes = make([]int64, len(steps))
+	l.targets = make([]*Target, len(steps))
 	l.descs = steps
 	for i := range l.recs {
 		l.recs[i].Init(cfg)
@@ -109,6 +188,10 @@ func (r *Latency) SetStart(step int, t time.Time) {
 	r.recs[step].Clear()
 	r.recs[step].SetStartTime(t)
 	r.errs[step] = 0
+	r.bytes[step] = 0
+	for _, c := range r.counts {
+		c[step] = 0
+	}
 }
 
 func (r *Latency) SetEnd(step int, t time.Time) {
@@ -128,13 +211,56 @@ func (r *Latency) Record(step int, d time.Duration, err error) {
 		return
 	}
 
-	r.recs[step].Record(int64(d))
+	h := &r.recs[step]
+	if cfg := h.Config(); cfg.AutoResize && int64(d) >= cfg.HighestTrackable {
+		// hdrhist fails to resize for powers of two,
+		// so make room with an odd value first
+		h.RecordN(int64(d)|1, 0)
+	}
+	h.Record(int64(d))
+}
+
+func (r *Latency) AddBytes(step int, n int64) {
+	if r == nil {
+		return
+	}
+
+	r.bytes[step] += n
+}
+
+func (r *Latency) SetTarget(step int, t Target) {
+	if r == nil {
+		return
+	}
+
+	r.targets[step] = &t
+}
+
+func (r *Latency) AddCount(step int, counter string, n int64) {
+	if r == nil {
+		return
+	}
+
+	if r.counts == nil {
+		r.counts = make(map[string][]int64)
+	}
+	c, ok := r.counts[counter]
+	if !ok {
+		c = make([]int64, len(r.recs))
+		r.counts[counter] = c
+	}
+	c[step] += n
 }
 
 func (r *Latency) WriteTo(w *hdrhist.LogWriter) error {
 	if r == nil {
 		return nil
 	}
+	names := make([]string, 0, len(r.counts))
+	for name := range r.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 	for i := range r.recs {
 		if err := w.WriteIntervalHist(&r.recs[i]); err != nil {
 			return err
@@ -147,6 +273,26 @@ func (r *Latency) WriteTo(w *hdrhist.LogWriter) error {
 		if err != nil {
 			return err
 		}
+		err = w.WriteComment("fabbench: byte count for previous: " + strconv.FormatInt(r.bytes[i], 10))
+		if err != nil {
+			return err
+		}
+		if t := r.targets[i]; t != nil {
+			err = w.WriteComment("fabbench: target qps for previous: " + strconv.FormatFloat(t.QPS, 'f', -1, 64))
+			if err != nil {
+				return err
+			}
+			err = w.WriteComment("fabbench: target read ratio for previous: " + strconv.FormatFloat(t.ReadRatio, 'f', -1, 64))
+			if err != nil {
+				return err
+			}
+		}
+		for _, name := range names {
+			err = w.WriteComment("fabbench: " + name + " count for previous: " + strconv.FormatInt(r.counts[name][i], 10))
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -3,9 +3,11 @@ package recorders
 import (
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/uluyol/hdrhist"
@@ -155,5 +157,90 @@ func (mw *MemoryMultiLogWriter) Reader(name string) io.Reader {
 	return mw.logs[name]
 }
 
+// Names returns the names of the logs written with Write.
+func (mw *MemoryMultiLogWriter) Names() []string {
+	names := make([]string, 0, len(mw.logs))
+	for name := range mw.logs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (mw *MemoryMultiLogWriter) Err() error { return mw.err }
 func (mw *MemoryMultiLogWriter) private()   {}
+
+type teeLogWriter []MultiLogWriter
+
+// TeeMultiLogWriter creates a multi-writer that writes everything to all ws.
+func TeeMultiLogWriter(ws ...MultiLogWriter) MultiLogWriter {
+	return teeLogWriter(ws)
+}
+
+func (t teeLogWriter) WriteAll(f func(*hdrhist.LogWriter) error) error {
+	for _, w := range t {
+		if err := w.WriteAll(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t teeLogWriter) Write(name string, f func(*hdrhist.LogWriter) error) error {
+	for _, w := range t {
+		if err := w.Write(name, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t teeLogWriter) Err() error {
+	for _, w := range t {
+		if err := w.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t teeLogWriter) private() {}
+
+// ClientComment returns the comment that records
+// which of nclients clients wrote a log.
+func ClientComment(clienti, nclients int) string {
+	return fmt.Sprintf("fabbench: client %d of %d", clienti, nclients)
+}
+
+type commentLogWriter struct {
+	w        MultiLogWriter
+	comments []string
+}
+
+// CommentMultiLogWriter creates a multi-writer that writes comments
+// at the start of every log written to w.
+func CommentMultiLogWriter(w MultiLogWriter, comments ...string) MultiLogWriter {
+	return &commentLogWriter{w: w, comments: comments}
+}
+
+func (c *commentLogWriter) withComments(f func(*hdrhist.LogWriter) error) func(*hdrhist.LogWriter) error {
+	return func(lw *hdrhist.LogWriter) error {
+		for _, com := range c.comments {
+			if err := lw.WriteComment(com); err != nil {
+				return err
+			}
+		}
+		return f(lw)
+	}
+}
+
+func (c *commentLogWriter) WriteAll(f func(*hdrhist.LogWriter) error) error {
+	return c.w.WriteAll(c.withComments(f))
+}
+
+func (c *commentLogWriter) Write(name string, f func(*hdrhist.LogWriter) error) error {
+	return c.w.Write(name, c.withComments(f))
+}
+
+func (c *commentLogWriter) Err() error { return c.w.Err() }
+func (c *commentLogWriter) private()   {}
@@ -0,0 +1,87 @@
+package recorders
+
+import "time"
+
+// A Shard records requests in one step of a MultiLatency.
+// Shards are NOT safe for concurrent use, but goroutines can each
+// record to their own shard without synchronizing, and the shards
+// are later added to the MultiLatency with Merge.
+type Shard struct {
+	step int
+	base *MultiLatency
+	ml   *MultiLatency
+}
+
+// Shard returns an empty shard of r for step.
+func (r *MultiLatency) Shard(step int) *Shard {
+	if r == nil {
+		return nil
+	}
+	return &Shard{step: step, base: r, ml: r.newShardRecorder(step)}
+}
+
+func (r *MultiLatency) newShardRecorder(step int) *MultiLatency {
+	cfg := r.cfg
+	if cfg.AutoResize {
+		// most shards see few values, so start small
+		cfg.HighestTrackable = 0
+	}
+	return NewMultiLatency(cfg, r.descs[step:step+1])
+}
+
+func (s *Shard) Record(name string, d time.Duration, e error) {
+	if s == nil {
+		return
+	}
+	s.ml.Record(name, 0, d, e)
+}
+
+func (s *Shard) AddBytes(name string, n int64) {
+	if s == nil {
+		return
+	}
+	s.ml.AddBytes(name, 0, n)
+}
+
+func (s *Shard) AddCount(name string, counter string, n int64) {
+	if s == nil {
+		return
+	}
+	s.ml.AddCount(name, 0, counter, n)
+}
+
+// Requests returns the number of requests recorded in s
+// that succeeded and that failed.
+func (s *Shard) Requests() (ok, failed int64) {
+	return s.ml.all.recs[0].TotalCount(), int64(s.ml.all.errs[0])
+}
+
+// Take returns a shard with everything recorded in s so far
+// and empties s.
+func (s *Shard) Take() *Shard {
+	t := *s
+	s.ml = s.base.newShardRecorder(s.step)
+	return &t
+}
+
+// Merge adds the requests recorded in s to r.
+// s must be a shard of r.
+func (r *MultiLatency) Merge(s *Shard) {
+	if r == nil || s == nil {
+		return
+	}
+	r.all.add(s.step, &s.ml.all, 0)
+	for name, l := range s.ml.sub {
+		r.subFor(name).add(s.step, l, 0)
+	}
+}
+
+// add adds step ostep of o into step.
+func (r *Latency) add(step int, o *Latency, ostep int) {
+	r.recs[step].Add(&o.recs[ostep])
+	r.errs[step] += o.errs[ostep]
+	r.bytes[step] += o.bytes[ostep]
+	for name, c := range o.counts {
+		r.AddCount(step, name, c[ostep])
+	}
+}
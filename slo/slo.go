@@ -0,0 +1,363 @@
+// Package slo checks benchmark results against service-level objectives.
+//
+// Objectives are given as rules, one per line:
+//
+//	[read|write] METRIC OP VALUE [at step [OP] N]
+//
+// METRIC is a latency percentile (e.g. p99) with a duration VALUE (e.g. 5ms),
+// "error rate" with a fractional or percentage VALUE (e.g. 0.001 or 0.1%),
+// or "achieved qps" with a VALUE in requests per second or relative
+// to the step's target (e.g. "95% target").
+// OP is one of <, <=, > and >=.
+// Rules without read or write apply to reads and writes together,
+// and rules without a step apply to all steps.
+// Rules relative to a target QPS ignore closed-loop steps.
+//
+// For example:
+//
+//	read p99 < 5ms at step >= 2
+//	error rate < 0.1%
+//	achieved qps >= 95% target
+package slo
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uluyol/fabbench/readers"
+	"github.com/uluyol/hdrhist"
+)
+
+type metric uint8
+
+const (
+	metricPercentile metric = iota + 1
+	metricErrorRate
+	metricQPS
+)
+
+// A Rule is a single objective.
+type Rule struct {
+	text string
+
+	op         string // "read", "write" or "" for both
+	metric     metric
+	percentile float64
+	cmp        string
+	value      float64 // ns, fraction, qps or fraction of target
+	ofTarget   bool
+
+	stepCmp string // "" for all steps
+	step    int
+}
+
+func (r *Rule) String() string { return r.text }
+
+// Parse parses a single rule.
+func Parse(s string) (*Rule, error) {
+	r := &Rule{text: strings.Join(strings.Fields(s), " ")}
+	toks := strings.Fields(strings.ToLower(s))
+	next := func() string {
+		if len(toks) == 0 {
+			return ""
+		}
+		t := toks[0]
+		toks = toks[1:]
+		return t
+	}
+
+	t := next()
+	if t == "read" || t == "write" {
+		r.op = t
+		t = next()
+	}
+	switch {
+	case t == "error" || t == "errors":
+		if t == "error" && next() != "rate" {
+			return nil, fmt.Errorf("%s: expected error rate", s)
+		}
+		r.metric = metricErrorRate
+	case t == "achieved" || t == "qps":
+		if t == "achieved" && next() != "qps" {
+			return nil, fmt.Errorf("%s: expected achieved qps", s)
+		}
+		r.metric = metricQPS
+	case strings.HasPrefix(t, "p"):
+		p, err := strconv.ParseFloat(t[1:], 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("%s: invalid percentile %s", s, t)
+		}
+		r.metric = metricPercentile
+		r.percentile = p
+	default:
+		return nil, fmt.Errorf("%s: unknown metric %q", s, t)
+	}
+
+	r.cmp = next()
+	if !validCmp(r.cmp, false) {
+		return nil, fmt.Errorf("%s: invalid comparison %q", s, r.cmp)
+	}
+
+	v := next()
+	var err error
+	switch r.metric {
+	case metricPercentile:
+		var d time.Duration
+		d, err = time.ParseDuration(v)
+		r.value = float64(d)
+	case metricErrorRate:
+		r.value, err = parseFrac(v)
+	case metricQPS:
+		if strings.HasSuffix(v, "%") {
+			r.value, err = parseFrac(v)
+			if len(toks) > 0 && toks[0] == "of" {
+				next()
+			}
+			if next() != "target" {
+				return nil, fmt.Errorf("%s: expected target after %s", s, v)
+			}
+			r.ofTarget = true
+		} else {
+			r.value, err = strconv.ParseFloat(v, 64)
+		}
+	}
+	if err != nil || v == "" {
+		return nil, fmt.Errorf("%s: invalid value %q", s, v)
+	}
+
+	if len(toks) > 0 {
+		if next() != "at" || next() != "step" {
+			return nil, fmt.Errorf("%s: expected at step", s)
+		}
+		r.stepCmp = "="
+		if len(toks) == 2 {
+			r.stepCmp = next()
+			if !validCmp(r.stepCmp, true) {
+				return nil, fmt.Errorf("%s: invalid comparison %q", s, r.stepCmp)
+			}
+		}
+		r.step, err = strconv.Atoi(next())
+		if err != nil || len(toks) > 0 {
+			return nil, fmt.Errorf("%s: invalid step", s)
+		}
+	}
+	return r, nil
+}
+
+func validCmp(c string, allowEq bool) bool {
+	switch c {
+	case "<", "<=", ">", ">=":
+		return true
+	case "=", "==":
+		return allowEq
+	}
+	return false
+}
+
+func parseFrac(s string) (float64, error) {
+	if strings.HasSuffix(s, "%") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		return v / 100, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// ParseRules parses rules from r, one per line.
+// Blank lines and lines starting with # are ignored.
+func ParseRules(r io.Reader) ([]*Rule, error) {
+	var rules []*Rule
+	s := bufio.NewScanner(r)
+	lineno := 0
+	for s.Scan() {
+		lineno++
+		t := strings.TrimSpace(s.Text())
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		rule, err := Parse(t)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", lineno, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, s.Err()
+}
+
+// Load parses the rules in the slo section of the fabbench config cfgData,
+// if set, and those in the file at path, if set.
+func Load(cfgData []byte, path string) ([]*Rule, error) {
+	var rules []*Rule
+	if cfgData != nil {
+		var cfg struct {
+			SLO []string `json:"slo"`
+		}
+		if err := json.Unmarshal(cfgData, &cfg); err != nil {
+			return nil, fmt.Errorf("unable to decode config: %v", err)
+		}
+		var err error
+		rules, err = ParseRules(strings.NewReader(strings.Join(cfg.SLO, "\n")))
+		if err != nil {
+			return nil, fmt.Errorf("bad slo in config: rule %v", err)
+		}
+	}
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		fileRules, err := ParseRules(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%v", path, err)
+		}
+		rules = append(rules, fileRules...)
+	}
+	return rules, nil
+}
+
+func compare(a float64, cmp string, b float64) bool {
+	switch cmp {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "=", "==":
+		return a == b
+	}
+	panic("bad comparison " + cmp)
+}
+
+// A Violation is a step that does not meet a rule.
+type Violation struct {
+	Rule *Rule
+	Step int
+	Got  float64 // in the units of the rule
+}
+
+func (v Violation) String() string {
+	var got string
+	switch {
+	case v.Rule.metric == metricPercentile:
+		got = time.Duration(v.Got).Round(time.Microsecond).String()
+	case v.Rule.metric == metricErrorRate:
+		got = strconv.FormatFloat(100*v.Got, 'f', 3, 64) + "%"
+	case v.Rule.ofTarget:
+		got = strconv.FormatFloat(100*v.Got, 'f', 1, 64) + "% target"
+	default:
+		got = strconv.FormatFloat(v.Got, 'f', 1, 64) + " qps"
+	}
+	return fmt.Sprintf("step %d: %s: got %s", v.Step, v.Rule, got)
+}
+
+type stepResult struct {
+	hist  *hdrhist.Hist
+	errs  int64
+	secs  float64
+	share float64 // of target qps
+}
+
+func (r *Rule) result(read, write *readers.Latency, step int) (stepResult, bool) {
+	var res stepResult
+	var target *readers.Target
+	for _, l := range []*readers.Latency{read, write} {
+		if l == nil || (r.op == "read" && l != read) || (r.op == "write" && l != write) {
+			continue
+		}
+		h := l.Hists[step]
+		if res.hist == nil {
+			cfg := h.Config()
+			cfg.AutoResize = true
+			res.hist = hdrhist.WithConfig(cfg)
+		}
+		res.hist.Add(h)
+		res.errs += int64(l.Errs[step])
+		if start, ok := h.StartTime(); ok {
+			if end, ok := h.EndTime(); ok && end.Sub(start).Seconds() > res.secs {
+				res.secs = end.Sub(start).Seconds()
+			}
+		}
+		if target == nil && l.Targets != nil {
+			target = l.Targets[step]
+		}
+	}
+	if res.hist == nil {
+		return res, false
+	}
+	if target != nil {
+		switch r.op {
+		case "read":
+			res.share = target.QPS * target.ReadRatio
+		case "write":
+			res.share = target.QPS * (1 - target.ReadRatio)
+		default:
+			res.share = target.QPS
+		}
+	}
+	return res, true
+}
+
+// Check checks the steps of the read and write logs against rules.
+// Either log may be nil, in which case rules on it are ignored.
+func Check(rules []*Rule, read, write *readers.Latency) ([]Violation, error) {
+	nsteps := -1
+	for _, l := range []*readers.Latency{read, write} {
+		if l == nil {
+			continue
+		}
+		if nsteps >= 0 && len(l.Hists) != nsteps {
+			return nil, errors.New("read and write logs have different numbers of steps")
+		}
+		nsteps = len(l.Hists)
+	}
+
+	var vs []Violation
+	for step := 0; step < nsteps; step++ {
+		for _, r := range rules {
+			if r.stepCmp != "" && !compare(float64(step), r.stepCmp, float64(r.step)) {
+				continue
+			}
+			res, ok := r.result(read, write, step)
+			if !ok {
+				continue
+			}
+			count := res.hist.TotalCount()
+			var got float64
+			switch r.metric {
+			case metricPercentile:
+				if count == 0 {
+					continue
+				}
+				got = float64(res.hist.PercentileVal(r.percentile).Value)
+			case metricErrorRate:
+				if count+res.errs > 0 {
+					got = float64(res.errs) / float64(count+res.errs)
+				}
+			case metricQPS:
+				if res.secs > 0 {
+					got = float64(count) / res.secs
+				}
+				if r.ofTarget {
+					if res.share == 0 {
+						continue
+					}
+					got /= res.share
+				}
+			}
+			if !compare(got, r.cmp, r.value) {
+				vs = append(vs, Violation{Rule: r, Step: step, Got: got})
+			}
+		}
+	}
+	return vs, nil
+}
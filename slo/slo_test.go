@@ -0,0 +1,166 @@
+package slo
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uluyol/fabbench/readers"
+	"github.com/uluyol/hdrhist"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in   string
+		want Rule
+		bad  bool
+	}{
+		{in: "read p99 < 5ms at step >= 2", want: Rule{op: "read", metric: metricPercentile, percentile: 99, cmp: "<", value: float64(5 * time.Millisecond), stepCmp: ">=", step: 2}},
+		{in: "p99.9 <= 1s", want: Rule{metric: metricPercentile, percentile: 99.9, cmp: "<=", value: float64(time.Second)}},
+		{in: "error rate < 0.1%", want: Rule{metric: metricErrorRate, cmp: "<", value: 0.001}},
+		{in: "write errors < 0.01 at step 3", want: Rule{op: "write", metric: metricErrorRate, cmp: "<", value: 0.01, stepCmp: "=", step: 3}},
+		{in: "achieved qps >= 95% target", want: Rule{metric: metricQPS, cmp: ">=", value: 0.95, ofTarget: true}},
+		{in: "Read QPS > 1000", want: Rule{op: "read", metric: metricQPS, cmp: ">", value: 1000}},
+		{in: "qps >= 95% of target", want: Rule{metric: metricQPS, cmp: ">=", value: 0.95, ofTarget: true}},
+		{in: "p99 < 5", bad: true},
+		{in: "p99 = 5ms", bad: true},
+		{in: "latency < 5ms", bad: true},
+		{in: "qps >= 95%", bad: true},
+		{in: "error rate < 1% at", bad: true},
+		{in: "error rate < 1% at step >= x", bad: true},
+		{in: "p99 < 5ms at step >= 1 2", bad: true},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.in)
+		if test.bad {
+			if err == nil {
+				t.Errorf("%s: want error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.in, err)
+			continue
+		}
+		got.text = ""
+		if *got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.in, *got, test.want)
+		}
+	}
+}
+
+func latency(desc string, target *readers.Target, lat []time.Duration, count []int64, errs []int32) *readers.Latency {
+	start := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	l := &readers.Latency{Errs: errs}
+	for i := range lat {
+		h := hdrhist.WithConfig(hdrhist.Config{
+			LowestDiscernible: int64(time.Microsecond),
+			HighestTrackable:  int64(time.Second),
+			SigFigs:           3,
+		})
+		h.RecordN(int64(lat[i]), count[i])
+		h.SetStartTime(start)
+		h.SetEndTime(start.Add(10 * time.Second))
+		start = start.Add(10 * time.Second)
+		l.Hists = append(l.Hists, h)
+		l.Descs = append(l.Descs, desc)
+		l.Targets = append(l.Targets, target)
+	}
+	return l
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	const desc = "d=10s rw=0.500000 qps=200 ad=poisson rkd=uniform wkd=uniform"
+	target := &readers.Target{QPS: 200, ReadRatio: 0.5}
+	read := latency(desc, target,
+		[]time.Duration{time.Millisecond, 10 * time.Millisecond, time.Millisecond},
+		[]int64{1000, 1000, 900}, []int32{0, 0, 100})
+	write := latency(desc, target,
+		[]time.Duration{time.Millisecond, time.Millisecond, 10 * time.Millisecond},
+		[]int64{1000, 1000, 1000}, []int32{0, 0, 0})
+
+	tests := []struct {
+		rules string
+		want  []string
+	}{
+		{"read p99 < 5ms", []string{"step 1: read p99 < 5ms: got 10.002ms"}},
+		{"read p99 < 5ms at step >= 2", nil},
+		{"p99 < 5ms at step 2", []string{"step 2: p99 < 5ms at step 2: got 10.002ms"}},
+		{"# comment\n\nerror rate < 1%", []string{"step 2: error rate < 1%: got 5.000%"}},
+		{"read error rate < 1%", []string{"step 2: read error rate < 1%: got 10.000%"}},
+		{"write error rate < 1%", nil},
+		{"achieved qps >= 200", []string{"step 2: achieved qps >= 200: got 190.0 qps"}},
+		{"read qps >= 95% target", []string{"step 2: read qps >= 95% target: got 90.0% target"}},
+	}
+	for _, test := range tests {
+		rules, err := ParseRules(strings.NewReader(test.rules))
+		if err != nil {
+			t.Fatalf("%q: unable to parse: %v", test.rules, err)
+		}
+		vs, err := Check(rules, read, write)
+		if err != nil {
+			t.Fatalf("%q: unable to check: %v", test.rules, err)
+		}
+		var got []string
+		for _, v := range vs {
+			got = append(got, v.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%q: got %q, want %q", test.rules, got, test.want)
+		}
+	}
+
+	if _, err := Check(nil, read, latency(desc, target, nil, nil, nil)); err == nil {
+		t.Error("want error for logs with different steps")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+	f, err := ioutil.TempFile("", "slo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# from file\nwrite p99 < 10ms\n")
+	f.Close()
+
+	cfg := []byte(`{"db": {"name": "dummy"}, "slo": ["read p50 < 1ms", "error rate < 1%"]}`)
+	tests := []struct {
+		cfg  []byte
+		path string
+		want []string
+		bad  bool
+	}{
+		{cfg: cfg, want: []string{"read p50 < 1ms", "error rate < 1%"}},
+		{cfg: cfg, path: f.Name(), want: []string{"read p50 < 1ms", "error rate < 1%", "write p99 < 10ms"}},
+		{path: f.Name(), want: []string{"write p99 < 10ms"}},
+		{cfg: []byte(`{"slo": ["p99 < soon"]}`), bad: true},
+		{cfg: []byte(`{`), bad: true},
+		{path: f.Name() + "-missing", bad: true},
+	}
+	for _, test := range tests {
+		rules, err := Load(test.cfg, test.path)
+		if test.bad {
+			if err == nil {
+				t.Errorf("%s %s: want error", test.cfg, test.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %v", test.cfg, test.path, err)
+			continue
+		}
+		var got []string
+		for _, r := range rules {
+			got = append(got, r.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s %s: got rules %q, want %q", test.cfg, test.path, got, test.want)
+		}
+	}
+}